@@ -15,33 +15,70 @@ const docTemplate = `{
     "host": "{{.Host}}",
     "basePath": "{{.BasePath}}",
     "paths": {
-        "/subscriptions": {
+        "/keys": {
             "get": {
-                "description": "Lists all subscriptions",
-                "consumes": [
-                    "application/json"
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
                 ],
+                "description": "Lists every API key of the tenant, including revoked ones. Keys themselves are never returned.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "subscriptions"
+                    "keys"
                 ],
-                "summary": "List all subscriptions",
+                "summary": "List API keys",
                 "responses": {
                     "200": {
-                        "description": "List of subscriptions",
+                        "description": "API keys",
                         "schema": {
                             "type": "array",
                             "items": {
-                                "$ref": "#/definitions/models.Subscription"
+                                "$ref": "#/definitions/models.APIKey"
                             }
                         }
+                    },
+                    "401": {
+                        "description": "Missing or invalid credentials",
+                        "schema": {
+                            "$ref": "#/definitions/api.Problem"
+                        }
+                    },
+                    "403": {
+                        "description": "API key is not admin",
+                        "schema": {
+                            "$ref": "#/definitions/api.Problem"
+                        }
+                    },
+                    "429": {
+                        "description": "Too many requests",
+                        "schema": {
+                            "$ref": "#/definitions/api.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal error",
+                        "schema": {
+                            "$ref": "#/definitions/api.Problem"
+                        }
                     }
                 }
             },
             "post": {
-                "description": "Creates a new subscription",
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Creates an API key with the given scopes. Scopes are ordered, ` + "`" + `admin` + "`" + ` includes ` + "`" + `write` + "`" + `, ` + "`" + `write` + "`" + ` includes ` + "`" + `read` + "`" + `. Keys without ` + "`" + `admin` + "`" + ` act for the user in ` + "`" + `user_id` + "`" + ` and only access that user's subscriptions. The key is returned only once.",
                 "consumes": [
                     "application/json"
                 ],
@@ -49,79 +86,141 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "subscriptions"
+                    "keys"
                 ],
-                "summary": "Create a new subscription",
+                "summary": "Create an API key",
                 "parameters": [
                     {
-                        "description": "Subscription details",
-                        "name": "subscription",
+                        "description": "Key name, scopes and user",
+                        "name": "key",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/models.Subscription"
+                            "$ref": "#/definitions/models.NewAPIKey"
                         }
                     }
                 ],
                 "responses": {
                     "201": {
-                        "description": "ID of the created subscription",
+                        "description": "Created key",
                         "schema": {
-                            "type": "int"
+                            "$ref": "#/definitions/models.CreatedAPIKey"
                         }
                     },
                     "400": {
                         "description": "Invalid input",
                         "schema": {
-                            "type": "string"
+                            "$ref": "#/definitions/api.Problem"
+                        }
+                    },
+                    "401": {
+                        "description": "Missing or invalid credentials",
+                        "schema": {
+                            "$ref": "#/definitions/api.Problem"
+                        }
+                    },
+                    "403": {
+                        "description": "API key is not admin",
+                        "schema": {
+                            "$ref": "#/definitions/api.Problem"
+                        }
+                    },
+                    "429": {
+                        "description": "Too many requests",
+                        "schema": {
+                            "$ref": "#/definitions/api.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal error",
+                        "schema": {
+                            "$ref": "#/definitions/api.Problem"
                         }
                     }
                 }
             }
         },
-        "/subscriptions/calc": {
-            "post": {
-                "description": "Calculates the subscription price based on a filter. Looks for all subscriptions with given ` + "`" + `user_id` + "`" + ` and ` + "`" + `service_name` + "`" + ` between ` + "`" + `start_date` + "`" + ` and ` + "`" + `end_date` + "`" + `. Fields may be omitted but needs at least 1.",
-                "consumes": [
-                    "application/json"
-                ],
-                "produces": [
-                    "application/json"
+        "/keys/{id}": {
+            "delete": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
                 ],
+                "description": "Revokes an API key of the tenant by ID. Requests with a revoked key are rejected.",
                 "tags": [
-                    "subscriptions"
+                    "keys"
                 ],
-                "summary": "Calculate subscription price",
+                "summary": "Revoke an API key",
                 "parameters": [
                     {
-                        "description": "Filter for subscription calculation",
-                        "name": "filter",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/models.Subscription"
-                        }
+                        "type": "integer",
+                        "description": "API key ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
                     }
                 ],
                 "responses": {
-                    "200": {
-                        "description": "Calculated price",
+                    "204": {
+                        "description": "API key revoked",
                         "schema": {
-                            "type": "int"
+                            "type": "string"
                         }
                     },
                     "400": {
                         "description": "Invalid input",
                         "schema": {
-                            "type": "string"
+                            "$ref": "#/definitions/api.Problem"
+                        }
+                    },
+                    "401": {
+                        "description": "Missing or invalid credentials",
+                        "schema": {
+                            "$ref": "#/definitions/api.Problem"
+                        }
+                    },
+                    "403": {
+                        "description": "API key is not admin",
+                        "schema": {
+                            "$ref": "#/definitions/api.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "API key not found in the tenant",
+                        "schema": {
+                            "$ref": "#/definitions/api.Problem"
+                        }
+                    },
+                    "429": {
+                        "description": "Too many requests",
+                        "schema": {
+                            "$ref": "#/definitions/api.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal error",
+                        "schema": {
+                            "$ref": "#/definitions/api.Problem"
                         }
                     }
                 }
             }
         },
-        "/subscriptions/{id}": {
+        "/subscriptions": {
             "get": {
-                "description": "Reads a subscription by ID",
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Lists subscriptions page by page. Filters work the same way as in ` + "`" + `/subscriptions/calc` + "`" + `. ` + "`" + `Last-Modified` + "`" + ` is the latest change of a subscription on the page, empty pages have none. Clients polling with ` + "`" + `If-Modified-Since` + "`" + ` get 304 while no subscription on the page changed, deletions don't count as changes. To fetch only what changed since the last poll, ask with ` + "`" + `updated_since` + "`" + `, deleted subscriptions are not reported.",
                 "consumes": [
                     "application/json"
                 ],
@@ -131,33 +230,152 @@ const docTemplate = `{
                 "tags": [
                     "subscriptions"
                 ],
-                "summary": "Read a subscription by ID",
+                "summary": "List subscriptions",
                 "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Tenant ID for platform admins, the default tenant if omitted. Other callers may only repeat their own",
+                        "name": "X-Tenant-ID",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Filter by user ID",
+                        "name": "user_id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Filter by service name",
+                        "name": "service_name",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Window start, MM-YYYY",
+                        "name": "start_date",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Window end, MM-YYYY",
+                        "name": "end_date",
+                        "in": "query"
+                    },
+                    {
+                        "enum": [
+                            "overlap",
+                            "contain"
+                        ],
+                        "type": "string",
+                        "description": "Window matching mode",
+                        "name": "mode",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only subscriptions changed at or after the time, RFC 3339",
+                        "name": "updated_since",
+                        "in": "query"
+                    },
                     {
                         "type": "integer",
-                        "description": "Subscription ID",
-                        "name": "id",
-                        "in": "path",
-                        "required": true
+                        "default": 50,
+                        "description": "Page size, up to 1000",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "default": 0,
+                        "description": "Number of subscriptions to skip",
+                        "name": "offset",
+                        "in": "query"
+                    },
+                    {
+                        "enum": [
+                            "id",
+                            "-id",
+                            "price",
+                            "-price",
+                            "start_date",
+                            "-start_date",
+                            "service_name",
+                            "-service_name"
+                        ],
+                        "type": "string",
+                        "description": "Sort field, prefix with ` + "`" + `-` + "`" + ` for descending order",
+                        "name": "sort",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Last-Modified of the page the client has",
+                        "name": "If-Modified-Since",
+                        "in": "header"
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "Subscription details",
+                        "description": "Page of subscriptions",
                         "schema": {
-                            "$ref": "#/definitions/models.Subscription"
+                            "$ref": "#/definitions/models.SubscriptionPage"
+                        },
+                        "headers": {
+                            "Last-Modified": {
+                                "type": "string",
+                                "description": "Time of the latest change on the page"
+                            }
                         }
                     },
-                    "404": {
-                        "description": "Subscription not found",
+                    "304": {
+                        "description": "Page not modified",
                         "schema": {
                             "type": "string"
                         }
+                    },
+                    "400": {
+                        "description": "Invalid input",
+                        "schema": {
+                            "$ref": "#/definitions/api.Problem"
+                        }
+                    },
+                    "401": {
+                        "description": "Missing or invalid credentials",
+                        "schema": {
+                            "$ref": "#/definitions/api.Problem"
+                        }
+                    },
+                    "403": {
+                        "description": "Caller lacks the scope required or asks for another user's subscriptions",
+                        "schema": {
+                            "$ref": "#/definitions/api.Problem"
+                        }
+                    },
+                    "429": {
+                        "description": "Too many requests",
+                        "schema": {
+                            "$ref": "#/definitions/api.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal error",
+                        "schema": {
+                            "$ref": "#/definitions/api.Problem"
+                        }
                     }
                 }
             },
-            "delete": {
-                "description": "Deletes a subscription by ID",
+            "post": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Creates a new subscription. Bearer token callers without the ` + "`" + `admin` + "`" + ` scope may omit ` + "`" + `user_id` + "`" + `, it defaults to the token subject. Requests with an ` + "`" + `Idempotency-Key` + "`" + ` header are safe to retry.",
                 "consumes": [
                     "application/json"
                 ],
@@ -167,33 +385,109 @@ const docTemplate = `{
                 "tags": [
                     "subscriptions"
                 ],
-                "summary": "Delete a subscription by ID",
+                "summary": "Create a new subscription",
                 "parameters": [
                     {
-                        "type": "integer",
-                        "description": "Subscription ID",
-                        "name": "id",
-                        "in": "path",
-                        "required": true
+                        "type": "string",
+                        "description": "Tenant ID for platform admins, the default tenant if omitted. Other callers may only repeat their own",
+                        "name": "X-Tenant-ID",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Key making retries safe, a repeat of the request replays the first response",
+                        "name": "Idempotency-Key",
+                        "in": "header"
+                    },
+                    {
+                        "description": "Subscription details",
+                        "name": "subscription",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.Subscription"
+                        }
                     }
                 ],
                 "responses": {
-                    "204": {
-                        "description": "Subscription deleted",
+                    "201": {
+                        "description": "ID of the created subscription",
                         "schema": {
-                            "type": "string"
+                            "type": "int"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "Subscription version"
+                            },
+                            "Location": {
+                                "type": "string",
+                                "description": "URL of the created subscription"
+                            }
                         }
                     },
-                    "404": {
-                        "description": "Subscription not found",
+                    "400": {
+                        "description": "Invalid input",
                         "schema": {
-                            "type": "string"
+                            "$ref": "#/definitions/api.Problem"
+                        }
+                    },
+                    "401": {
+                        "description": "Missing or invalid credentials",
+                        "schema": {
+                            "$ref": "#/definitions/api.Problem"
+                        }
+                    },
+                    "403": {
+                        "description": "Caller lacks the scope required or asks for another user's subscriptions",
+                        "schema": {
+                            "$ref": "#/definitions/api.Problem"
+                        }
+                    },
+                    "409": {
+                        "description": "Subscription already exists or request with the idempotency key in progress",
+                        "schema": {
+                            "$ref": "#/definitions/api.Problem"
+                        }
+                    },
+                    "413": {
+                        "description": "Body too large for a request with an idempotency key",
+                        "schema": {
+                            "$ref": "#/definitions/api.Problem"
+                        }
+                    },
+                    "422": {
+                        "description": "Constraint violation or idempotency key used for another request",
+                        "schema": {
+                            "$ref": "#/definitions/api.Problem"
+                        }
+                    },
+                    "429": {
+                        "description": "Too many requests",
+                        "schema": {
+                            "$ref": "#/definitions/api.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal error",
+                        "schema": {
+                            "$ref": "#/definitions/api.Problem"
                         }
                     }
                 }
-            },
-            "patch": {
-                "description": "Updates a subscription by ID. Needs at least 1 field to update. Send ` + "`" + `\"end_date\": \"0\"` + "`" + ` to set null.",
+            }
+        },
+        "/subscriptions/calc": {
+            "post": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Calculates the subscription price based on a filter. Looks for all subscriptions with given ` + "`" + `user_id` + "`" + ` and ` + "`" + `service_name` + "`" + ` between ` + "`" + `start_date` + "`" + ` and ` + "`" + `end_date` + "`" + `. Fields may be omitted but needs at least 1. By default (` + "`" + `\"mode\": \"overlap\"` + "`" + `) every subscription active at any point of the window is counted, ` + "`" + `\"mode\": \"contain\"` + "`" + ` counts only subscriptions fully contained in the window. Each subscription costs ` + "`" + `price` + "`" + ` for every month it is active within the window, open-ended subscriptions are counted up to ` + "`" + `end_date` + "`" + ` (current month in the tenant time zone if omitted). The price is in the tenant ` + "`" + `currency` + "`" + `.",
                 "consumes": [
                     "application/json"
                 ],
@@ -203,55 +497,920 @@ const docTemplate = `{
                 "tags": [
                     "subscriptions"
                 ],
-                "summary": "Update a subscription by ID",
+                "summary": "Calculate subscription price",
                 "parameters": [
                     {
-                        "type": "integer",
-                        "description": "Subscription ID",
-                        "name": "id",
-                        "in": "path",
-                        "required": true
+                        "type": "string",
+                        "description": "Tenant ID for platform admins, the default tenant if omitted. Other callers may only repeat their own",
+                        "name": "X-Tenant-ID",
+                        "in": "header"
                     },
                     {
-                        "description": "Accepted fields of Subscription: ` + "`" + `service_name` + "`" + `, ` + "`" + `price` + "`" + `, ` + "`" + `user_id` + "`" + `, ` + "`" + `start_date` + "`" + `, ` + "`" + `end_date` + "`" + `",
-                        "name": "subscription",
+                        "description": "Filter for subscription calculation",
+                        "name": "filter",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/models.Subscription"
+                            "$ref": "#/definitions/models.SubscriptionFilter"
                         }
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "Updated subscription details",
+                        "description": "Calculated price and its currency",
                         "schema": {
-                            "$ref": "#/definitions/models.Subscription"
+                            "type": "object",
+                            "additionalProperties": true
                         }
                     },
                     "400": {
                         "description": "Invalid input",
                         "schema": {
-                            "type": "string"
+                            "$ref": "#/definitions/api.Problem"
+                        }
+                    },
+                    "401": {
+                        "description": "Missing or invalid credentials",
+                        "schema": {
+                            "$ref": "#/definitions/api.Problem"
+                        }
+                    },
+                    "403": {
+                        "description": "Caller lacks the scope required or asks for another user's subscriptions",
+                        "schema": {
+                            "$ref": "#/definitions/api.Problem"
+                        }
+                    },
+                    "429": {
+                        "description": "Too many requests",
+                        "schema": {
+                            "$ref": "#/definitions/api.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal error",
+                        "schema": {
+                            "$ref": "#/definitions/api.Problem"
                         }
                     }
                 }
             }
-        }
-    },
-    "definitions": {
-        "models.Subscription": {
-            "type": "object",
-            "properties": {
-                "end_date": {
-                    "description": "omitempty?",
-                    "type": "string"
-                },
-                "id": {
-                    "type": "integer"
-                },
-                "price": {
-                    "type": "integer"
+        },
+        "/subscriptions/calc/breakdown": {
+            "post": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Splits the cost of subscriptions matching the filter by ` + "`" + `service_name` + "`" + `, by ` + "`" + `user_id` + "`" + ` and by calendar month. Takes the same filter as ` + "`" + `/subscriptions/calc` + "`" + `, but ` + "`" + `start_date` + "`" + ` and ` + "`" + `end_date` + "`" + ` are required.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "subscriptions"
+                ],
+                "summary": "Calculate subscription cost breakdown",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Tenant ID for platform admins, the default tenant if omitted. Other callers may only repeat their own",
+                        "name": "X-Tenant-ID",
+                        "in": "header"
+                    },
+                    {
+                        "description": "Filter for subscription calculation",
+                        "name": "filter",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.SubscriptionFilter"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Cost breakdown",
+                        "schema": {
+                            "$ref": "#/definitions/models.CostBreakdown"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid input",
+                        "schema": {
+                            "$ref": "#/definitions/api.Problem"
+                        }
+                    },
+                    "401": {
+                        "description": "Missing or invalid credentials",
+                        "schema": {
+                            "$ref": "#/definitions/api.Problem"
+                        }
+                    },
+                    "403": {
+                        "description": "Caller lacks the scope required or asks for another user's subscriptions",
+                        "schema": {
+                            "$ref": "#/definitions/api.Problem"
+                        }
+                    },
+                    "429": {
+                        "description": "Too many requests",
+                        "schema": {
+                            "$ref": "#/definitions/api.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal error",
+                        "schema": {
+                            "$ref": "#/definitions/api.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/subscriptions/{id}": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Reads a subscription by ID. The ` + "`" + `ETag` + "`" + ` header holds its version for ` + "`" + `If-Match` + "`" + ` of updates and deletes. Clients polling with ` + "`" + `If-Modified-Since` + "`" + ` get 304 while the subscription is unchanged.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "subscriptions"
+                ],
+                "summary": "Read a subscription by ID",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Tenant ID for platform admins, the default tenant if omitted. Other callers may only repeat their own",
+                        "name": "X-Tenant-ID",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Last-Modified of the copy the client has",
+                        "name": "If-Modified-Since",
+                        "in": "header"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Subscription ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Subscription details",
+                        "schema": {
+                            "$ref": "#/definitions/models.Subscription"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "Subscription version"
+                            },
+                            "Last-Modified": {
+                                "type": "string",
+                                "description": "Time of the last change"
+                            }
+                        }
+                    },
+                    "304": {
+                        "description": "Subscription not modified",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "401": {
+                        "description": "Missing or invalid credentials",
+                        "schema": {
+                            "$ref": "#/definitions/api.Problem"
+                        }
+                    },
+                    "403": {
+                        "description": "Caller lacks the scope required or asks for another user's subscriptions",
+                        "schema": {
+                            "$ref": "#/definitions/api.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "Subscription not found",
+                        "schema": {
+                            "$ref": "#/definitions/api.Problem"
+                        }
+                    },
+                    "429": {
+                        "description": "Too many requests",
+                        "schema": {
+                            "$ref": "#/definitions/api.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal error",
+                        "schema": {
+                            "$ref": "#/definitions/api.Problem"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Deletes a subscription by ID. Needs ` + "`" + `If-Match` + "`" + ` with the ` + "`" + `ETag` + "`" + ` of the version to delete, or ` + "`" + `*` + "`" + ` for any version.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "subscriptions"
+                ],
+                "summary": "Delete a subscription by ID",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Tenant ID for platform admins, the default tenant if omitted. Other callers may only repeat their own",
+                        "name": "X-Tenant-ID",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "ETags of the subscription versions to delete or *",
+                        "name": "If-Match",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Subscription ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "Subscription deleted",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid input",
+                        "schema": {
+                            "$ref": "#/definitions/api.Problem"
+                        }
+                    },
+                    "401": {
+                        "description": "Missing or invalid credentials",
+                        "schema": {
+                            "$ref": "#/definitions/api.Problem"
+                        }
+                    },
+                    "403": {
+                        "description": "Caller lacks the scope required or asks for another user's subscriptions",
+                        "schema": {
+                            "$ref": "#/definitions/api.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "Subscription not found",
+                        "schema": {
+                            "$ref": "#/definitions/api.Problem"
+                        }
+                    },
+                    "412": {
+                        "description": "Subscription was changed since the If-Match version",
+                        "schema": {
+                            "$ref": "#/definitions/api.Problem"
+                        }
+                    },
+                    "428": {
+                        "description": "If-Match is missing",
+                        "schema": {
+                            "$ref": "#/definitions/api.Problem"
+                        }
+                    },
+                    "429": {
+                        "description": "Too many requests",
+                        "schema": {
+                            "$ref": "#/definitions/api.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal error",
+                        "schema": {
+                            "$ref": "#/definitions/api.Problem"
+                        }
+                    }
+                }
+            },
+            "patch": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Updates a subscription by ID. Needs at least 1 field to update. Send ` + "`" + `\"end_date\": \"0\"` + "`" + ` to set null. Needs ` + "`" + `If-Match` + "`" + ` with the ` + "`" + `ETag` + "`" + ` of the version to update, or ` + "`" + `*` + "`" + ` for any version.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "subscriptions"
+                ],
+                "summary": "Update a subscription by ID",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Tenant ID for platform admins, the default tenant if omitted. Other callers may only repeat their own",
+                        "name": "X-Tenant-ID",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "ETags of the subscription versions to update or *",
+                        "name": "If-Match",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Subscription ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Accepted fields of Subscription: ` + "`" + `service_name` + "`" + `, ` + "`" + `price` + "`" + `, ` + "`" + `user_id` + "`" + `, ` + "`" + `start_date` + "`" + `, ` + "`" + `end_date` + "`" + `",
+                        "name": "subscription",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.Subscription"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Subscription updated",
+                        "schema": {
+                            "type": "string"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "New subscription version"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid input",
+                        "schema": {
+                            "$ref": "#/definitions/api.Problem"
+                        }
+                    },
+                    "401": {
+                        "description": "Missing or invalid credentials",
+                        "schema": {
+                            "$ref": "#/definitions/api.Problem"
+                        }
+                    },
+                    "403": {
+                        "description": "Caller lacks the scope required or asks for another user's subscriptions",
+                        "schema": {
+                            "$ref": "#/definitions/api.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "Subscription not found",
+                        "schema": {
+                            "$ref": "#/definitions/api.Problem"
+                        }
+                    },
+                    "409": {
+                        "description": "Subscription already exists",
+                        "schema": {
+                            "$ref": "#/definitions/api.Problem"
+                        }
+                    },
+                    "412": {
+                        "description": "Subscription was changed since the If-Match version",
+                        "schema": {
+                            "$ref": "#/definitions/api.Problem"
+                        }
+                    },
+                    "422": {
+                        "description": "Constraint violation",
+                        "schema": {
+                            "$ref": "#/definitions/api.Problem"
+                        }
+                    },
+                    "428": {
+                        "description": "If-Match is missing",
+                        "schema": {
+                            "$ref": "#/definitions/api.Problem"
+                        }
+                    },
+                    "429": {
+                        "description": "Too many requests",
+                        "schema": {
+                            "$ref": "#/definitions/api.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal error",
+                        "schema": {
+                            "$ref": "#/definitions/api.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/subscriptions/{id}/history": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Lists changes of a subscription oldest first: who made them, in which request and the subscription before and after. Deleted subscriptions keep their history, subscriptions created before changes were recorded have an empty one. ` + "`" + `Last-Modified` + "`" + ` is the time of the last change, clients polling with ` + "`" + `If-Modified-Since` + "`" + ` get 304 until the next one.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "subscriptions"
+                ],
+                "summary": "Change history of a subscription",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Tenant ID for platform admins, the default tenant if omitted. Other callers may only repeat their own",
+                        "name": "X-Tenant-ID",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Last-Modified of the history the client has",
+                        "name": "If-Modified-Since",
+                        "in": "header"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Subscription ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Subscription events",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.SubscriptionEvent"
+                            }
+                        },
+                        "headers": {
+                            "Last-Modified": {
+                                "type": "string",
+                                "description": "Time of the last change"
+                            }
+                        }
+                    },
+                    "304": {
+                        "description": "History not modified",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid ID",
+                        "schema": {
+                            "$ref": "#/definitions/api.Problem"
+                        }
+                    },
+                    "401": {
+                        "description": "Missing or invalid credentials",
+                        "schema": {
+                            "$ref": "#/definitions/api.Problem"
+                        }
+                    },
+                    "403": {
+                        "description": "Caller lacks the scope required or asks for another user's subscriptions",
+                        "schema": {
+                            "$ref": "#/definitions/api.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "Subscription not found",
+                        "schema": {
+                            "$ref": "#/definitions/api.Problem"
+                        }
+                    },
+                    "429": {
+                        "description": "Too many requests",
+                        "schema": {
+                            "$ref": "#/definitions/api.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal error",
+                        "schema": {
+                            "$ref": "#/definitions/api.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/tenant": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Returns the tenant the request is resolved to and its defaults. API keys act for the tenant they were created in, bearer tokens for their ` + "`" + `tenant` + "`" + ` claim. Platform admins, the bootstrap key and admin tokens without a ` + "`" + `tenant` + "`" + ` claim, pick a tenant with the ` + "`" + `X-Tenant-ID` + "`" + ` header.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "tenants"
+                ],
+                "summary": "Current tenant",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Tenant ID for platform admins, the default tenant if omitted. Other callers may only repeat their own",
+                        "name": "X-Tenant-ID",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Tenant settings",
+                        "schema": {
+                            "$ref": "#/definitions/tenant.Tenant"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid tenant ID",
+                        "schema": {
+                            "$ref": "#/definitions/api.Problem"
+                        }
+                    },
+                    "401": {
+                        "description": "Missing or invalid credentials",
+                        "schema": {
+                            "$ref": "#/definitions/api.Problem"
+                        }
+                    },
+                    "403": {
+                        "description": "Unknown tenant, credentials bound to another tenant or token without a tenant",
+                        "schema": {
+                            "$ref": "#/definitions/api.Problem"
+                        }
+                    },
+                    "429": {
+                        "description": "Too many requests",
+                        "schema": {
+                            "$ref": "#/definitions/api.Problem"
+                        }
+                    }
+                }
+            }
+        }
+    },
+    "definitions": {
+        "api.Problem": {
+            "type": "object",
+            "properties": {
+                "code": {
+                    "type": "string"
+                },
+                "detail": {
+                    "type": "string"
+                },
+                "errors": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.FieldError"
+                    }
+                },
+                "instance": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "integer"
+                },
+                "title": {
+                    "type": "string"
+                },
+                "type": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.APIKey": {
+            "type": "object",
+            "properties": {
+                "created_at": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "name": {
+                    "type": "string",
+                    "example": "billing-export"
+                },
+                "prefix": {
+                    "type": "string",
+                    "example": "emk_3f9a1c"
+                },
+                "revoked_at": {
+                    "type": "string"
+                },
+                "scopes": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "read",
+                        "write"
+                    ]
+                },
+                "tenant_id": {
+                    "description": "TenantId is the tenant the key was created in, non-admin keys only\nact for it.",
+                    "type": "string",
+                    "example": "default"
+                },
+                "user_id": {
+                    "description": "UserId is the user a non-admin key acts for, see auth.Principal.",
+                    "type": "string",
+                    "example": "60601fee-2bf1-4721-ae6f-7636e79a0cba"
+                }
+            }
+        },
+        "models.CostBreakdown": {
+            "type": "object",
+            "properties": {
+                "by_month": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.CostGroup"
+                    }
+                },
+                "by_service": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.CostGroup"
+                    }
+                },
+                "by_user": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.CostGroup"
+                    }
+                },
+                "currency": {
+                    "description": "Currency is the ISO 4217 code of the tenant the totals are in.",
+                    "type": "string"
+                }
+            }
+        },
+        "models.CostGroup": {
+            "type": "object",
+            "properties": {
+                "count": {
+                    "type": "integer"
+                },
+                "key": {
+                    "type": "string"
+                },
+                "total": {
+                    "type": "integer"
+                }
+            }
+        },
+        "models.CreatedAPIKey": {
+            "type": "object",
+            "properties": {
+                "created_at": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "key": {
+                    "type": "string",
+                    "example": "emk_3f9a1c0e5b2d4c7a9e8f1b3d5c7a9e0f2b4d6c8a0e2f4b6d"
+                },
+                "name": {
+                    "type": "string",
+                    "example": "billing-export"
+                },
+                "prefix": {
+                    "type": "string",
+                    "example": "emk_3f9a1c"
+                },
+                "revoked_at": {
+                    "type": "string"
+                },
+                "scopes": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "read",
+                        "write"
+                    ]
+                },
+                "tenant_id": {
+                    "description": "TenantId is the tenant the key was created in, non-admin keys only\nact for it.",
+                    "type": "string",
+                    "example": "default"
+                },
+                "user_id": {
+                    "description": "UserId is the user a non-admin key acts for, see auth.Principal.",
+                    "type": "string",
+                    "example": "60601fee-2bf1-4721-ae6f-7636e79a0cba"
+                }
+            }
+        },
+        "models.FieldError": {
+            "type": "object",
+            "properties": {
+                "field": {
+                    "type": "string"
+                },
+                "message": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.NewAPIKey": {
+            "type": "object",
+            "properties": {
+                "name": {
+                    "type": "string",
+                    "example": "billing-export"
+                },
+                "scopes": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "read",
+                        "write"
+                    ]
+                },
+                "user_id": {
+                    "description": "UserId binds the key to a user, required unless the key is an admin\none.",
+                    "type": "string",
+                    "example": "60601fee-2bf1-4721-ae6f-7636e79a0cba"
+                }
+            }
+        },
+        "models.Subscription": {
+            "type": "object",
+            "properties": {
+                "created_at": {
+                    "description": "CreatedAt and UpdatedAt are maintained by the storage.",
+                    "type": "string"
+                },
+                "end_date": {
+                    "description": "omitempty?",
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "price": {
+                    "type": "integer"
+                },
+                "service_name": {
+                    "type": "string"
+                },
+                "start_date": {
+                    "type": "string"
+                },
+                "tenant_id": {
+                    "type": "string"
+                },
+                "updated_at": {
+                    "type": "string"
+                },
+                "user_id": {
+                    "type": "string"
+                },
+                "version": {
+                    "description": "Version is bumped on every update. A non-zero Version of an update is\nthe version the caller expects to replace.",
+                    "type": "integer"
+                }
+            }
+        },
+        "models.SubscriptionEvent": {
+            "type": "object",
+            "properties": {
+                "action": {
+                    "type": "string",
+                    "enum": [
+                        "create",
+                        "update",
+                        "delete"
+                    ]
+                },
+                "actor": {
+                    "description": "Actor is the caller that made the change, see auth.Principal.Actor.",
+                    "type": "string",
+                    "example": "key:1"
+                },
+                "after": {
+                    "type": "object"
+                },
+                "before": {
+                    "description": "Before and After hold the subscription around the change, null when\nit did not exist.",
+                    "type": "object"
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "request_id": {
+                    "type": "string"
+                },
+                "subscription_id": {
+                    "type": "integer"
+                }
+            }
+        },
+        "models.SubscriptionFilter": {
+            "type": "object",
+            "properties": {
+                "created_at": {
+                    "description": "CreatedAt and UpdatedAt are maintained by the storage.",
+                    "type": "string"
+                },
+                "end_date": {
+                    "description": "omitempty?",
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "mode": {
+                    "type": "string",
+                    "default": "overlap",
+                    "enum": [
+                        "overlap",
+                        "contain"
+                    ]
+                },
+                "price": {
+                    "type": "integer"
                 },
                 "service_name": {
                     "type": "string"
@@ -259,11 +1418,76 @@ const docTemplate = `{
                 "start_date": {
                     "type": "string"
                 },
+                "tenant_id": {
+                    "type": "string"
+                },
+                "updated_at": {
+                    "type": "string"
+                },
+                "updated_since": {
+                    "description": "UpdatedSince matches subscriptions changed at or after the time.",
+                    "type": "string"
+                },
                 "user_id": {
                     "type": "string"
+                },
+                "version": {
+                    "description": "Version is bumped on every update. A non-zero Version of an update is\nthe version the caller expects to replace.",
+                    "type": "integer"
+                }
+            }
+        },
+        "models.SubscriptionPage": {
+            "type": "object",
+            "properties": {
+                "items": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.Subscription"
+                    }
+                },
+                "limit": {
+                    "type": "integer"
+                },
+                "next_offset": {
+                    "type": "integer"
+                },
+                "offset": {
+                    "type": "integer"
+                },
+                "total": {
+                    "type": "integer"
+                }
+            }
+        },
+        "tenant.Tenant": {
+            "type": "object",
+            "properties": {
+                "currency": {
+                    "description": "Currency is the ISO 4217 code prices of the tenant are in.",
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "time_zone": {
+                    "description": "TimeZone is the IANA zone the current month is taken in.",
+                    "type": "string"
                 }
             }
         }
+    },
+    "securityDefinitions": {
+        "ApiKeyAuth": {
+            "type": "apiKey",
+            "name": "X-API-Key",
+            "in": "header"
+        },
+        "BearerAuth": {
+            "type": "apiKey",
+            "name": "Authorization",
+            "in": "header"
+        }
     }
 }`
 
@@ -1,35 +1,126 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+	// Tenant time zones must load in images without tzdata.
+	_ "time/tzdata"
 
 	_ "github.com/EternalQ/effective-mobile-test/docs"
+	"github.com/EternalQ/effective-mobile-test/migrations"
 
 	"github.com/EternalQ/effective-mobile-test/pkg/api"
+	"github.com/EternalQ/effective-mobile-test/pkg/auth"
 	"github.com/EternalQ/effective-mobile-test/pkg/db"
+	"github.com/EternalQ/effective-mobile-test/pkg/metrics"
+	"github.com/EternalQ/effective-mobile-test/pkg/ratelimit"
 	"github.com/EternalQ/effective-mobile-test/pkg/service"
+	"github.com/EternalQ/effective-mobile-test/pkg/tenant"
+	"github.com/EternalQ/effective-mobile-test/pkg/tracing"
 	"github.com/gorilla/mux"
 	"github.com/jmoiron/sqlx"
 	_ "github.com/lib/pq"
 	"github.com/rs/cors"
+	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 	httpSwagger "github.com/swaggo/http-swagger/v2"
 )
 
 var (
-	dbUser string
-	dbPass string
-	dbName string
-	dbHost string
-	logLvl int
+	dbDriver string
+	dbDSN    string
+	dbUser   string
+	dbPass   string
+	dbName   string
+	dbHost   string
+	logLvl   int
+
+	dbQueryTimeout time.Duration
+	autoMigrate    bool
+
+	httpAddr              string
+	httpReadTimeout       time.Duration
+	httpReadHeaderTimeout time.Duration
+	httpWriteTimeout      time.Duration
+	httpIdleTimeout       time.Duration
+	httpMaxHeaderBytes    int
+	httpShutdownTimeout   time.Duration
+
+	metricsAddr string
+
+	traceExporter    string
+	traceFile        string
+	traceSampleRatio float64
+	traceServiceName string
+
+	authEnabled     bool
+	apiBootstrapKey string
+
+	jwtSecret   string
+	jwtJWKSFile string
+	jwtIssuer   string
+	jwtAudience string
+	jwtLeeway   time.Duration
+
+	tenantsFile           string
+	tenantDefaultCurrency string
+	tenantDefaultTimeZone string
+
+	rateLimitRead  ratelimit.Config
+	rateLimitWrite ratelimit.Config
+	rateLimitCalc  ratelimit.Config
+	rateLimitAuth  ratelimit.Config
+
+	idempotencyTTL time.Duration
+
+	corsAllowedOrigins   []string
+	corsAllowedMethods   []string
+	corsAllowedHeaders   []string
+	corsAllowCredentials bool
+	corsMaxAge           time.Duration
 )
 
+// splitList splits a comma separated setting, dropping empty items.
+func splitList(s string) []string {
+	items := []string{}
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// newLimiter returns nil, leaving requests unlimited, for a non-positive
+// rate or burst.
+func newLimiter(cfg ratelimit.Config) *ratelimit.Limiter {
+	if cfg.Rate <= 0 || cfg.Burst <= 0 {
+		return nil
+	}
+	return ratelimit.New(cfg)
+}
+
 func readEnv() {
+	pflag.String("db-driver", "postgres", "Storage backend: postgres, sqlite or memory")
+	pflag.Parse()
+	_ = viper.BindPFlag("DB_DRIVER", pflag.Lookup("db-driver"))
+
 	viper.AutomaticEnv()
 
+	viper.SetDefault("DB_DRIVER", "postgres")
+	dbDriver = viper.GetString("DB_DRIVER")
+
+	viper.SetDefault("DB_DSN", "")
+	dbDSN = viper.GetString("DB_DSN")
+
 	viper.SetDefault("DB_USER", "admin")
 	dbUser = viper.GetString("DB_USER")
 
@@ -44,6 +135,112 @@ func readEnv() {
 
 	viper.SetDefault("LOG_LVL", -4)
 	logLvl = viper.GetInt("LOG_LVL")
+
+	viper.SetDefault("DB_QUERY_TIMEOUT", 5*time.Second)
+	dbQueryTimeout = viper.GetDuration("DB_QUERY_TIMEOUT")
+
+	viper.SetDefault("AUTO_MIGRATE", false)
+	autoMigrate = viper.GetBool("AUTO_MIGRATE")
+
+	viper.SetDefault("HTTP_ADDR", ":8080")
+	httpAddr = viper.GetString("HTTP_ADDR")
+
+	viper.SetDefault("HTTP_READ_TIMEOUT", 15*time.Second)
+	httpReadTimeout = viper.GetDuration("HTTP_READ_TIMEOUT")
+
+	viper.SetDefault("HTTP_READ_HEADER_TIMEOUT", 5*time.Second)
+	httpReadHeaderTimeout = viper.GetDuration("HTTP_READ_HEADER_TIMEOUT")
+
+	viper.SetDefault("HTTP_WRITE_TIMEOUT", 30*time.Second)
+	httpWriteTimeout = viper.GetDuration("HTTP_WRITE_TIMEOUT")
+
+	viper.SetDefault("HTTP_IDLE_TIMEOUT", 60*time.Second)
+	httpIdleTimeout = viper.GetDuration("HTTP_IDLE_TIMEOUT")
+
+	viper.SetDefault("HTTP_MAX_HEADER_BYTES", 1<<20)
+	httpMaxHeaderBytes = viper.GetInt("HTTP_MAX_HEADER_BYTES")
+
+	viper.SetDefault("HTTP_SHUTDOWN_TIMEOUT", 30*time.Second)
+	httpShutdownTimeout = viper.GetDuration("HTTP_SHUTDOWN_TIMEOUT")
+
+	viper.SetDefault("METRICS_ADDR", ":9090")
+	metricsAddr = viper.GetString("METRICS_ADDR")
+
+	viper.SetDefault("TRACE_EXPORTER", tracing.ExporterNone)
+	traceExporter = viper.GetString("TRACE_EXPORTER")
+
+	viper.SetDefault("TRACE_FILE", "")
+	traceFile = viper.GetString("TRACE_FILE")
+
+	viper.SetDefault("TRACE_SAMPLE_RATIO", 1.0)
+	traceSampleRatio = viper.GetFloat64("TRACE_SAMPLE_RATIO")
+
+	viper.SetDefault("TRACE_SERVICE_NAME", "effective-mobile-test")
+	traceServiceName = viper.GetString("TRACE_SERVICE_NAME")
+
+	viper.SetDefault("AUTH_ENABLED", true)
+	authEnabled = viper.GetBool("AUTH_ENABLED")
+
+	viper.SetDefault("API_BOOTSTRAP_KEY", "")
+	apiBootstrapKey = viper.GetString("API_BOOTSTRAP_KEY")
+
+	viper.SetDefault("JWT_HS256_SECRET", "")
+	jwtSecret = viper.GetString("JWT_HS256_SECRET")
+
+	viper.SetDefault("JWT_JWKS_FILE", "")
+	jwtJWKSFile = viper.GetString("JWT_JWKS_FILE")
+
+	viper.SetDefault("JWT_ISSUER", "")
+	jwtIssuer = viper.GetString("JWT_ISSUER")
+
+	viper.SetDefault("JWT_AUDIENCE", "")
+	jwtAudience = viper.GetString("JWT_AUDIENCE")
+
+	viper.SetDefault("JWT_LEEWAY", 30*time.Second)
+	jwtLeeway = viper.GetDuration("JWT_LEEWAY")
+
+	viper.SetDefault("TENANTS_FILE", "")
+	tenantsFile = viper.GetString("TENANTS_FILE")
+
+	viper.SetDefault("TENANT_DEFAULT_CURRENCY", "RUB")
+	tenantDefaultCurrency = viper.GetString("TENANT_DEFAULT_CURRENCY")
+
+	viper.SetDefault("TENANT_DEFAULT_TIME_ZONE", "UTC")
+	tenantDefaultTimeZone = viper.GetString("TENANT_DEFAULT_TIME_ZONE")
+
+	viper.SetDefault("RATE_LIMIT_READ_RATE", 10.0)
+	viper.SetDefault("RATE_LIMIT_READ_BURST", 50)
+	rateLimitRead = ratelimit.Config{Rate: viper.GetFloat64("RATE_LIMIT_READ_RATE"), Burst: viper.GetInt("RATE_LIMIT_READ_BURST")}
+
+	viper.SetDefault("RATE_LIMIT_WRITE_RATE", 2.0)
+	viper.SetDefault("RATE_LIMIT_WRITE_BURST", 20)
+	rateLimitWrite = ratelimit.Config{Rate: viper.GetFloat64("RATE_LIMIT_WRITE_RATE"), Burst: viper.GetInt("RATE_LIMIT_WRITE_BURST")}
+
+	viper.SetDefault("RATE_LIMIT_CALC_RATE", 0.5)
+	viper.SetDefault("RATE_LIMIT_CALC_BURST", 5)
+	rateLimitCalc = ratelimit.Config{Rate: viper.GetFloat64("RATE_LIMIT_CALC_RATE"), Burst: viper.GetInt("RATE_LIMIT_CALC_BURST")}
+
+	viper.SetDefault("RATE_LIMIT_AUTH_FAILURE_RATE", 0.1)
+	viper.SetDefault("RATE_LIMIT_AUTH_FAILURE_BURST", 10)
+	rateLimitAuth = ratelimit.Config{Rate: viper.GetFloat64("RATE_LIMIT_AUTH_FAILURE_RATE"), Burst: viper.GetInt("RATE_LIMIT_AUTH_FAILURE_BURST")}
+
+	viper.SetDefault("IDEMPOTENCY_TTL", 24*time.Hour)
+	idempotencyTTL = viper.GetDuration("IDEMPOTENCY_TTL")
+
+	viper.SetDefault("CORS_ALLOWED_ORIGINS", "")
+	corsAllowedOrigins = splitList(viper.GetString("CORS_ALLOWED_ORIGINS"))
+
+	viper.SetDefault("CORS_ALLOWED_METHODS", "GET,POST,PATCH,DELETE")
+	corsAllowedMethods = splitList(viper.GetString("CORS_ALLOWED_METHODS"))
+
+	viper.SetDefault("CORS_ALLOWED_HEADERS", "Content-Type,X-API-Key,X-Tenant-ID,X-Request-ID,Idempotency-Key,If-Match,If-Modified-Since,traceparent")
+	corsAllowedHeaders = splitList(viper.GetString("CORS_ALLOWED_HEADERS"))
+
+	viper.SetDefault("CORS_ALLOW_CREDENTIALS", false)
+	corsAllowCredentials = viper.GetBool("CORS_ALLOW_CREDENTIALS")
+
+	viper.SetDefault("CORS_MAX_AGE", 10*time.Minute)
+	corsMaxAge = viper.GetDuration("CORS_MAX_AGE")
 }
 
 // @title Effective Mobile Test API
@@ -51,6 +248,12 @@ func readEnv() {
 // @description This is a sample server for the Effective Mobile Test.
 // @host localhost:8080
 // @BasePath /api
+// @securityDefinitions.apikey ApiKeyAuth
+// @in header
+// @name X-API-Key
+// @securityDefinitions.apikey BearerAuth
+// @in header
+// @name Authorization
 func main() {
 	readEnv()
 
@@ -61,29 +264,257 @@ func main() {
 
 	log.Info("App started")
 
-	pgsStr := fmt.Sprintf("postgres://%s:%s@%s/%s?sslmode=disable", dbUser, dbPass, dbHost, dbName)
-	pgs, err := sqlx.Connect("postgres", pgsStr)
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Config{
+		ServiceName: traceServiceName,
+		Exporter:    traceExporter,
+		File:        traceFile,
+		SampleRatio: traceSampleRatio,
+	})
 	if err != nil {
-		log.Error("Can't connect to PostgreSQL, check .env")
-		os.Exit(0)
+		log.Error("Can't set up tracing, check TRACE_EXPORTER", slog.String("err", err.Error()))
+		os.Exit(1)
+	}
+	log.Info("Tracing set up", slog.String("exporter", traceExporter))
+
+	var (
+		subRepo  service.Repository
+		keyRepo  service.KeyRepository
+		idemRepo service.IdempotencyRepository
+		sqlDB    *sqlx.DB
+	)
+	switch dbDriver {
+	case "memory":
+		subRepo = db.NewMemoryRepo(log)
+		keyRepo = db.NewMemoryAPIKeyRepo(log)
+		idemRepo = db.NewMemoryIdempotencyRepo(log)
+		log.Info("Using in-memory storage, data is lost on restart")
+	case "sqlite":
+		if dbDSN == "" {
+			dbDSN = "effective.db"
+		}
+		sqlDB, err = db.ConnectSQLite(dbDSN)
+		if err != nil {
+			log.Error("Can't open SQLite database, check DB_DSN", slog.String("err", err.Error()))
+			os.Exit(1)
+		}
+		log.Info("SQLite opened", slog.String("dsn", dbDSN))
+
+		subRepo = db.NewSQLiteRepo(sqlDB, dbQueryTimeout, log)
+		keyRepo = db.NewAPIKeyRepo(sqlDB, dbQueryTimeout, log)
+		idemRepo = db.NewIdempotencyRepo(sqlDB, dbQueryTimeout, log)
+	case "postgres":
+		if dbDSN == "" {
+			dbDSN = fmt.Sprintf("postgres://%s:%s@%s/%s?sslmode=disable", dbUser, dbPass, dbHost, dbName)
+		}
+		sqlDB, err = sqlx.Connect("postgres", dbDSN)
+		if err != nil {
+			log.Error("Can't connect to PostgreSQL, check .env")
+			os.Exit(0)
+		}
+		log.Info("PostgreSQL connected")
+
+		subRepo = db.NewSubscriptionRepo(sqlDB, dbQueryTimeout, log)
+		keyRepo = db.NewAPIKeyRepo(sqlDB, dbQueryTimeout, log)
+		idemRepo = db.NewIdempotencyRepo(sqlDB, dbQueryTimeout, log)
+	default:
+		log.Error("Unknown DB_DRIVER, expected postgres, sqlite or memory", slog.String("driver", dbDriver))
+		os.Exit(1)
 	}
-	log.Info("PostgreSQL connected")
 
-	subRepo := db.NewSubscriptionRepo(pgs, log)
+	m := metrics.New(log)
+	subRepo = metrics.InstrumentRepository(subRepo, m)
+	if sqlDB != nil {
+		m.RegisterDB(sqlDB.DB, dbDriver)
+	}
+
+	if args := pflag.Args(); len(args) > 0 && args[0] == "migrate" {
+		if sqlDB == nil {
+			log.Error("Migrations need a SQL database", slog.String("driver", dbDriver))
+			os.Exit(1)
+		}
+		migrator, err := db.NewMigrator(sqlDB, migrations.ForDriver(dbDriver), log)
+		if err != nil {
+			log.Error("Can't read embedded migrations", slog.String("err", err.Error()))
+			os.Exit(1)
+		}
+		if err := runMigrate(context.Background(), migrator, args[1:]); err != nil {
+			log.Error("Migration failed", slog.String("err", err.Error()))
+			os.Exit(1)
+		}
+		return
+	}
+
+	if autoMigrate && sqlDB != nil {
+		migrator, err := db.NewMigrator(sqlDB, migrations.ForDriver(dbDriver), log)
+		if err != nil {
+			log.Error("Can't read embedded migrations", slog.String("err", err.Error()))
+			os.Exit(1)
+		}
+		if err := migrator.Up(context.Background()); err != nil {
+			log.Error("Migration failed", slog.String("err", err.Error()))
+			os.Exit(1)
+		}
+		log.Info("Migrations applied")
+	}
+
+	var listedTenants []*tenant.Tenant
+	if tenantsFile != "" {
+		listedTenants, err = tenant.LoadFile(tenantsFile)
+		if err != nil {
+			log.Error("Can't read TENANTS_FILE", slog.String("err", err.Error()))
+			os.Exit(1)
+		}
+	}
+	tenants, err := tenant.NewRegistry(tenant.Tenant{
+		Currency: tenantDefaultCurrency,
+		TimeZone: tenantDefaultTimeZone,
+	}, listedTenants)
+	if err != nil {
+		log.Error("Invalid tenant settings, check TENANT_*", slog.String("err", err.Error()))
+		os.Exit(1)
+	}
+	log.Info("Tenants loaded", slog.Int("listed", len(listedTenants)))
+
 	subServ := service.NewSubscriptionService(subRepo, log)
 	log.Info("Subscription service created")
 
+	m.RegisterSubscriptions(subServ.Recurring, tenants.All())
+
+	keyServ := service.NewAPIKeyService(keyRepo, log)
+	if apiBootstrapKey != "" {
+		if err := keyServ.Bootstrap(context.Background(), apiBootstrapKey); err != nil {
+			log.Error("Can't store API_BOOTSTRAP_KEY", slog.String("err", err.Error()))
+			os.Exit(1)
+		}
+	}
+
+	idemServ := service.NewIdempotencyService(idemRepo, idempotencyTTL, log)
+
 	router := mux.NewRouter()
+	middlewares := []mux.MiddlewareFunc{api.Tracing(), api.RequestLogger(log), api.RequestMetrics(m)}
+	router.Use(middlewares...)
+	api.HandleUnmatched(router, middlewares...)
 
-	c := cors.AllowAll()
-	router.Use(c.Handler)
+	apiRouter := api.StartServer(log, subServ, router)
+	api.StartKeys(log, keyServ, apiRouter)
+	api.StartTenant(log, apiRouter)
+	if authEnabled {
+		var verifier *auth.Verifier
+		if jwtSecret != "" || jwtJWKSFile != "" {
+			verifier, err = auth.NewVerifier(auth.JWTConfig{
+				Secret:   jwtSecret,
+				JWKSFile: jwtJWKSFile,
+				Issuer:   jwtIssuer,
+				Audience: jwtAudience,
+				Leeway:   jwtLeeway,
+			})
+			if err != nil {
+				log.Error("Can't set up JWT verification, check JWT_*", slog.String("err", err.Error()))
+				os.Exit(1)
+			}
+			log.Info("JWT bearer authentication enabled")
+		}
+		apiRouter.Use(api.LimitAuthFailures(log, newLimiter(rateLimitAuth)))
+		apiRouter.Use(api.Authenticate(log, keyServ, verifier))
+	} else {
+		log.Warn("API authentication is disabled")
+	}
+	apiRouter.Use(api.RateLimit(log, &api.RateLimits{
+		Read:  newLimiter(rateLimitRead),
+		Write: newLimiter(rateLimitWrite),
+		Calc:  newLimiter(rateLimitCalc),
+	}))
+	apiRouter.Use(api.Tenant(log, tenants))
+	apiRouter.Use(api.Idempotent(log, idemServ))
 
-	api.StartServer(log, subServ, router)
+	schemaVersion, err := migrations.Latest(migrations.ForDriver(dbDriver))
+	if err != nil {
+		log.Error("Can't read embedded migrations", slog.String("err", err.Error()))
+		os.Exit(1)
+	}
+	api.StartHealth(log, sqlDB, schemaVersion, router)
 
 	router.PathPrefix("/swagger/").Handler(httpSwagger.WrapHandler)
 
-	log.Info("Server started, listening on 8080")
-	if err := http.ListenAndServe(":8080", router); err != nil {
-		panic(err)
+	// CORS wraps the router so preflight requests don't need routes.
+	c := cors.New(cors.Options{
+		AllowedOrigins:   corsAllowedOrigins,
+		AllowedMethods:   corsAllowedMethods,
+		AllowedHeaders:   corsAllowedHeaders,
+		ExposedHeaders:   []string{api.RequestIDHeader, "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "RateLimit-Policy", "Retry-After", api.ReplayedHeader, "ETag"},
+		AllowCredentials: corsAllowCredentials,
+		MaxAge:           int(corsMaxAge.Seconds()),
+	})
+
+	srv := &http.Server{
+		Addr:              httpAddr,
+		Handler:           c.Handler(router),
+		ReadTimeout:       httpReadTimeout,
+		ReadHeaderTimeout: httpReadHeaderTimeout,
+		WriteTimeout:      httpWriteTimeout,
+		IdleTimeout:       httpIdleTimeout,
+		MaxHeaderBytes:    httpMaxHeaderBytes,
+		ErrorLog:          slog.NewLogLogger(logHandler, slog.LevelError),
+	}
+
+	// Metrics cover every tenant, they are served apart from the API so the
+	// address can stay internal.
+	var metricsSrv *http.Server
+	if metricsAddr != "" {
+		metricsRouter := mux.NewRouter()
+		metricsRouter.Handle("/metrics", m.Handler()).Methods("GET")
+		metricsSrv = &http.Server{
+			Addr:              metricsAddr,
+			Handler:           metricsRouter,
+			ReadHeaderTimeout: httpReadHeaderTimeout,
+			ErrorLog:          slog.NewLogLogger(logHandler, slog.LevelError),
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	go idemServ.RunPurge(ctx, time.Hour)
+
+	go func() {
+		log.Info("Server started", slog.String("addr", httpAddr))
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Error("Server stopped", slog.String("err", err.Error()))
+			stop()
+		}
+	}()
+
+	if metricsSrv != nil {
+		go func() {
+			log.Info("Metrics server started", slog.String("addr", metricsAddr))
+			if err := metricsSrv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Error("Metrics server stopped", slog.String("err", err.Error()))
+				stop()
+			}
+		}()
+	}
+
+	<-ctx.Done()
+	log.Info("Shutting down, draining requests", slog.Duration("timeout", httpShutdownTimeout))
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), httpShutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Error("Error while shutting down server", slog.String("err", err.Error()))
+	}
+	if metricsSrv != nil {
+		if err := metricsSrv.Shutdown(shutdownCtx); err != nil {
+			log.Error("Error while shutting down metrics server", slog.String("err", err.Error()))
+		}
+	}
+
+	if sqlDB != nil {
+		if err := sqlDB.Close(); err != nil {
+			log.Error("Error while closing database connections", slog.String("err", err.Error()))
+		}
+	}
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		log.Error("Error while flushing traces", slog.String("err", err.Error()))
 	}
+	log.Info("App stopped")
 }
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/EternalQ/effective-mobile-test/pkg/db"
+)
+
+var errUsage = errors.New("usage: app migrate up|down|status")
+
+// runMigrate handles the `migrate up|down|status` subcommand.
+func runMigrate(ctx context.Context, m *db.Migrator, args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+
+	switch args[0] {
+	case "up":
+		return m.Up(ctx)
+	case "down":
+		return m.Down(ctx)
+	case "status":
+		status, err := m.Status(ctx)
+		if err != nil {
+			return err
+		}
+
+		pending := make([]string, 0, len(status.Pending))
+		for _, mg := range status.Pending {
+			pending = append(pending, fmt.Sprintf("%06d_%s", mg.Version, mg.Name))
+		}
+		if len(pending) == 0 {
+			pending = append(pending, "none")
+		}
+
+		fmt.Fprintf(os.Stdout, "version: %d\ndirty:   %t\nlatest:  %d\npending: %s\n",
+			status.Version, status.Dirty, status.Latest, strings.Join(pending, ", "))
+		return nil
+	default:
+		return errUsage
+	}
+}
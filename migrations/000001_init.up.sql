@@ -1,4 +1,4 @@
-CREATE TABLE subscriptions (
+CREATE TABLE IF NOT EXISTS subscriptions (
     id SERIAL PRIMARY KEY,
     service_name VARCHAR NOT NULL,
     price INT NOT NULL CHECK (price > 0),
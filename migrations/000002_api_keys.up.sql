@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS api_keys (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR NOT NULL,
+    prefix VARCHAR NOT NULL,
+    key_hash VARCHAR NOT NULL UNIQUE,
+    scopes VARCHAR NOT NULL,
+    -- User non-admin keys act for, empty for admin keys.
+    user_id VARCHAR NOT NULL DEFAULT '',
+    -- Tenant non-admin keys act for, admin keys may pick any.
+    tenant_id VARCHAR NOT NULL DEFAULT 'default',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    revoked_at TIMESTAMPTZ
+);
@@ -0,0 +1,8 @@
+DROP POLICY IF EXISTS subscriptions_tenant_isolation ON subscriptions;
+ALTER TABLE subscriptions NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE subscriptions DISABLE ROW LEVEL SECURITY;
+
+DROP INDEX IF EXISTS subscriptions_calc_idx;
+CREATE INDEX IF NOT EXISTS subscriptions_calc_idx ON subscriptions (user_id, service_name);
+
+ALTER TABLE subscriptions DROP COLUMN IF EXISTS tenant_id;
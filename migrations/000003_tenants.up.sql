@@ -0,0 +1,13 @@
+ALTER TABLE subscriptions ADD COLUMN IF NOT EXISTS tenant_id VARCHAR NOT NULL DEFAULT 'default';
+
+DROP INDEX IF EXISTS subscriptions_calc_idx;
+CREATE INDEX IF NOT EXISTS subscriptions_calc_idx ON subscriptions (tenant_id, user_id, service_name);
+
+-- Queries of the service set app.tenant_id for their transaction. FORCE
+-- applies the policy to the table owner as well, superusers still bypass it.
+ALTER TABLE subscriptions ENABLE ROW LEVEL SECURITY;
+ALTER TABLE subscriptions FORCE ROW LEVEL SECURITY;
+
+CREATE POLICY subscriptions_tenant_isolation ON subscriptions
+    USING (tenant_id = current_setting('app.tenant_id', true))
+    WITH CHECK (tenant_id = current_setting('app.tenant_id', true));
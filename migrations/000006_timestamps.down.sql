@@ -0,0 +1,8 @@
+DROP TRIGGER IF EXISTS subscriptions_touch ON subscriptions;
+DROP FUNCTION IF EXISTS subscriptions_touch();
+
+DROP INDEX IF EXISTS subscriptions_updated_idx;
+
+ALTER TABLE subscriptions
+    DROP COLUMN IF EXISTS created_at,
+    DROP COLUMN IF EXISTS updated_at;
@@ -0,0 +1,15 @@
+ALTER TABLE subscriptions
+    ADD COLUMN IF NOT EXISTS created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    ADD COLUMN IF NOT EXISTS updated_at TIMESTAMPTZ NOT NULL DEFAULT now();
+
+CREATE INDEX IF NOT EXISTS subscriptions_updated_idx ON subscriptions (tenant_id, updated_at);
+
+CREATE OR REPLACE FUNCTION subscriptions_touch() RETURNS trigger AS $$
+BEGIN
+    NEW.updated_at = now();
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER subscriptions_touch BEFORE UPDATE ON subscriptions
+    FOR EACH ROW EXECUTE FUNCTION subscriptions_touch();
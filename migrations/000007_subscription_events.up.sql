@@ -0,0 +1,30 @@
+-- Events outlive their subscriptions, there is no foreign key.
+CREATE TABLE IF NOT EXISTS subscription_events (
+    id BIGSERIAL PRIMARY KEY,
+    tenant_id VARCHAR NOT NULL,
+    subscription_id INT NOT NULL,
+    action VARCHAR NOT NULL,
+    actor VARCHAR NOT NULL,
+    request_id VARCHAR NOT NULL,
+    before JSONB,
+    after JSONB,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS subscription_events_subscription_idx ON subscription_events (tenant_id, subscription_id);
+
+CREATE OR REPLACE FUNCTION subscription_events_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'subscription_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER subscription_events_append_only BEFORE UPDATE OR DELETE ON subscription_events
+    FOR EACH ROW EXECUTE FUNCTION subscription_events_append_only();
+
+ALTER TABLE subscription_events ENABLE ROW LEVEL SECURITY;
+ALTER TABLE subscription_events FORCE ROW LEVEL SECURITY;
+
+CREATE POLICY subscription_events_tenant_isolation ON subscription_events
+    USING (tenant_id = current_setting('app.tenant_id', true))
+    WITH CHECK (tenant_id = current_setting('app.tenant_id', true));
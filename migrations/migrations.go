@@ -0,0 +1,46 @@
+// Package migrations embeds the SQL migrations of the service. Postgres
+// migrations live in the package root, SQLite ones in the sqlite directory.
+package migrations
+
+import (
+	"embed"
+	"io/fs"
+	"strconv"
+	"strings"
+)
+
+//go:embed *.sql
+var FS embed.FS
+
+//go:embed sqlite/*.sql
+var sqliteFS embed.FS
+
+// SQLite holds migrations of the SQLite storage.
+var SQLite, _ = fs.Sub(sqliteFS, "sqlite")
+
+// ForDriver returns migrations of the given database/sql driver.
+func ForDriver(driver string) fs.FS {
+	if driver == "sqlite" {
+		return SQLite
+	}
+	return FS
+}
+
+// Latest returns the highest migration version found in fsys.
+func Latest(fsys fs.FS) (uint, error) {
+	files, err := fs.Glob(fsys, "*.up.sql")
+	if err != nil {
+		return 0, err
+	}
+
+	var latest uint
+	for _, f := range files {
+		prefix, _, _ := strings.Cut(f, "_")
+		v, err := strconv.ParseUint(prefix, 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		latest = max(latest, uint(v))
+	}
+	return latest, nil
+}
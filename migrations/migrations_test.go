@@ -0,0 +1,20 @@
+package migrations_test
+
+import (
+	"testing"
+
+	"github.com/EternalQ/effective-mobile-test/migrations"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLatest(t *testing.T) {
+	pg, err := migrations.Latest(migrations.FS)
+	assert.Nil(t, err)
+	assert.GreaterOrEqual(t, pg, uint(1))
+
+	sqlite, err := migrations.Latest(migrations.SQLite)
+	assert.Nil(t, err)
+	assert.GreaterOrEqual(t, sqlite, uint(1))
+
+	assert.Equal(t, pg, sqlite, "every migration needs a SQLite counterpart")
+}
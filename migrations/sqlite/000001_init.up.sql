@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS subscriptions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    service_name TEXT NOT NULL,
+    price INTEGER NOT NULL CONSTRAINT subscriptions_price_check CHECK (price > 0),
+    user_id TEXT NOT NULL,
+    start_date TIMESTAMP NOT NULL,
+    end_date TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS subscriptions_calc_idx ON subscriptions (user_id, service_name);
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS api_keys (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL,
+    prefix TEXT NOT NULL,
+    key_hash TEXT NOT NULL UNIQUE,
+    scopes TEXT NOT NULL,
+    -- User non-admin keys act for, empty for admin keys.
+    user_id TEXT NOT NULL DEFAULT '',
+    -- Tenant non-admin keys act for, admin keys may pick any.
+    tenant_id TEXT NOT NULL DEFAULT 'default',
+    created_at TIMESTAMP NOT NULL,
+    revoked_at TIMESTAMP
+);
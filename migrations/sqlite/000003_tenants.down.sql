@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS subscriptions_calc_idx;
+CREATE INDEX IF NOT EXISTS subscriptions_calc_idx ON subscriptions (user_id, service_name);
+
+ALTER TABLE subscriptions DROP COLUMN tenant_id;
@@ -0,0 +1,4 @@
+ALTER TABLE subscriptions ADD COLUMN tenant_id TEXT NOT NULL DEFAULT 'default';
+
+DROP INDEX IF EXISTS subscriptions_calc_idx;
+CREATE INDEX IF NOT EXISTS subscriptions_calc_idx ON subscriptions (tenant_id, user_id, service_name);
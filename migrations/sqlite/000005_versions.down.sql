@@ -0,0 +1 @@
+ALTER TABLE subscriptions DROP COLUMN version;
\ No newline at end of file
@@ -0,0 +1,5 @@
+DROP TRIGGER IF EXISTS subscriptions_touch;
+DROP INDEX IF EXISTS subscriptions_updated_idx;
+
+ALTER TABLE subscriptions DROP COLUMN created_at;
+ALTER TABLE subscriptions DROP COLUMN updated_at;
@@ -0,0 +1,34 @@
+-- SQLite can't add columns with a non-constant default, the table is
+-- rebuilt. Timestamps are written in the format of the driver, so they
+-- compare as text with bound times.
+CREATE TABLE subscriptions_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    service_name TEXT NOT NULL,
+    price INTEGER NOT NULL CONSTRAINT subscriptions_price_check CHECK (price > 0),
+    user_id TEXT NOT NULL,
+    start_date TIMESTAMP NOT NULL,
+    end_date TIMESTAMP,
+    tenant_id TEXT NOT NULL DEFAULT 'default',
+    version INTEGER NOT NULL DEFAULT 1,
+    created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+    updated_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now'))
+);
+
+INSERT INTO subscriptions_new (id, service_name, price, user_id, start_date, end_date, tenant_id, version)
+SELECT id, service_name, price, user_id, start_date, end_date, tenant_id, version FROM subscriptions;
+
+-- Keep the id sequence, ids of deleted subscriptions are not reused.
+DELETE FROM sqlite_sequence WHERE name = 'subscriptions_new';
+UPDATE sqlite_sequence SET name = 'subscriptions_new' WHERE name = 'subscriptions';
+
+DROP TABLE subscriptions;
+ALTER TABLE subscriptions_new RENAME TO subscriptions;
+
+CREATE INDEX IF NOT EXISTS subscriptions_calc_idx ON subscriptions (tenant_id, user_id, service_name);
+CREATE INDEX IF NOT EXISTS subscriptions_updated_idx ON subscriptions (tenant_id, updated_at);
+
+CREATE TRIGGER subscriptions_touch AFTER UPDATE ON subscriptions
+FOR EACH ROW
+BEGIN
+    UPDATE subscriptions SET updated_at = strftime('%Y-%m-%d %H:%M:%f+00:00', 'now') WHERE id = NEW.id;
+END;
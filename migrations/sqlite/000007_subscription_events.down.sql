@@ -0,0 +1 @@
+DROP TABLE IF EXISTS subscription_events;
\ No newline at end of file
@@ -0,0 +1,24 @@
+-- Events outlive their subscriptions, there is no foreign key.
+CREATE TABLE IF NOT EXISTS subscription_events (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    tenant_id TEXT NOT NULL,
+    subscription_id INTEGER NOT NULL,
+    action TEXT NOT NULL,
+    actor TEXT NOT NULL,
+    request_id TEXT NOT NULL,
+    before TEXT,
+    after TEXT,
+    created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now'))
+);
+
+CREATE INDEX IF NOT EXISTS subscription_events_subscription_idx ON subscription_events (tenant_id, subscription_id);
+
+CREATE TRIGGER subscription_events_no_update BEFORE UPDATE ON subscription_events
+BEGIN
+    SELECT RAISE(ABORT, 'subscription_events is append-only');
+END;
+
+CREATE TRIGGER subscription_events_no_delete BEFORE DELETE ON subscription_events
+BEGIN
+    SELECT RAISE(ABORT, 'subscription_events is append-only');
+END;
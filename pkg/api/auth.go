@@ -0,0 +1,216 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/EternalQ/effective-mobile-test/pkg/auth"
+	"github.com/EternalQ/effective-mobile-test/pkg/db"
+	"github.com/EternalQ/effective-mobile-test/pkg/logctx"
+	"github.com/EternalQ/effective-mobile-test/pkg/models"
+	"github.com/EternalQ/effective-mobile-test/pkg/service"
+	"github.com/gorilla/mux"
+)
+
+const APIKeyHeader = "X-API-Key"
+
+// readRoutes are POST routes that only read data.
+var readRoutes = []string{"/api/subscriptions/calc", "/api/subscriptions/calc/breakdown"}
+
+// requiredScope returns the scope a request needs: admin for key
+// management, read for GET and calculations, write for anything else.
+func requiredScope(r *http.Request) models.Scope {
+	route := routeTemplate(r)
+	switch {
+	case strings.HasPrefix(route, "/api/keys"):
+		return models.ScopeAdmin
+	case r.Method == http.MethodGet, r.Method == http.MethodHead:
+		return models.ScopeRead
+	}
+	for _, read := range readRoutes {
+		if route == read {
+			return models.ScopeRead
+		}
+	}
+	return models.ScopeWrite
+}
+
+// Authenticate authenticates requests by a bearer token in the
+// Authorization header or by the X-API-Key header, and checks the caller has
+// the scope the route needs. Bearer tokens are rejected when verifier is nil.
+// The caller is stored in the request context.
+func Authenticate(log *slog.Logger, keys *service.APIKeyService, verifier *auth.Verifier) mux.MiddlewareFunc {
+	log = log.With(slog.String("where", "api/Authenticate"))
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			reqLog := logctx.From(r.Context(), log, "api/Authenticate")
+
+			var (
+				principal *auth.Principal
+				err       error
+			)
+			if token, ok := bearerToken(r); ok {
+				if verifier == nil {
+					err = auth.ErrInvalidToken
+				} else {
+					principal, err = verifier.Verify(token)
+				}
+			} else if key := r.Header.Get(APIKeyHeader); key != "" {
+				principal, err = keys.Authenticate(r.Context(), key)
+			} else {
+				err = errMissingKey
+			}
+			if err != nil {
+				respondError(reqLog, w, r, err)
+				return
+			}
+
+			reqLog = reqLog.With(slog.Int("key_id", principal.KeyId), slog.String("subject", principal.Subject))
+			if !principal.Scopes.Allows(requiredScope(r)) {
+				respondError(reqLog, w, r, errForbidden)
+				return
+			}
+
+			reqLog.Debug("Request authenticated", slog.String("name", principal.Name))
+			next.ServeHTTP(w, r.WithContext(auth.WithPrincipal(r.Context(), principal)))
+		})
+	}
+}
+
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	return strings.TrimSpace(token), true
+}
+
+type KeyServer struct {
+	log     *slog.Logger
+	keyServ *service.APIKeyService
+}
+
+// StartKeys registers API key management routes on the /api subrouter.
+func StartKeys(log *slog.Logger, keyServ *service.APIKeyService, api *mux.Router) {
+	s := &KeyServer{
+		log.With(slog.String("where", "api/KeyServer")),
+		keyServ,
+	}
+
+	api.HandleFunc("/keys", s.createKey).Methods("POST")
+	api.HandleFunc("/keys", s.listKeys).Methods("GET")
+	api.HandleFunc("/keys/{id}", s.revokeKey).Methods("DELETE")
+}
+
+func (s *KeyServer) logger(r *http.Request) *slog.Logger {
+	return logctx.From(r.Context(), s.log, "api/KeyServer")
+}
+
+// @Summary Create an API key
+// @Description Creates an API key with the given scopes. Scopes are ordered, `admin` includes `write`, `write` includes `read`. Keys without `admin` act for the user in `user_id` and only access that user's subscriptions. The key is returned only once.
+// @Tags keys
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Param key body models.NewAPIKey true "Key name, scopes and user"
+// @Success 201 {object} models.CreatedAPIKey "Created key"
+// @Failure 400 {object} Problem "Invalid input"
+// @Failure 401 {object} Problem "Missing or invalid credentials"
+// @Failure 429 {object} Problem "Too many requests"
+// @Failure 403 {object} Problem "API key is not admin"
+// @Failure 500 {object} Problem "Internal error"
+// @Router /keys [post]
+func (s *KeyServer) createKey(w http.ResponseWriter, r *http.Request) {
+	log := s.logger(r)
+	log.Info("Handling POST request to /api/keys")
+
+	var req *models.NewAPIKey
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(log, w, r, err)
+		return
+	}
+	if req == nil {
+		req = &models.NewAPIKey{}
+	}
+
+	key, err := s.keyServ.Create(r.Context(), req)
+	if err != nil {
+		respondError(log, w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(key); err != nil {
+		log.Error("failed to encode response", slog.String("err", err.Error()))
+	}
+}
+
+// @Summary List API keys
+// @Description Lists every API key of the tenant, including revoked ones. Keys themselves are never returned.
+// @Tags keys
+// @Produce json
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Success 200 {array} models.APIKey "API keys"
+// @Failure 401 {object} Problem "Missing or invalid credentials"
+// @Failure 429 {object} Problem "Too many requests"
+// @Failure 403 {object} Problem "API key is not admin"
+// @Failure 500 {object} Problem "Internal error"
+// @Router /keys [get]
+func (s *KeyServer) listKeys(w http.ResponseWriter, r *http.Request) {
+	log := s.logger(r)
+	log.Info("Handling GET request to /api/keys")
+
+	keys, err := s.keyServ.List(r.Context())
+	if err != nil {
+		respondError(log, w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(keys); err != nil {
+		log.Error("failed to encode response", slog.String("err", err.Error()))
+	}
+}
+
+// @Summary Revoke an API key
+// @Description Revokes an API key of the tenant by ID. Requests with a revoked key are rejected.
+// @Tags keys
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Param id path int true "API key ID"
+// @Success 204 {string} string "API key revoked"
+// @Failure 400 {object} Problem "Invalid input"
+// @Failure 401 {object} Problem "Missing or invalid credentials"
+// @Failure 429 {object} Problem "Too many requests"
+// @Failure 403 {object} Problem "API key is not admin"
+// @Failure 404 {object} Problem "API key not found in the tenant"
+// @Failure 500 {object} Problem "Internal error"
+// @Router /keys/{id} [delete]
+func (s *KeyServer) revokeKey(w http.ResponseWriter, r *http.Request) {
+	log := s.logger(r)
+	log.Info("Handling DELETE request to /api/keys/{id}")
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		respondError(log, w, r, errInvalidId)
+		return
+	}
+
+	if err := s.keyServ.Revoke(r.Context(), id); err != nil {
+		if errors.Is(err, db.ErrNotFound) {
+			err = errKeyNotFound
+		}
+		respondError(log, w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
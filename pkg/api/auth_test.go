@@ -0,0 +1,116 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/EternalQ/effective-mobile-test/pkg/models"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAPIKeyAuth(t *testing.T) {
+	ts := newTestServer(t, testOptions{auth: true})
+	reader, writer, admin := ts.newKey(t.Context(), "read"), ts.newKey(t.Context(), "write"), ts.newKey(t.Context(), "admin")
+
+	do := func(method, path, key, body string) *httptest.ResponseRecorder {
+		return ts.do(method, path, body, APIKeyHeader, key)
+	}
+
+	t.Run("missing key", func(t *testing.T) {
+		w := do(http.MethodGet, "/api/subscriptions", "", "")
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.NotEmpty(t, w.Header().Get("WWW-Authenticate"))
+		assert.Equal(t, CodeUnauthorized, problemOf(t, w).Code)
+	})
+
+	t.Run("unknown key", func(t *testing.T) {
+		w := do(http.MethodGet, "/api/subscriptions", "emk_nope", "")
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("scopes", func(t *testing.T) {
+		tests := []struct {
+			name   string
+			method string
+			path   string
+			key    string
+			body   string
+			want   int
+		}{
+			{"read lists", http.MethodGet, "/api/subscriptions", reader, "", http.StatusOK},
+			{"read calculates", http.MethodPost, "/api/subscriptions/calc", reader, `{"service_name":"Yandex Plus"}`, http.StatusOK},
+			{"read can't create", http.MethodPost, "/api/subscriptions", reader, newSub, http.StatusForbidden},
+			{"write creates", http.MethodPost, "/api/subscriptions", writer, newSub, http.StatusCreated},
+			{"write lists", http.MethodGet, "/api/subscriptions", writer, "", http.StatusOK},
+			{"write can't manage keys", http.MethodGet, "/api/keys", writer, "", http.StatusForbidden},
+			{"admin manages keys", http.MethodGet, "/api/keys", admin, "", http.StatusOK},
+			{"admin creates", http.MethodPost, "/api/subscriptions", admin, newSub, http.StatusCreated},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				w := do(tt.method, tt.path, tt.key, tt.body)
+				assert.Equal(t, tt.want, w.Code, w.Body.String())
+			})
+		}
+	})
+
+	t.Run("key management", func(t *testing.T) {
+		w := do(http.MethodPost, "/api/keys", admin, `{"name":"export","scopes":["read"]}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code, "non-admin keys need a user")
+
+		w = do(http.MethodPost, "/api/keys", admin, `{"name":"export","scopes":["read"],"user_id":"`+testUser+`"}`)
+		require.Equal(t, http.StatusCreated, w.Code)
+		var created models.CreatedAPIKey
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&created))
+		assert.True(t, strings.HasPrefix(created.Key, created.Prefix))
+		assert.Equal(t, http.StatusOK, do(http.MethodGet, "/api/subscriptions", created.Key, "").Code)
+
+		w = do(http.MethodGet, "/api/keys", admin, "")
+		assert.NotContains(t, w.Body.String(), created.Key)
+
+		w = do(http.MethodPost, "/api/keys", admin, `{"name":"export","scopes":["root"]}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+
+		path := "/api/keys/" + strconv.Itoa(created.Id)
+		assert.Equal(t, http.StatusNoContent, do(http.MethodDelete, path, admin, "").Code)
+		assert.Equal(t, http.StatusUnauthorized, do(http.MethodGet, "/api/subscriptions", created.Key, "").Code)
+
+		w = do(http.MethodDelete, "/api/keys/100", admin, "")
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
+
+func TestAuthenticate_Bearer(t *testing.T) {
+	ts := newTestServer(t, testOptions{auth: true, bearer: true})
+
+	userA, userB := testUser, "2b8e5a3c-9d4f-4c1e-8a7b-6f5d4e3c2b1a"
+	tokenA, tokenB := newToken(t, jwt.MapClaims{"sub": userA}), newToken(t, jwt.MapClaims{"sub": userB})
+
+	do := func(method, path, bearer, body string) *httptest.ResponseRecorder {
+		return ts.do(method, path, body, "Authorization", "Bearer "+bearer)
+	}
+
+	w := do(http.MethodPost, "/api/subscriptions", tokenB, `{"service_name":"Kinopoisk","price":300,"user_id":"`+userB+`","start_date":"07-2025"}`)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+
+	w = do(http.MethodPost, "/api/subscriptions", tokenA, `{"service_name":"Kinopoisk","price":300,"user_id":"`+userB+`","start_date":"07-2025"}`)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = do(http.MethodGet, "/api/subscriptions/1", tokenA, "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = do(http.MethodGet, "/api/subscriptions", tokenA, "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var page models.SubscriptionPage
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&page))
+	assert.Equal(t, 0, page.Total)
+
+	w = do(http.MethodGet, "/api/subscriptions", "not-a-token", "")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
@@ -0,0 +1,123 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/EternalQ/effective-mobile-test/pkg/db"
+	"github.com/EternalQ/effective-mobile-test/pkg/models"
+)
+
+const IfMatchHeader = "If-Match"
+
+var (
+	errInvalidIfMatch  = &models.FieldError{Field: IfMatchHeader, Message: `must be a list of ETags of the subscription or "*"`}
+	errIfMatchRequired = errors.New("If-Match is required")
+)
+
+// etag returns the strong entity tag of a subscription version.
+func etag(version int) string {
+	return `"` + strconv.Itoa(version) + `"`
+}
+
+// lastModified returns the Last-Modified value of a change time, HTTP dates
+// have whole seconds.
+func lastModified(t time.Time) time.Time {
+	return t.UTC().Truncate(time.Second)
+}
+
+// notModified reports whether If-Modified-Since of r is at or after
+// modified. Invalid dates are ignored.
+func notModified(r *http.Request, modified time.Time) bool {
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	return !lastModified(modified).After(since)
+}
+
+// checkModified sets Last-Modified to modified and answers 304 when
+// If-Modified-Since of r is at or after it. It reports whether the response
+// is written.
+func checkModified(w http.ResponseWriter, r *http.Request, modified time.Time) bool {
+	w.Header().Set("Last-Modified", lastModified(modified).Format(http.TimeFormat))
+	if !notModified(r, modified) {
+		return false
+	}
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+// latestUpdate returns the last change of subs, zero when there are none.
+func latestUpdate(subs []*models.Subscription) time.Time {
+	var latest time.Time
+	for _, sub := range subs {
+		if sub.UpdatedAt.After(latest) {
+			latest = sub.UpdatedAt
+		}
+	}
+	return latest
+}
+
+// ifMatch returns the versions listed in If-Match, nil when any version may
+// be replaced. If-Match compares tags strongly, so weak tags never match.
+// Changes without If-Match are rejected, they would overwrite changes the
+// client has not seen.
+func ifMatch(r *http.Request) ([]int, error) {
+	value := strings.TrimSpace(r.Header.Get(IfMatchHeader))
+	switch value {
+	case "":
+		return nil, errIfMatchRequired
+	case "*":
+		return nil, nil
+	}
+
+	versions := []int{}
+	for _, tag := range strings.Split(value, ",") {
+		tag = strings.TrimSpace(tag)
+		weak := strings.HasPrefix(tag, "W/")
+		tag, opened := strings.CutPrefix(strings.TrimPrefix(tag, "W/"), `"`)
+		tag, closed := strings.CutSuffix(tag, `"`)
+		if !opened || !closed {
+			return nil, errInvalidIfMatch
+		}
+		version, err := strconv.Atoi(tag)
+		if err != nil || version <= 0 {
+			return nil, errInvalidIfMatch
+		}
+		if !weak {
+			versions = append(versions, version)
+		}
+	}
+	return versions, nil
+}
+
+// matchVersion returns the version of subscription id to replace for
+// If-Match of r, zero for any. Out of several listed versions the current
+// one is picked, the repository still checks it did not change since.
+func (s *Server) matchVersion(r *http.Request, id int) (int, error) {
+	versions, err := ifMatch(r)
+	switch {
+	case err != nil:
+		return 0, err
+	case versions == nil:
+		return 0, nil
+	case len(versions) == 0:
+		return 0, db.ErrVersionMismatch
+	case len(versions) == 1:
+		return versions[0], nil
+	}
+
+	sub, err := s.subsServ.Read(r.Context(), id)
+	if err != nil {
+		return 0, err
+	}
+	if !slices.Contains(versions, sub.Version) {
+		return 0, db.ErrVersionMismatch
+	}
+	return sub.Version, nil
+}
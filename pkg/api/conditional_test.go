@@ -0,0 +1,108 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/EternalQ/effective-mobile-test/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestETag(t *testing.T) {
+	ts := newTestServer(t, testOptions{})
+
+	do := func(method, path, ifMatch, body string) *httptest.ResponseRecorder {
+		return ts.do(method, path, body, IfMatchHeader, ifMatch)
+	}
+
+	require.Equal(t, http.StatusCreated, do(http.MethodPost, "/api/subscriptions", "", newSub).Code)
+
+	w := do(http.MethodGet, "/api/subscriptions/1", "", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `"1"`, w.Header().Get("ETag"))
+
+	w = do(http.MethodPatch, "/api/subscriptions/1", `"1"`, `{"price":500}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `"2"`, w.Header().Get("ETag"))
+
+	w = do(http.MethodPatch, "/api/subscriptions/1", `"1"`, `{"price":600}`)
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+	assert.Equal(t, CodePrecondition, problemOf(t, w).Code)
+
+	w = do(http.MethodPatch, "/api/subscriptions/1", "*", `{"price":600,"version":1}`)
+	require.Equal(t, http.StatusOK, w.Code, "the version in the body is ignored")
+	assert.Equal(t, `"3"`, w.Header().Get("ETag"))
+
+	w = do(http.MethodPatch, "/api/subscriptions/1", "", `{"price":700}`)
+	assert.Equal(t, http.StatusPreconditionRequired, w.Code)
+	assert.Equal(t, CodePreconditionRequired, problemOf(t, w).Code)
+	assert.Equal(t, http.StatusPreconditionRequired, do(http.MethodDelete, "/api/subscriptions/1", "", "").Code)
+
+	for _, tag := range []string{`"3`, `3"`, `W/3"`, `3`, `"3", 3"`} {
+		w = do(http.MethodDelete, "/api/subscriptions/1", tag, "")
+		assert.Equal(t, http.StatusBadRequest, w.Code, "%s is malformed", tag)
+		assert.Equal(t, IfMatchHeader, problemOf(t, w).Errors[0].Field)
+	}
+
+	assert.Equal(t, http.StatusPreconditionFailed, do(http.MethodDelete, "/api/subscriptions/1", `W/"3"`, "").Code, "weak tags never match")
+	assert.Equal(t, http.StatusPreconditionFailed, do(http.MethodDelete, "/api/subscriptions/1", `"1", "2"`, "").Code)
+
+	w = do(http.MethodPatch, "/api/subscriptions/1", `"2", W/"3", "3"`, `{"price":700}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `"4"`, w.Header().Get("ETag"))
+
+	assert.Equal(t, http.StatusNoContent, do(http.MethodDelete, "/api/subscriptions/1", `"4"`, "").Code)
+}
+
+func TestLastModified(t *testing.T) {
+	ts := newTestServer(t, testOptions{})
+
+	do := func(method, path, since, body string) *httptest.ResponseRecorder {
+		return ts.do(method, path, body, "If-Modified-Since", since)
+	}
+
+	require.Equal(t, http.StatusCreated, do(http.MethodPost, "/api/subscriptions", "", newSub).Code)
+
+	w := do(http.MethodGet, "/api/subscriptions/1", "", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	modified := w.Header().Get("Last-Modified")
+	at, err := http.ParseTime(modified)
+	require.NoError(t, err)
+
+	w = do(http.MethodGet, "/api/subscriptions/1", modified, "")
+	assert.Equal(t, http.StatusNotModified, w.Code)
+	assert.Empty(t, w.Body.String())
+	assert.Equal(t, `"1"`, w.Header().Get("ETag"))
+
+	earlier := at.Add(-time.Second).Format(http.TimeFormat)
+	assert.Equal(t, http.StatusOK, do(http.MethodGet, "/api/subscriptions/1", earlier, "").Code)
+	assert.Equal(t, http.StatusOK, do(http.MethodGet, "/api/subscriptions/1", "yesterday", "").Code, "invalid dates are ignored")
+
+	w = do(http.MethodGet, "/api/subscriptions", "", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, modified, w.Header().Get("Last-Modified"), "pages are modified with their latest subscription")
+	assert.Equal(t, http.StatusNotModified, do(http.MethodGet, "/api/subscriptions", modified, "").Code)
+	assert.Equal(t, http.StatusOK, do(http.MethodGet, "/api/subscriptions", earlier, "").Code)
+
+	w = do(http.MethodGet, "/api/subscriptions/1/history", "", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	recorded := w.Header().Get("Last-Modified")
+	last, err := http.ParseTime(recorded)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusNotModified, do(http.MethodGet, "/api/subscriptions/1/history", recorded, "").Code)
+	assert.Equal(t, http.StatusOK, do(http.MethodGet, "/api/subscriptions/1/history", last.Add(-time.Second).Format(http.TimeFormat), "").Code)
+
+	w = do(http.MethodGet, "/api/subscriptions?updated_since="+url.QueryEscape(at.Add(time.Hour).Format(time.RFC3339)), "", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get("Last-Modified"), "empty pages have no Last-Modified")
+	var page models.SubscriptionPage
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&page))
+	assert.Zero(t, page.Total)
+
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodGet, "/api/subscriptions?updated_since=07-2025", "", "").Code)
+}
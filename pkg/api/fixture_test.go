@@ -0,0 +1,138 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/EternalQ/effective-mobile-test/pkg/auth"
+	"github.com/EternalQ/effective-mobile-test/pkg/db"
+	"github.com/EternalQ/effective-mobile-test/pkg/models"
+	"github.com/EternalQ/effective-mobile-test/pkg/ratelimit"
+	"github.com/EternalQ/effective-mobile-test/pkg/service"
+	"github.com/EternalQ/effective-mobile-test/pkg/tenant"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testUser   = "60601fee-2bf1-4721-ae6f-7636e79a0cba"
+	testSecret = "test-secret"
+
+	// newSub is a valid subscription of testUser to create.
+	newSub = `{"service_name":"Yandex Plus","price":400,"user_id":"` + testUser + `","start_date":"07-2025"}`
+)
+
+// testOptions picks the middlewares of newTestServer, the zero value serves
+// the API without any.
+type testOptions struct {
+	requestLogger bool
+	// auth enables Authenticate, bearer tokens signed with testSecret too
+	// when bearer is set.
+	auth         bool
+	bearer       bool
+	authFailures *ratelimit.Limiter
+	rateLimits   *RateLimits
+	tenants      *tenant.Registry
+	idempotency  *service.IdempotencyService
+}
+
+// testServer is the API on in-memory repositories.
+type testServer struct {
+	t       *testing.T
+	router  *mux.Router
+	subServ *service.SubscriptionService
+	keyServ *service.APIKeyService
+}
+
+// newTestServer routes the API with the middlewares of opts in the order
+// main.go uses.
+func newTestServer(t *testing.T, opts testOptions) *testServer {
+	t.Helper()
+
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	ts := &testServer{
+		t:       t,
+		router:  mux.NewRouter(),
+		subServ: service.NewSubscriptionService(db.NewMemoryRepo(logger), logger),
+		keyServ: service.NewAPIKeyService(db.NewMemoryAPIKeyRepo(logger), logger),
+	}
+
+	if opts.requestLogger {
+		ts.router.Use(RequestLogger(logger))
+	}
+	api := StartServer(logger, ts.subServ, ts.router)
+	StartKeys(logger, ts.keyServ, api)
+	StartTenant(logger, api)
+
+	if opts.authFailures != nil {
+		api.Use(LimitAuthFailures(logger, opts.authFailures))
+	}
+	if opts.auth {
+		var verifier *auth.Verifier
+		if opts.bearer {
+			var err error
+			verifier, err = auth.NewVerifier(auth.JWTConfig{Secret: testSecret})
+			require.NoError(t, err)
+		}
+		api.Use(Authenticate(logger, ts.keyServ, verifier))
+	}
+	if opts.rateLimits != nil {
+		api.Use(RateLimit(logger, opts.rateLimits))
+	}
+	if opts.tenants != nil {
+		api.Use(Tenant(logger, opts.tenants))
+	}
+	if opts.idempotency != nil {
+		api.Use(Idempotent(logger, opts.idempotency))
+	}
+
+	return ts
+}
+
+// do serves a request with headers given as name and value pairs, headers
+// with empty values are left out.
+func (ts *testServer) do(method, path, body string, headers ...string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	for i := 0; i+1 < len(headers); i += 2 {
+		if headers[i+1] != "" {
+			req.Header.Set(headers[i], headers[i+1])
+		}
+	}
+	return ts.serve(req)
+}
+
+// serve routes req through the API.
+func (ts *testServer) serve(req *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	ts.router.ServeHTTP(w, req)
+	return w
+}
+
+// newKey creates an API key of testUser in the tenant of ctx.
+func (ts *testServer) newKey(ctx context.Context, scopes ...string) string {
+	key, err := ts.keyServ.Create(ctx, &models.NewAPIKey{Name: "test", Scopes: scopes, UserId: testUser})
+	require.NoError(ts.t, err)
+	return key.Key
+}
+
+// newToken signs a bearer token expiring in an hour with claims.
+func newToken(t *testing.T, claims jwt.MapClaims) string {
+	claims["exp"] = time.Now().Add(time.Hour).Unix()
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(testSecret))
+	require.NoError(t, err)
+	return token
+}
+
+func problemOf(t *testing.T, w *httptest.ResponseRecorder) *Problem {
+	var p Problem
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&p))
+	return &p
+}
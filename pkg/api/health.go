@@ -0,0 +1,144 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/EternalQ/effective-mobile-test/pkg/db"
+	"github.com/gorilla/mux"
+	"github.com/jmoiron/sqlx"
+)
+
+const readyTimeout = 2 * time.Second
+
+type Health struct {
+	log           *slog.Logger
+	db            *sqlx.DB
+	schemaVersion uint
+}
+
+type Check struct {
+	Ok    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+type MigrationCheck struct {
+	Check
+	Version  uint `json:"version"`
+	Expected uint `json:"expected"`
+}
+
+type PoolStats struct {
+	MaxOpen      int           `json:"max_open"`
+	Open         int           `json:"open"`
+	InUse        int           `json:"in_use"`
+	Idle         int           `json:"idle"`
+	WaitCount    int64         `json:"wait_count"`
+	WaitDuration time.Duration `json:"wait_duration_ns"`
+}
+
+type Readiness struct {
+	Ready      bool            `json:"ready"`
+	Database   *Check          `json:"database,omitempty"`
+	Migrations *MigrationCheck `json:"migrations,omitempty"`
+	Pool       *PoolStats      `json:"pool,omitempty"`
+}
+
+// StartHealth registers liveness and readiness probes. Readiness requires
+// the database to answer and to have at least schemaVersion applied.
+func StartHealth(log *slog.Logger, db *sqlx.DB, schemaVersion uint, r *mux.Router) {
+	h := &Health{
+		log.With(slog.String("where", "api/Health")),
+		db,
+		schemaVersion,
+	}
+
+	r.HandleFunc("/healthz", h.live).Methods("GET")
+	r.HandleFunc("/readyz", h.ready).Methods("GET")
+}
+
+func (h *Health) live(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]string{"status": "ok"}); err != nil {
+		h.log.Error("failed to encode response", slog.String("err", err.Error()))
+	}
+}
+
+func (h *Health) ready(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), readyTimeout)
+	defer cancel()
+
+	res := h.check(ctx)
+	code := http.StatusOK
+	if !res.Ready {
+		h.log.Warn("Service is not ready",
+			slog.Any("database", res.Database),
+			slog.Any("migrations", res.Migrations),
+		)
+		code = http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(res); err != nil {
+		h.log.Error("failed to encode response", slog.String("err", err.Error()))
+	}
+}
+
+func (h *Health) check(ctx context.Context) *Readiness {
+	res := &Readiness{Ready: true}
+	if h.db == nil {
+		return res
+	}
+
+	// Driver errors are logged, the response only tells which check failed.
+	res.Database = &Check{Ok: true}
+	if err := h.db.PingContext(ctx); err != nil {
+		h.log.Error("Error while pinging database",
+			slog.String("err", err.Error()),
+			slog.String("method", "check"),
+		)
+		res.Database = &Check{Error: "database is unreachable"}
+	}
+
+	res.Migrations = &MigrationCheck{Expected: h.schemaVersion}
+	version, dirty, err := db.SchemaVersion(ctx, h.db)
+	if errors.Is(err, db.ErrNoSchema) {
+		// Databases never migrated are unversioned, at version 0.
+		err = nil
+	}
+	switch {
+	case err != nil:
+		h.log.Error("Error while reading schema version",
+			slog.String("err", err.Error()),
+			slog.String("method", "check"),
+		)
+		res.Migrations.Error = "can't read schema version"
+	case dirty:
+		res.Migrations.Version = version
+		res.Migrations.Error = "last migration failed"
+	case version < h.schemaVersion:
+		res.Migrations.Version = version
+		res.Migrations.Error = "schema is behind"
+	default:
+		res.Migrations.Version = version
+		res.Migrations.Ok = true
+	}
+
+	stats := h.db.Stats()
+	res.Pool = &PoolStats{
+		MaxOpen:      stats.MaxOpenConnections,
+		Open:         stats.OpenConnections,
+		InUse:        stats.InUse,
+		Idle:         stats.Idle,
+		WaitCount:    stats.WaitCount,
+		WaitDuration: stats.WaitDuration,
+	}
+
+	res.Ready = res.Database.Ok && res.Migrations.Ok
+	return res
+}
@@ -0,0 +1,66 @@
+package api
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/EternalQ/effective-mobile-test/pkg/db"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHealth(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	r := mux.NewRouter()
+	StartHealth(logger, nil, 1, r)
+
+	t.Run("live", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("ready without database", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+		var res Readiness
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Nil(t, json.NewDecoder(w.Body).Decode(&res))
+		assert.True(t, res.Ready)
+		assert.Nil(t, res.Database)
+	})
+}
+
+func TestHealth_Unversioned(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	sqlDB, err := db.ConnectSQLite(":memory:")
+	require.NoError(t, err)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	ready := func(schemaVersion uint) (int, *Readiness) {
+		r := mux.NewRouter()
+		StartHealth(logger, sqlDB, schemaVersion, r)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+		var res Readiness
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&res))
+		return w.Code, &res
+	}
+
+	code, res := ready(0)
+	assert.Equal(t, http.StatusOK, code, "no migrations table is version 0")
+	assert.True(t, res.Migrations.Ok)
+
+	code, res = ready(1)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, uint(0), res.Migrations.Version)
+	assert.Equal(t, "schema is behind", res.Migrations.Error)
+}
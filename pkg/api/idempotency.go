@@ -0,0 +1,152 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log/slog"
+	"net/http"
+
+	"github.com/EternalQ/effective-mobile-test/pkg/logctx"
+	"github.com/EternalQ/effective-mobile-test/pkg/models"
+	"github.com/EternalQ/effective-mobile-test/pkg/service"
+	"github.com/gorilla/mux"
+)
+
+const (
+	IdempotencyKeyHeader = "Idempotency-Key"
+	// ReplayedHeader marks responses replayed for a repeated key.
+	ReplayedHeader = "Idempotent-Replayed"
+
+	maxIdempotencyKeyLength = 255
+	// maxIdempotentBodyBytes bounds the body read to hash the request.
+	maxIdempotentBodyBytes = 1 << 20
+)
+
+var errInvalidIdempotencyKey = &models.FieldError{
+	Field:   IdempotencyKeyHeader,
+	Message: "must be up to 255 printable ASCII characters",
+}
+
+// idempotentRoutes are the routes honouring Idempotency-Key.
+var idempotentRoutes = map[string]bool{
+	http.MethodPost + " /api/subscriptions": true,
+}
+
+// replayedHeaders are the response headers stored with a key.
+var replayedHeaders = []string{"Content-Type", "Location", "ETag", "Last-Modified"}
+
+// bufferedRecorder keeps a copy of the response body for the idempotency key.
+type bufferedRecorder struct {
+	*responseRecorder
+	body bytes.Buffer
+}
+
+func (br *bufferedRecorder) Write(b []byte) (int, error) {
+	br.body.Write(b)
+	return br.responseRecorder.Write(b)
+}
+
+func storedHeaders(h http.Header) models.Headers {
+	stored := models.Headers{}
+	for _, name := range replayedHeaders {
+		if value := h.Get(name); value != "" {
+			stored[name] = value
+		}
+	}
+	return stored
+}
+
+func validIdempotencyKey(key string) bool {
+	if len(key) > maxIdempotencyKeyLength {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] < 0x21 || key[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// requestHash tells apart requests sent with the same key.
+func requestHash(r *http.Request, body []byte) string {
+	h := sha256.New()
+	io.WriteString(h, r.Method+" "+r.URL.Path+"\n")
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Idempotent makes requests with an Idempotency-Key header safe to retry.
+// The first successful response is stored with its replayedHeaders and
+// replayed for repeats of the same request, a key reused for another request
+// is rejected. Bodies are hashed up to maxIdempotentBodyBytes. Failed
+// requests leave the key free. Behind Authenticate and Tenant, keys are per
+// client and tenant.
+func Idempotent(log *slog.Logger, serv *service.IdempotencyService) mux.MiddlewareFunc {
+	log = log.With(slog.String("where", "api/Idempotent"))
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			value := r.Header.Get(IdempotencyKeyHeader)
+			if value == "" || !idempotentRoutes[r.Method+" "+routeTemplate(r)] {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			reqLog := logctx.From(r.Context(), log, "api/Idempotent")
+			if !validIdempotencyKey(value) {
+				respondError(reqLog, w, r, errInvalidIdempotencyKey)
+				return
+			}
+
+			body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxIdempotentBodyBytes))
+			if err != nil {
+				reqLog.Error("Error while reading body",
+					slog.String("err", err.Error()),
+					slog.String("method", "Idempotent"),
+				)
+				respondError(reqLog, w, r, err)
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			key, err := serv.Begin(r.Context(), clientKey(r), value, requestHash(r, body))
+			if err != nil {
+				respondError(reqLog, w, r, err)
+				return
+			}
+
+			if !key.Pending() {
+				reqLog.Info("Replaying response", slog.Int("status", key.Status))
+				for name, value := range key.Headers {
+					w.Header().Set(name, value)
+				}
+				w.Header().Set(ReplayedHeader, "true")
+				w.WriteHeader(key.Status)
+				w.Write(key.Response)
+				return
+			}
+
+			rec := &bufferedRecorder{responseRecorder: &responseRecorder{ResponseWriter: w}}
+			next.ServeHTTP(rec, r)
+
+			// The response is already sent, the key outlives the request.
+			ctx := context.WithoutCancel(r.Context())
+			if rec.status >= 200 && rec.status < 300 {
+				err = serv.Complete(ctx, key, rec.status, storedHeaders(rec.Header()), rec.body.Bytes())
+			} else {
+				err = serv.Release(ctx, key)
+			}
+			if err != nil {
+				reqLog.Error("Error while storing idempotency key",
+					slog.String("err", err.Error()),
+					slog.String("method", "Idempotent"),
+					slog.Int("status", rec.status),
+				)
+			}
+		})
+	}
+}
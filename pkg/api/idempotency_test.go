@@ -0,0 +1,62 @@
+package api
+
+import (
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/EternalQ/effective-mobile-test/pkg/db"
+	"github.com/EternalQ/effective-mobile-test/pkg/models"
+	"github.com/EternalQ/effective-mobile-test/pkg/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIdempotent(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	idemServ := service.NewIdempotencyService(db.NewMemoryIdempotencyRepo(logger), time.Hour, logger)
+	ts := newTestServer(t, testOptions{idempotency: idemServ})
+
+	do := func(key, body string) *httptest.ResponseRecorder {
+		return ts.do(http.MethodPost, "/api/subscriptions", body, IdempotencyKeyHeader, key)
+	}
+
+	first := do("create-1", newSub)
+	require.Equal(t, http.StatusCreated, first.Code)
+	assert.Empty(t, first.Header().Get(ReplayedHeader))
+
+	repeat := do("create-1", newSub)
+	require.Equal(t, http.StatusCreated, repeat.Code)
+	assert.Equal(t, "true", repeat.Header().Get(ReplayedHeader))
+	assert.JSONEq(t, first.Body.String(), repeat.Body.String())
+	for _, name := range []string{"Content-Type", "Location", "ETag"} {
+		assert.NotEmpty(t, first.Header().Get(name))
+		assert.Equal(t, first.Header().Get(name), repeat.Header().Get(name), "%s is replayed", name)
+	}
+
+	page, err := ts.subServ.List(t.Context(), &models.SubscriptionFilter{}, &models.Pagination{Limit: 10, Sort: "id"})
+	require.NoError(t, err)
+	assert.Equal(t, 1, page.Total, "repeats don't create subscriptions")
+
+	w := do("create-1", strings.Replace(newSub, "400", "500", 1))
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Equal(t, CodeKeyReused, problemOf(t, w).Code)
+
+	w = do("create-2", `{"price":-1}`)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, http.StatusCreated, do("create-2", newSub).Code, "failed requests leave the key free")
+
+	w = do(strings.Repeat("k", 256), newSub)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, IdempotencyKeyHeader, problemOf(t, w).Errors[0].Field)
+
+	w = do("create-3", `{"service_name":"`+strings.Repeat("x", maxIdempotentBodyBytes)+`"}`)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	assert.Equal(t, CodeBodyTooLarge, problemOf(t, w).Code)
+
+	assert.Equal(t, http.StatusCreated, do("", newSub).Code)
+}
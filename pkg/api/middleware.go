@@ -0,0 +1,193 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/EternalQ/effective-mobile-test/pkg/logctx"
+	"github.com/EternalQ/effective-mobile-test/pkg/metrics"
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	RequestIDHeader = "X-Request-ID"
+
+	maxRequestIDLength = 128
+)
+
+var tracer = otel.Tracer("github.com/EternalQ/effective-mobile-test/pkg/api")
+
+// responseRecorder remembers the status and the number of bytes written.
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (rr *responseRecorder) WriteHeader(status int) {
+	if rr.status == 0 {
+		rr.status = status
+	}
+	rr.ResponseWriter.WriteHeader(status)
+}
+
+func (rr *responseRecorder) Write(b []byte) (int, error) {
+	if rr.status == 0 {
+		rr.status = http.StatusOK
+	}
+	n, err := rr.ResponseWriter.Write(b)
+	rr.bytes += n
+	return n, err
+}
+
+func (rr *responseRecorder) Unwrap() http.ResponseWriter {
+	return rr.ResponseWriter
+}
+
+// Tracing starts a server span for every request, continuing the trace
+// from the W3C traceparent header when the client sends one.
+func Tracing() mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+
+			route := routeTemplate(r)
+			ctx, span := tracer.Start(ctx, r.Method+" "+route,
+				trace.WithSpanKind(trace.SpanKindServer),
+				trace.WithAttributes(
+					attribute.String("http.request.method", r.Method),
+					attribute.String("http.route", route),
+					attribute.String("url.path", r.URL.Path),
+				),
+			)
+			defer span.End()
+
+			rec := &responseRecorder{ResponseWriter: w}
+			next.ServeHTTP(rec, r.WithContext(ctx))
+			if rec.status == 0 {
+				rec.status = http.StatusOK
+			}
+
+			span.SetAttributes(attribute.Int("http.response.status_code", rec.status))
+			if rec.status >= http.StatusInternalServerError {
+				span.SetStatus(codes.Error, http.StatusText(rec.status))
+			}
+		})
+	}
+}
+
+// RequestLogger assigns every request an ID, taken from X-Request-ID when
+// the client sends a sane one, and puts a logger tagged with it into the
+// request context. One access log line is written once the request is done.
+// Behind Tracing the trace and span IDs are logged as well.
+func RequestLogger(log *slog.Logger) mux.MiddlewareFunc {
+	access := log.With(slog.String("where", "api/RequestLogger"))
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+
+			id := r.Header.Get(RequestIDHeader)
+			if !validRequestID(id) {
+				id = newRequestID()
+			}
+			w.Header().Set(RequestIDHeader, id)
+
+			attrs := []any{slog.String("request_id", id)}
+			if sc := trace.SpanContextFromContext(r.Context()); sc.IsValid() {
+				attrs = append(attrs,
+					slog.String("trace_id", sc.TraceID().String()),
+					slog.String("span_id", sc.SpanID().String()),
+				)
+			}
+			ctx := logctx.WithRequestID(r.Context(), id)
+			r = r.WithContext(logctx.With(ctx, log.With(attrs...)))
+
+			rec := &responseRecorder{ResponseWriter: w}
+			next.ServeHTTP(rec, r)
+			if rec.status == 0 {
+				rec.status = http.StatusOK
+			}
+
+			level := slog.LevelInfo
+			if rec.status >= http.StatusInternalServerError {
+				level = slog.LevelError
+			}
+			access.With(attrs...).LogAttrs(r.Context(), level, "Request handled",
+				slog.String("method", r.Method),
+				slog.String("route", routeTemplate(r)),
+				slog.String("path", r.URL.Path),
+				slog.Int("status", rec.status),
+				slog.Duration("latency", time.Since(start)),
+				slog.Int("bytes", rec.bytes),
+			)
+		})
+	}
+}
+
+// RequestMetrics records the count and latency of every request by route
+// template and status.
+func RequestMetrics(m *metrics.Metrics) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+
+			rec := &responseRecorder{ResponseWriter: w}
+			next.ServeHTTP(rec, r)
+			if rec.status == 0 {
+				rec.status = http.StatusOK
+			}
+
+			m.ObserveRequest(r.Method, routeTemplate(r), rec.status, time.Since(start))
+		})
+	}
+}
+
+// HandleUnmatched sends 404 and 405 responses of r through middlewares,
+// which mux only applies to matched routes, so they are logged and counted
+// too.
+func HandleUnmatched(r *mux.Router, middlewares ...mux.MiddlewareFunc) {
+	var notFound, notAllowed http.Handler = http.NotFoundHandler(), http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	})
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		notFound = middlewares[i](notFound)
+		notAllowed = middlewares[i](notAllowed)
+	}
+	r.NotFoundHandler = notFound
+	r.MethodNotAllowedHandler = notAllowed
+}
+
+func routeTemplate(r *http.Request) string {
+	route := ""
+	if cur := mux.CurrentRoute(r); cur != nil {
+		route, _ = cur.GetPathTemplate()
+	}
+	return route
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,149 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/EternalQ/effective-mobile-test/pkg/logctx"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestRequestLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, nil))
+
+	r := mux.NewRouter()
+	r.Use(RequestLogger(logger))
+	r.HandleFunc("/items/{id}", func(w http.ResponseWriter, r *http.Request) {
+		logctx.From(r.Context(), logger, "test/Handler").Info("Handling")
+		w.WriteHeader(http.StatusTeapot)
+		_, _ = w.Write([]byte("short and stout"))
+	})
+
+	lines := func() []map[string]any {
+		var res []map[string]any
+		dec := json.NewDecoder(&buf)
+		for dec.More() {
+			var line map[string]any
+			require.NoError(t, dec.Decode(&line))
+			res = append(res, line)
+		}
+		buf.Reset()
+		return res
+	}
+
+	t.Run("propagates id", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/items/7", nil)
+		req.Header.Set(RequestIDHeader, "req-42")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, "req-42", w.Header().Get(RequestIDHeader))
+
+		logged := lines()
+		require.Len(t, logged, 2)
+		assert.Equal(t, "req-42", logged[0]["request_id"])
+		assert.Equal(t, "test/Handler", logged[0]["where"])
+
+		access := logged[1]
+		assert.Equal(t, "Request handled", access["msg"])
+		assert.Equal(t, "req-42", access["request_id"])
+		assert.Equal(t, "/items/{id}", access["route"])
+		assert.Equal(t, float64(http.StatusTeapot), access["status"])
+		assert.Equal(t, float64(len("short and stout")), access["bytes"])
+		assert.Contains(t, access, "latency")
+	})
+
+	t.Run("generates id", func(t *testing.T) {
+		for _, id := range []string{"", strings.Repeat("a", maxRequestIDLength+1), "bad id"} {
+			req := httptest.NewRequest(http.MethodGet, "/items/7", nil)
+			req.Header.Set(RequestIDHeader, id)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			got := w.Header().Get(RequestIDHeader)
+			assert.Len(t, got, 32)
+			assert.NotEqual(t, id, got)
+			lines()
+		}
+	})
+}
+
+func TestHandleUnmatched(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, nil))
+
+	r := mux.NewRouter()
+	middlewares := []mux.MiddlewareFunc{RequestLogger(logger)}
+	r.Use(middlewares...)
+	HandleUnmatched(r, middlewares...)
+	r.PathPrefix("/api").Subrouter().HandleFunc("/items", func(w http.ResponseWriter, r *http.Request) {}).Methods("GET")
+
+	for _, path := range []string{"/nowhere", "/api/nowhere"} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		assert.Equal(t, http.StatusNotFound, w.Code, path)
+		assert.NotEmpty(t, w.Header().Get(RequestIDHeader), path)
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/items", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	assert.NotEmpty(t, w.Header().Get(RequestIDHeader))
+
+	var access map[string]any
+	dec := json.NewDecoder(&buf)
+	for dec.More() {
+		require.NoError(t, dec.Decode(&access))
+	}
+	assert.Equal(t, "Request handled", access["msg"])
+	assert.Equal(t, float64(http.StatusMethodNotAllowed), access["status"])
+}
+
+func TestTracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() { _ = provider.Shutdown(context.Background()) })
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, nil))
+
+	r := mux.NewRouter()
+	r.Use(Tracing())
+	r.Use(RequestLogger(logger))
+	r.HandleFunc("/items/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/items/7", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 1)
+	span := spans[0]
+	assert.Equal(t, "GET /items/{id}", span.Name())
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", span.SpanContext().TraceID().String())
+	assert.Equal(t, "00f067aa0ba902b7", span.Parent().SpanID().String())
+	assert.Equal(t, codes.Error, span.Status().Code)
+
+	var access map[string]any
+	require.NoError(t, json.NewDecoder(&buf).Decode(&access))
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", access["trace_id"])
+	assert.Equal(t, span.SpanContext().SpanID().String(), access["span_id"])
+}
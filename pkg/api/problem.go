@@ -0,0 +1,178 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/EternalQ/effective-mobile-test/pkg/auth"
+	"github.com/EternalQ/effective-mobile-test/pkg/db"
+	"github.com/EternalQ/effective-mobile-test/pkg/models"
+	"github.com/EternalQ/effective-mobile-test/pkg/service"
+	"github.com/EternalQ/effective-mobile-test/pkg/tenant"
+)
+
+// Stable machine-readable error codes returned in Problem.Code.
+const (
+	CodeMalformedBody        = "malformed_body"
+	CodeBodyTooLarge         = "body_too_large"
+	CodeInvalidField         = "invalid_field"
+	CodeEmptyUpdate          = "empty_update"
+	CodeWindowRequired       = "window_required"
+	CodeNotFound             = "not_found"
+	CodeUnauthorized         = "unauthorized"
+	CodeForbidden            = "forbidden"
+	CodeConstraint           = "constraint_violation"
+	CodeConflict             = "conflict"
+	CodePrecondition         = "precondition_failed"
+	CodePreconditionRequired = "precondition_required"
+	CodeReference            = "reference_violation"
+	CodeRateLimited          = "rate_limited"
+	CodeKeyReused            = "idempotency_key_reused"
+	CodeKeyPending           = "idempotency_key_pending"
+	CodeTimeout              = "timeout"
+	CodeInternal             = "internal_error"
+)
+
+var (
+	errEmptyUpdate = errors.New("no fields to update")
+	errNullBody    = errors.New("request body is null")
+	errInvalidId   = &models.FieldError{Field: "id", Message: "must be an integer"}
+	errMissingKey  = errors.New("missing API key or bearer token")
+	errForbidden   = errors.New("missing scope")
+	errKeyNotFound = errors.New("API key not found")
+)
+
+// Problem is an RFC 7807 error response body.
+type Problem struct {
+	Type     string               `json:"type"`
+	Title    string               `json:"title"`
+	Status   int                  `json:"status"`
+	Code     string               `json:"code"`
+	Detail   string               `json:"detail,omitempty"`
+	Instance string               `json:"instance,omitempty"`
+	Errors   []*models.FieldError `json:"errors,omitempty"`
+}
+
+func newProblem(status int, code, detail string, fields ...*models.FieldError) *Problem {
+	return &Problem{
+		Type:   "about:blank",
+		Title:  http.StatusText(status),
+		Status: status,
+		Code:   code,
+		Detail: detail,
+		Errors: fields,
+	}
+}
+
+// problemFor maps an error to the response clients see. Anything not known
+// to be safe is reported as an internal error without its text.
+func problemFor(err error) *Problem {
+	var (
+		fieldErr  *models.FieldError
+		typeErr   *json.UnmarshalTypeError
+		syntaxErr *json.SyntaxError
+		dbErr     *db.Error
+		sizeErr   *http.MaxBytesError
+		validErr  *service.ValidationError
+	)
+
+	switch {
+	case errors.As(err, &validErr):
+		return newProblem(http.StatusBadRequest, CodeInvalidField, "Request has invalid fields", validErr.Fields...)
+	case errors.As(err, &fieldErr):
+		return newProblem(http.StatusBadRequest, CodeInvalidField, "Request has invalid fields", fieldErr)
+	case errors.As(err, &typeErr):
+		return newProblem(http.StatusBadRequest, CodeInvalidField, "Request has invalid fields",
+			&models.FieldError{Field: typeErr.Field, Message: "must be of type " + typeErr.Type.String()},
+		)
+	case errors.As(err, &syntaxErr), errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return newProblem(http.StatusBadRequest, CodeMalformedBody, "Request body is not valid JSON")
+	case errors.As(err, &sizeErr):
+		return newProblem(http.StatusRequestEntityTooLarge, CodeBodyTooLarge, "Request body is too large")
+	case errors.Is(err, errNullBody):
+		return newProblem(http.StatusBadRequest, CodeMalformedBody, "Request body must be a JSON object")
+	case errors.Is(err, errEmptyUpdate):
+		return newProblem(http.StatusBadRequest, CodeEmptyUpdate, "At least one field to update is required")
+	case errors.Is(err, service.ErrWindowRequired):
+		return newProblem(http.StatusBadRequest, CodeWindowRequired, "Filter window is required",
+			&models.FieldError{Field: "start_date", Message: "is required"},
+			&models.FieldError{Field: "end_date", Message: "is required"},
+		)
+	case errors.Is(err, errMissingKey):
+		return newProblem(http.StatusUnauthorized, CodeUnauthorized, "API key or bearer token is required")
+	case errors.Is(err, service.ErrInvalidKey):
+		return newProblem(http.StatusUnauthorized, CodeUnauthorized, "API key is invalid or revoked")
+	case errors.Is(err, auth.ErrInvalidToken):
+		return newProblem(http.StatusUnauthorized, CodeUnauthorized, "Bearer token is invalid or expired")
+	case errors.Is(err, errForbidden):
+		return newProblem(http.StatusForbidden, CodeForbidden, "API key lacks the scope required")
+	case errors.Is(err, tenant.ErrInvalidID):
+		return newProblem(http.StatusBadRequest, CodeInvalidField, "Request has invalid fields",
+			&models.FieldError{Field: TenantHeader, Message: "must be a lowercase slug of up to 63 characters"},
+		)
+	case errors.Is(err, tenant.ErrUnknown):
+		return newProblem(http.StatusForbidden, CodeForbidden, "Tenant is unknown")
+	case errors.Is(err, errTenantMismatch):
+		return newProblem(http.StatusForbidden, CodeForbidden, "Credentials are bound to another tenant")
+	case errors.Is(err, errTenantRequired):
+		return newProblem(http.StatusForbidden, CodeForbidden, "Bearer token needs a tenant claim unless it has the admin scope")
+	case errors.Is(err, service.ErrOtherTenant):
+		return newProblem(http.StatusForbidden, CodeForbidden, "Subscriptions of other tenants are not accessible")
+	case errors.Is(err, errRateLimited):
+		return newProblem(http.StatusTooManyRequests, CodeRateLimited, "Too many requests, retry after the time in Retry-After")
+	case errors.Is(err, service.ErrKeyReused):
+		return newProblem(http.StatusUnprocessableEntity, CodeKeyReused, "Idempotency key was used for another request")
+	case errors.Is(err, service.ErrKeyPending):
+		return newProblem(http.StatusConflict, CodeKeyPending, "Request with the idempotency key is in progress, retry later")
+	case errors.Is(err, errKeyNotFound):
+		return newProblem(http.StatusNotFound, CodeNotFound, "API key not found")
+	case errors.Is(err, service.ErrForbidden):
+		return newProblem(http.StatusForbidden, CodeForbidden, "Subscriptions of other users are not accessible")
+	case errors.Is(err, errIfMatchRequired):
+		return newProblem(http.StatusPreconditionRequired, CodePreconditionRequired, "If-Match with the ETag of the subscription or \"*\" is required")
+	case errors.Is(err, db.ErrVersionMismatch):
+		return newProblem(http.StatusPreconditionFailed, CodePrecondition, "Subscription was changed, read it again for the current ETag")
+	case errors.Is(err, db.ErrNotFound), errors.Is(err, service.ErrNotOwner):
+		return newProblem(http.StatusNotFound, CodeNotFound, "Subscription not found")
+	case errors.As(err, &dbErr):
+		return dbProblem(dbErr)
+	default:
+		return newProblem(http.StatusInternalServerError, CodeInternal, "Internal server error")
+	}
+}
+
+// dbProblem reports a classified database error without the driver message.
+func dbProblem(err *db.Error) *Problem {
+	var fields []*models.FieldError
+	field := func(msg string) {
+		if err.Field != "" {
+			fields = append(fields, &models.FieldError{Field: err.Field, Message: msg})
+		}
+	}
+
+	switch err.Kind {
+	case db.ErrInvalidInput:
+		field("has invalid format")
+		return newProblem(http.StatusBadRequest, CodeInvalidField, "Request has invalid fields", fields...)
+	case db.ErrConstraint:
+		field("violates constraint")
+		return newProblem(http.StatusUnprocessableEntity, CodeConstraint, "Request violates data constraints", fields...)
+	case db.ErrTimeout:
+		return newProblem(http.StatusServiceUnavailable, CodeTimeout, "Request took too long, try again later")
+	case db.ErrConflict:
+		return newProblem(http.StatusConflict, CodeConflict, "Subscription already exists")
+	case db.ErrReference:
+		field("references missing entity")
+		return newProblem(http.StatusUnprocessableEntity, CodeReference, "Request references a missing entity", fields...)
+	default:
+		return newProblem(http.StatusInternalServerError, CodeInternal, "Internal server error")
+	}
+}
+
+func writeProblem(w http.ResponseWriter, p *Problem) error {
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(p.Status)
+	return json.NewEncoder(w).Encode(p)
+}
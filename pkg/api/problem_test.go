@@ -0,0 +1,142 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/EternalQ/effective-mobile-test/pkg/db"
+	"github.com/EternalQ/effective-mobile-test/pkg/models"
+	"github.com/EternalQ/effective-mobile-test/pkg/service"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProblemFor(t *testing.T) {
+	var typeErr error = json.Unmarshal([]byte(`{"price": "x"}`), &models.Subscription{})
+	var syntaxErr error = json.Unmarshal([]byte(`{`), &models.Subscription{})
+
+	tests := []struct {
+		name string
+		err  error
+
+		wantStatus int
+		wantCode   string
+		wantFields []string
+	}{
+		{
+			name:       "field error",
+			err:        &models.FieldError{Field: "start_date", Message: "must be in MM-YYYY format"},
+			wantStatus: http.StatusBadRequest,
+			wantCode:   CodeInvalidField,
+			wantFields: []string{"start_date"},
+		},
+		{
+			name:       "wrapped field error",
+			err:        fmt.Errorf("parse: %w", &models.FieldError{Field: "mode"}),
+			wantStatus: http.StatusBadRequest,
+			wantCode:   CodeInvalidField,
+			wantFields: []string{"mode"},
+		},
+		{
+			name: "validation",
+			err: &service.ValidationError{Fields: []*models.FieldError{
+				{Field: "user_id", Message: "must be a valid UUID"},
+				{Field: "price", Message: "must be positive"},
+			}},
+			wantStatus: http.StatusBadRequest,
+			wantCode:   CodeInvalidField,
+			wantFields: []string{"user_id", "price"},
+		},
+		{
+			name:       "json type",
+			err:        typeErr,
+			wantStatus: http.StatusBadRequest,
+			wantCode:   CodeInvalidField,
+			wantFields: []string{"price"},
+		},
+		{
+			name:       "json syntax",
+			err:        syntaxErr,
+			wantStatus: http.StatusBadRequest,
+			wantCode:   CodeMalformedBody,
+		},
+		{
+			name:       "window",
+			err:        service.ErrWindowRequired,
+			wantStatus: http.StatusBadRequest,
+			wantCode:   CodeWindowRequired,
+			wantFields: []string{"start_date", "end_date"},
+		},
+		{
+			name:       "not found",
+			err:        db.ErrNotFound,
+			wantStatus: http.StatusNotFound,
+			wantCode:   CodeNotFound,
+		},
+		{
+			name:       "version mismatch",
+			err:        db.ErrVersionMismatch,
+			wantStatus: http.StatusPreconditionFailed,
+			wantCode:   CodePrecondition,
+		},
+		{
+			name:       "invalid uuid",
+			err:        &db.Error{Kind: db.ErrInvalidInput, Field: "user_id", Err: errors.New("pq: invalid input syntax for type uuid")},
+			wantStatus: http.StatusBadRequest,
+			wantCode:   CodeInvalidField,
+			wantFields: []string{"user_id"},
+		},
+		{
+			name:       "check violation",
+			err:        &db.Error{Kind: db.ErrConstraint, Field: "price", Err: errors.New("pq: violates check constraint")},
+			wantStatus: http.StatusUnprocessableEntity,
+			wantCode:   CodeConstraint,
+			wantFields: []string{"price"},
+		},
+		{
+			name:       "unique violation",
+			err:        &db.Error{Kind: db.ErrConflict, Err: errors.New("pq: duplicate key value")},
+			wantStatus: http.StatusConflict,
+			wantCode:   CodeConflict,
+		},
+		{
+			name:       "foreign key violation",
+			err:        &db.Error{Kind: db.ErrReference, Err: errors.New("pq: violates foreign key constraint")},
+			wantStatus: http.StatusUnprocessableEntity,
+			wantCode:   CodeReference,
+		},
+		{
+			name:       "internal",
+			err:        errors.New(`pq: relation "subscriptions" does not exist`),
+			wantStatus: http.StatusInternalServerError,
+			wantCode:   CodeInternal,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := problemFor(tt.err)
+			assert.Equal(t, tt.wantStatus, p.Status)
+			assert.Equal(t, tt.wantCode, p.Code)
+
+			fields := []string{}
+			for _, f := range p.Errors {
+				fields = append(fields, f.Field)
+			}
+			assert.ElementsMatch(t, tt.wantFields, fields)
+		})
+	}
+}
+
+func TestWriteProblem(t *testing.T) {
+	w := httptest.NewRecorder()
+	err := writeProblem(w, problemFor(errors.New(`pq: syntax error at or near "WHERE"`)))
+
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "application/problem+json", w.Header().Get("Content-Type"))
+	assert.False(t, strings.Contains(w.Body.String(), "pq:"))
+}
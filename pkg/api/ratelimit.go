@@ -0,0 +1,131 @@
+package api
+
+import (
+	"errors"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/EternalQ/effective-mobile-test/pkg/auth"
+	"github.com/EternalQ/effective-mobile-test/pkg/logctx"
+	"github.com/EternalQ/effective-mobile-test/pkg/ratelimit"
+	"github.com/gorilla/mux"
+)
+
+var errRateLimited = errors.New("rate limit exceeded")
+
+// RateLimits are the budgets of request classes, a nil limiter leaves the
+// class unlimited.
+type RateLimits struct {
+	Read  *ratelimit.Limiter
+	Write *ratelimit.Limiter
+	// Calc covers calculations, which load every matching subscription.
+	Calc *ratelimit.Limiter
+}
+
+// limiter returns the budget of the request class and its name.
+func (l *RateLimits) limiter(r *http.Request) (*ratelimit.Limiter, string) {
+	route := routeTemplate(r)
+	switch {
+	case strings.HasPrefix(route, "/api/subscriptions/calc"):
+		return l.Calc, "calc"
+	case r.Method == http.MethodGet, r.Method == http.MethodHead:
+		return l.Read, "read"
+	default:
+		return l.Write, "write"
+	}
+}
+
+// clientKey identifies the caller: the API key or token subject when
+// authenticated, the client IP otherwise.
+func clientKey(r *http.Request) string {
+	if actor := auth.FromContext(r.Context()).Actor(); actor != auth.Anonymous {
+		return actor
+	}
+	return ipKey(r)
+}
+
+func ipKey(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// seconds rounds d up to whole seconds for headers.
+func seconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
+
+// RateLimit limits requests with a token bucket per client and request
+// class. Every limited response carries RateLimit-* headers, rejected ones
+// are answered with 429 and Retry-After. Behind Authenticate, so clients
+// are told apart by their credentials.
+func RateLimit(log *slog.Logger, limits *RateLimits) mux.MiddlewareFunc {
+	log = log.With(slog.String("where", "api/RateLimit"))
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			limiter, class := limits.limiter(r)
+			if limiter == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			key := clientKey(r)
+			res := limiter.Allow(class + "/" + key)
+			cfg := limiter.Config()
+
+			h := w.Header()
+			h.Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+			h.Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+			h.Set("RateLimit-Reset", seconds(res.Reset))
+			h.Set("RateLimit-Policy", strconv.Itoa(cfg.Burst)+";w="+seconds(cfg.Window()))
+
+			if !res.Allowed {
+				h.Set("Retry-After", seconds(res.RetryAfter))
+				reqLog := logctx.From(r.Context(), log, "api/RateLimit")
+				respondError(reqLog.With(slog.String("class", class), slog.String("client", key)), w, r, errRateLimited)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// LimitAuthFailures charges requests answered with 401 to a bucket per
+// client IP and rejects clients that ran it dry with 429 before their
+// credentials are checked, so keys and tokens can't be guessed at will.
+// Goes in front of Authenticate, a nil limiter disables it.
+func LimitAuthFailures(log *slog.Logger, limiter *ratelimit.Limiter) mux.MiddlewareFunc {
+	log = log.With(slog.String("where", "api/LimitAuthFailures"))
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if limiter == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			key := ipKey(r)
+			if res := limiter.Peek(key); !res.Allowed {
+				w.Header().Set("Retry-After", seconds(res.RetryAfter))
+				reqLog := logctx.From(r.Context(), log, "api/LimitAuthFailures")
+				respondError(reqLog.With(slog.String("client", key)), w, r, errRateLimited)
+				return
+			}
+
+			rec := &responseRecorder{ResponseWriter: w}
+			next.ServeHTTP(rec, r)
+			if rec.status == http.StatusUnauthorized {
+				limiter.Allow(key)
+			}
+		})
+	}
+}
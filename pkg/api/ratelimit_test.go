@@ -0,0 +1,69 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/EternalQ/effective-mobile-test/pkg/ratelimit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateLimit(t *testing.T) {
+	ts := newTestServer(t, testOptions{auth: true, rateLimits: &RateLimits{
+		Read: ratelimit.New(ratelimit.Config{Rate: 0.5, Burst: 2}),
+		Calc: ratelimit.New(ratelimit.Config{Rate: 0.5, Burst: 1}),
+	}})
+	first, second := ts.newKey(t.Context(), "write"), ts.newKey(t.Context(), "write")
+
+	do := func(method, path, key string) *httptest.ResponseRecorder {
+		return ts.do(method, path, `{}`, APIKeyHeader, key)
+	}
+
+	w := do(http.MethodGet, "/api/subscriptions", first)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "2", w.Header().Get("RateLimit-Limit"))
+	assert.Equal(t, "1", w.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "2;w=4", w.Header().Get("RateLimit-Policy"))
+
+	require.Equal(t, http.StatusOK, do(http.MethodGet, "/api/subscriptions", first).Code)
+
+	w = do(http.MethodGet, "/api/subscriptions", first)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "2", w.Header().Get("Retry-After"))
+	assert.Equal(t, "0", w.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, CodeRateLimited, problemOf(t, w).Code)
+
+	assert.Equal(t, http.StatusOK, do(http.MethodGet, "/api/subscriptions", second).Code, "budgets are per key")
+
+	require.Equal(t, http.StatusOK, do(http.MethodPost, "/api/subscriptions/calc", first).Code, "calc has its own budget")
+	assert.Equal(t, http.StatusTooManyRequests, do(http.MethodPost, "/api/subscriptions/calc", first).Code)
+
+	w = do(http.MethodPost, "/api/subscriptions", first)
+	assert.Empty(t, w.Header().Get("RateLimit-Limit"), "writes are unlimited without a limiter")
+}
+
+func TestLimitAuthFailures(t *testing.T) {
+	ts := newTestServer(t, testOptions{auth: true, authFailures: ratelimit.New(ratelimit.Config{Rate: 0.5, Burst: 2})})
+	key := ts.newKey(t.Context(), "admin")
+
+	do := func(key, remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/subscriptions", nil)
+		req.RemoteAddr = remoteAddr
+		req.Header.Set(APIKeyHeader, key)
+		return ts.serve(req)
+	}
+
+	for range 3 {
+		require.Equal(t, http.StatusOK, do(key, "192.0.2.1:1234").Code, "successes are free")
+	}
+	require.Equal(t, http.StatusUnauthorized, do("emk_guess", "192.0.2.1:1234").Code)
+	require.Equal(t, http.StatusUnauthorized, do("emk_guess", "192.0.2.1:1234").Code)
+
+	w := do(key, "192.0.2.1:1234")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code, "the IP is blocked before its credentials are checked")
+	assert.Equal(t, "2", w.Header().Get("Retry-After"))
+
+	assert.Equal(t, http.StatusUnauthorized, do("emk_guess", "192.0.2.2:1234").Code, "budgets are per IP")
+}
@@ -1,15 +1,21 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
 	"log/slog"
 	"net/http"
+	"net/url"
 	"strconv"
+	"time"
 
-	"github.com/EternalQ/effective-mobile-test/pkg/db"
+	"github.com/EternalQ/effective-mobile-test/pkg/logctx"
 	"github.com/EternalQ/effective-mobile-test/pkg/models"
 	"github.com/EternalQ/effective-mobile-test/pkg/service"
+	"github.com/EternalQ/effective-mobile-test/pkg/tenant"
 	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type Server struct {
@@ -17,7 +23,9 @@ type Server struct {
 	subsServ *service.SubscriptionService
 }
 
-func StartServer(log *slog.Logger, subsServ *service.SubscriptionService, r *mux.Router) {
+// StartServer registers subscription routes and returns the /api subrouter
+// for other routes and middleware to share.
+func StartServer(log *slog.Logger, subsServ *service.SubscriptionService, r *mux.Router) *mux.Router {
 	s := &Server{
 		log.With(slog.String("where", "api/Server")),
 		subsServ,
@@ -30,150 +38,349 @@ func StartServer(log *slog.Logger, subsServ *service.SubscriptionService, r *mux
 	api.HandleFunc("/subscriptions/{id}", s.readSubscription).Methods("Get")
 	api.HandleFunc("/subscriptions/{id}", s.updateSubscription).Methods("PATCH")
 	api.HandleFunc("/subscriptions/{id}", s.deleteSubscription).Methods("DELETE")
+	api.HandleFunc("/subscriptions/{id}/history", s.subscriptionHistory).Methods("GET")
 	api.HandleFunc("/subscriptions/calc", s.calculateSubscription).Methods("POST")
+	api.HandleFunc("/subscriptions/calc/breakdown", s.breakdownSubscription).Methods("POST")
+
+	return api
+}
+
+func (s *Server) logger(ctx context.Context) *slog.Logger {
+	return logctx.From(ctx, s.log, "api/Server")
 }
 
-func (s *Server) handleError(w http.ResponseWriter, r *http.Request, err string, code int) {
-	s.log.Error("Error while handling request",
-		slog.String("err", err),
+func (s *Server) handleError(w http.ResponseWriter, r *http.Request, err error) {
+	respondError(s.logger(r.Context()), w, r, err)
+}
+
+// respondError writes err as a problem and logs it with the span and request
+// attributes.
+func respondError(log *slog.Logger, w http.ResponseWriter, r *http.Request, err error) {
+	p := problemFor(err)
+	p.Instance = r.URL.Path
+
+	span := trace.SpanFromContext(r.Context())
+	span.RecordError(err)
+	span.SetAttributes(attribute.String("error.type", p.Code))
+
+	log.Error("Error while handling request",
+		slog.String("err", err.Error()),
+		slog.String("code", p.Code),
 		slog.String("method", r.Method),
 		slog.String("path", r.URL.Path),
 	)
-	http.Error(w, err, code)
+	if p.Status == http.StatusUnauthorized {
+		w.Header().Add("WWW-Authenticate", `Bearer realm="api"`)
+		w.Header().Add("WWW-Authenticate", `APIKey header="`+APIKeyHeader+`"`)
+	}
+	if err := writeProblem(w, p); err != nil {
+		log.Error("failed to encode response", slog.String("err", err.Error()))
+	}
 }
 
 // @Summary Create a new subscription
-// @Description Creates a new subscription
+// @Description Creates a new subscription. Bearer token callers without the `admin` scope may omit `user_id`, it defaults to the token subject. Requests with an `Idempotency-Key` header are safe to retry.
 // @Tags subscriptions
 // @Accept json
 // @Produce json
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Param X-Tenant-ID header string false "Tenant ID for platform admins, the default tenant if omitted. Other callers may only repeat their own"
+// @Param Idempotency-Key header string false "Key making retries safe, a repeat of the request replays the first response"
 // @Param subscription body models.Subscription true "Subscription details"
 // @Success 201 {int} int "ID of the created subscription"
-// @Failure 400 {string} string "Invalid input"
+// @Header 201 {string} Location "URL of the created subscription"
+// @Header 201 {string} ETag "Subscription version"
+// @Failure 400 {object} Problem "Invalid input"
+// @Failure 409 {object} Problem "Subscription already exists or request with the idempotency key in progress"
+// @Failure 413 {object} Problem "Body too large for a request with an idempotency key"
+// @Failure 422 {object} Problem "Constraint violation or idempotency key used for another request"
+// @Failure 401 {object} Problem "Missing or invalid credentials"
+// @Failure 429 {object} Problem "Too many requests"
+// @Failure 403 {object} Problem "Caller lacks the scope required or asks for another user's subscriptions"
+// @Failure 500 {object} Problem "Internal error"
 // @Router /subscriptions [post]
 func (s *Server) createSubsription(w http.ResponseWriter, r *http.Request) {
-	s.log.Info("Handling POST request to /api/subscriptions")
+	log := s.logger(r.Context())
+	log.Info("Handling POST request to /api/subscriptions")
 
 	var sub *models.Subscription
 	err := json.NewDecoder(r.Body).Decode(&sub)
+	if err == nil && sub == nil {
+		err = errNullBody
+	}
 	if err != nil {
-		s.handleError(w, r, err.Error(), http.StatusBadRequest)
+		s.handleError(w, r, err)
 		return
 	}
 
 	if err := sub.Parse(); err != nil {
-		s.log.Error("Error while parsing subscription",
-			slog.String("err", err.Error()),
-			slog.String("source", "models/Subscription.Parse"),
-		)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		s.handleError(w, r, err)
 		return
 	}
 
-	if err := s.subsServ.Create(sub); err != nil {
-		s.handleError(w, r, err.Error(), http.StatusInternalServerError)
+	if err := s.subsServ.Create(r.Context(), sub); err != nil {
+		s.handleError(w, r, err)
 		return
 	}
 
-	s.log.Info("Subscription created", slog.Int("id", sub.Id))
-	w.WriteHeader(http.StatusCreated)
+	log.Info("Subscription created", slog.Int("id", sub.Id))
 	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/api/subscriptions/"+strconv.Itoa(sub.Id))
+	w.Header().Set("ETag", etag(sub.Version))
+	w.WriteHeader(http.StatusCreated)
 	if err := json.NewEncoder(w).Encode(map[string]int{"id": sub.Id}); err != nil {
-		s.log.Error("failed to encode response", slog.String("err", err.Error()))
+		log.Error("failed to encode response", slog.String("err", err.Error()))
 	}
 }
 
-// @Summary List all subscriptions
-// @Description Lists all subscriptions
+// @Summary List subscriptions
+// @Description Lists subscriptions page by page. Filters work the same way as in `/subscriptions/calc`. `Last-Modified` is the latest change of a subscription on the page, empty pages have none. Clients polling with `If-Modified-Since` get 304 while no subscription on the page changed, deletions don't count as changes. To fetch only what changed since the last poll, ask with `updated_since`, deleted subscriptions are not reported.
 // @Tags subscriptions
 // @Accept json
 // @Produce json
-// @Success 200 {array} models.Subscription "List of subscriptions"
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Param X-Tenant-ID header string false "Tenant ID for platform admins, the default tenant if omitted. Other callers may only repeat their own"
+// @Param user_id query string false "Filter by user ID"
+// @Param service_name query string false "Filter by service name"
+// @Param start_date query string false "Window start, MM-YYYY"
+// @Param end_date query string false "Window end, MM-YYYY"
+// @Param mode query string false "Window matching mode" Enums(overlap, contain)
+// @Param updated_since query string false "Only subscriptions changed at or after the time, RFC 3339"
+// @Param limit query int false "Page size, up to 1000" default(50)
+// @Param offset query int false "Number of subscriptions to skip" default(0)
+// @Param sort query string false "Sort field, prefix with `-` for descending order" Enums(id, -id, price, -price, start_date, -start_date, service_name, -service_name)
+// @Param If-Modified-Since header string false "Last-Modified of the page the client has"
+// @Success 200 {object} models.SubscriptionPage "Page of subscriptions"
+// @Header 200 {string} Last-Modified "Time of the latest change on the page"
+// @Success 304 {string} string "Page not modified"
+// @Failure 400 {object} Problem "Invalid input"
+// @Failure 401 {object} Problem "Missing or invalid credentials"
+// @Failure 429 {object} Problem "Too many requests"
+// @Failure 403 {object} Problem "Caller lacks the scope required or asks for another user's subscriptions"
+// @Failure 500 {object} Problem "Internal error"
 // @Router /subscriptions [get]
 func (s *Server) listSubscription(w http.ResponseWriter, r *http.Request) {
-	s.log.Info("Handling GET request to /api/subscriptions")
+	log := s.logger(r.Context())
+	log.Info("Handling GET request to /api/subscriptions")
 
-	subs, err := s.subsServ.ListAll()
+	filter, page, err := parseListQuery(r.URL.Query())
 	if err != nil {
-		s.handleError(w, r, err.Error(), http.StatusInternalServerError)
+		s.handleError(w, r, err)
 		return
 	}
 
-	for _, sub := range subs {
+	res, err := s.subsServ.List(r.Context(), filter, page)
+	if err != nil {
+		s.handleError(w, r, err)
+		return
+	}
+
+	for _, sub := range res.Items {
 		sub.Format()
 	}
 
-	s.log.Info("Subscriptions listed", slog.Int("count", len(subs)))
+	log.Info("Subscriptions listed", slog.Int("count", len(res.Items)), slog.Int("total", res.Total))
+	if modified := latestUpdate(res.Items); !modified.IsZero() && checkModified(w, r, modified) {
+		return
+	}
 	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(subs); err != nil {
-		s.log.Error("failed to encode response", slog.String("err", err.Error()))
+	if err := json.NewEncoder(w).Encode(res); err != nil {
+		log.Error("failed to encode response", slog.String("err", err.Error()))
+	}
+}
+
+func parseListQuery(q url.Values) (*models.SubscriptionFilter, *models.Pagination, error) {
+	filter := &models.SubscriptionFilter{
+		Subscription: models.Subscription{
+			UserId:             q.Get("user_id"),
+			ServiceName:        q.Get("service_name"),
+			StartDateFormatted: q.Get("start_date"),
+			EndDateFormatted:   q.Get("end_date"),
+		},
+		Mode: models.FilterMode(q.Get("mode")),
+	}
+	if err := filter.Parse(); err != nil {
+		return nil, nil, err
 	}
+	if v := q.Get("updated_since"); v != "" {
+		since, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return nil, nil, &models.FieldError{Field: "updated_since", Message: "must be an RFC 3339 time", Err: err}
+		}
+		filter.UpdatedSince = &since
+	}
+
+	page := &models.Pagination{Sort: q.Get("sort")}
+	var err error
+	if v := q.Get("limit"); v != "" {
+		if page.Limit, err = strconv.Atoi(v); err != nil {
+			return nil, nil, &models.FieldError{Field: "limit", Message: "must be an integer", Err: models.ErrInvalidPage}
+		}
+	}
+	if v := q.Get("offset"); v != "" {
+		if page.Offset, err = strconv.Atoi(v); err != nil {
+			return nil, nil, &models.FieldError{Field: "offset", Message: "must be an integer", Err: models.ErrInvalidPage}
+		}
+	}
+	if err := page.Parse(); err != nil {
+		return nil, nil, err
+	}
+
+	return filter, page, nil
 }
 
 // @Summary Read a subscription by ID
-// @Description Reads a subscription by ID
+// @Description Reads a subscription by ID. The `ETag` header holds its version for `If-Match` of updates and deletes. Clients polling with `If-Modified-Since` get 304 while the subscription is unchanged.
 // @Tags subscriptions
 // @Accept json
 // @Produce json
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Param X-Tenant-ID header string false "Tenant ID for platform admins, the default tenant if omitted. Other callers may only repeat their own"
+// @Param If-Modified-Since header string false "Last-Modified of the copy the client has"
 // @Param id path int true "Subscription ID"
 // @Success 200 {object} models.Subscription "Subscription details"
-// @Failure 404 {string} string "Subscription not found"
+// @Header 200 {string} ETag "Subscription version"
+// @Header 200 {string} Last-Modified "Time of the last change"
+// @Success 304 {string} string "Subscription not modified"
+// @Failure 404 {object} Problem "Subscription not found"
+// @Failure 401 {object} Problem "Missing or invalid credentials"
+// @Failure 429 {object} Problem "Too many requests"
+// @Failure 403 {object} Problem "Caller lacks the scope required or asks for another user's subscriptions"
+// @Failure 500 {object} Problem "Internal error"
 // @Router /subscriptions/{id} [get]
 func (s *Server) readSubscription(w http.ResponseWriter, r *http.Request) {
-	s.log.Info("Handling GET request to /api/subscriptions/{id}")
+	log := s.logger(r.Context())
+	log.Info("Handling GET request to /api/subscriptions/{id}")
 
 	vars := mux.Vars(r)
-	s.log.Debug("GET /api/subscriptions/{id}", slog.String("id", vars["id"]))
+	log.Debug("GET /api/subscriptions/{id}", slog.String("id", vars["id"]))
 
 	id, err := strconv.Atoi(vars["id"])
 	if err != nil {
-		s.handleError(w, r, err.Error(), http.StatusBadRequest)
+		s.handleError(w, r, errInvalidId)
 		return
 	}
 
-	sub, err := s.subsServ.Read(id)
-	if err == db.ErrNotFound {
-		s.handleError(w, r, err.Error(), http.StatusNotFound)
-		return
-	} else if err != nil {
-		s.handleError(w, r, err.Error(), http.StatusBadRequest)
+	sub, err := s.subsServ.Read(r.Context(), id)
+	if err != nil {
+		s.handleError(w, r, err)
 		return
 	}
 
 	sub.Format()
 
-	s.log.Info("Subscription readed", slog.Int("id", sub.Id))
+	log.Info("Subscription readed", slog.Int("id", sub.Id))
+	w.Header().Set("ETag", etag(sub.Version))
+	if checkModified(w, r, sub.UpdatedAt) {
+		return
+	}
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(sub); err != nil {
-		s.log.Error("failed to encode response", slog.String("err", err.Error()))
+		log.Error("failed to encode response", slog.String("err", err.Error()))
+	}
+}
+
+// @Summary Change history of a subscription
+// @Description Lists changes of a subscription oldest first: who made them, in which request and the subscription before and after. Deleted subscriptions keep their history, subscriptions created before changes were recorded have an empty one. `Last-Modified` is the time of the last change, clients polling with `If-Modified-Since` get 304 until the next one.
+// @Tags subscriptions
+// @Produce json
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Param X-Tenant-ID header string false "Tenant ID for platform admins, the default tenant if omitted. Other callers may only repeat their own"
+// @Param If-Modified-Since header string false "Last-Modified of the history the client has"
+// @Param id path int true "Subscription ID"
+// @Success 200 {array} models.SubscriptionEvent "Subscription events"
+// @Header 200 {string} Last-Modified "Time of the last change"
+// @Success 304 {string} string "History not modified"
+// @Failure 400 {object} Problem "Invalid ID"
+// @Failure 404 {object} Problem "Subscription not found"
+// @Failure 401 {object} Problem "Missing or invalid credentials"
+// @Failure 429 {object} Problem "Too many requests"
+// @Failure 403 {object} Problem "Caller lacks the scope required or asks for another user's subscriptions"
+// @Failure 500 {object} Problem "Internal error"
+// @Router /subscriptions/{id}/history [get]
+func (s *Server) subscriptionHistory(w http.ResponseWriter, r *http.Request) {
+	log := s.logger(r.Context())
+	log.Info("Handling GET request to /api/subscriptions/{id}/history")
+
+	vars := mux.Vars(r)
+	log.Debug("GET /api/subscriptions/{id}/history", slog.String("id", vars["id"]))
+
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		s.handleError(w, r, errInvalidId)
+		return
+	}
+
+	events, err := s.subsServ.History(r.Context(), id)
+	if err != nil {
+		s.handleError(w, r, err)
+		return
+	}
+
+	log.Info("History readed", slog.Int("id", id), slog.Int("events", len(events)))
+	if len(events) > 0 && checkModified(w, r, events[len(events)-1].CreatedAt) {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(events); err != nil {
+		log.Error("failed to encode response", slog.String("err", err.Error()))
 	}
 }
 
 // @Summary Update a subscription by ID
-// @Description Updates a subscription by ID. Needs at least 1 field to update. Send `"end_date": "0"` to set null.
+// @Description Updates a subscription by ID. Needs at least 1 field to update. Send `"end_date": "0"` to set null. Needs `If-Match` with the `ETag` of the version to update, or `*` for any version.
 // @Tags subscriptions
 // @Accept json
 // @Produce json
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Param X-Tenant-ID header string false "Tenant ID for platform admins, the default tenant if omitted. Other callers may only repeat their own"
+// @Param If-Match header string true "ETags of the subscription versions to update or *"
 // @Param id path int true "Subscription ID"
 // @Param subscription body models.Subscription true "Accepted fields of Subscription: `service_name`, `price`, `user_id`, `start_date`, `end_date`"
-// @Success 200 {object} models.Subscription "Updated subscription details"
-// @Failure 400 {string} string "Invalid input"
+// @Success 200 {string} string "Subscription updated"
+// @Header 200 {string} ETag "New subscription version"
+// @Failure 400 {object} Problem "Invalid input"
+// @Failure 404 {object} Problem "Subscription not found"
+// @Failure 409 {object} Problem "Subscription already exists"
+// @Failure 412 {object} Problem "Subscription was changed since the If-Match version"
+// @Failure 428 {object} Problem "If-Match is missing"
+// @Failure 422 {object} Problem "Constraint violation"
+// @Failure 401 {object} Problem "Missing or invalid credentials"
+// @Failure 429 {object} Problem "Too many requests"
+// @Failure 403 {object} Problem "Caller lacks the scope required or asks for another user's subscriptions"
+// @Failure 500 {object} Problem "Internal error"
 // @Router /subscriptions/{id} [patch]
 func (s *Server) updateSubscription(w http.ResponseWriter, r *http.Request) {
-	s.log.Info("Handling PATCH request to /api/subscriptions/{id}")
+	log := s.logger(r.Context())
+	log.Info("Handling PATCH request to /api/subscriptions/{id}")
 
 	vars := mux.Vars(r)
-	s.log.Debug("PATCH /api/subscriptions/{id}", slog.String("id", vars["id"]))
+	log.Debug("PATCH /api/subscriptions/{id}", slog.String("id", vars["id"]))
 
 	id, err := strconv.Atoi(vars["id"])
 	if err != nil {
-		s.handleError(w, r, err.Error(), http.StatusBadRequest)
+		s.handleError(w, r, errInvalidId)
+		return
+	}
+
+	version, err := s.matchVersion(r, id)
+	if err != nil {
+		s.handleError(w, r, err)
 		return
 	}
 
 	var sub *models.Subscription
 	if err := json.NewDecoder(r.Body).Decode(&sub); err != nil {
-		s.handleError(w, r, err.Error(), http.StatusBadRequest)
+		s.handleError(w, r, err)
+		return
+	}
+	if sub == nil {
+		s.handleError(w, r, errNullBody)
 		return
 	}
 
@@ -182,103 +389,174 @@ func (s *Server) updateSubscription(w http.ResponseWriter, r *http.Request) {
 		sub.Price == 0 &&
 		sub.StartDateFormatted == "" &&
 		sub.EndDateFormatted == "" {
-		s.handleError(w, r, "Empty fields", http.StatusBadRequest)
+		s.handleError(w, r, errEmptyUpdate)
 		return
 	}
 
 	if err := sub.Parse(); err != nil {
-		s.log.Error("Error while parsing subscription",
-			slog.String("err", err.Error()),
-			slog.String("source", "models/Subscription.Parse"),
-		)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		s.handleError(w, r, err)
 		return
 	}
 
 	sub.Id = id
-	err = s.subsServ.Update(sub)
-	if err == db.ErrNotFound {
-		s.handleError(w, r, err.Error(), http.StatusNotFound)
-		return
-	} else if err != nil {
-		s.handleError(w, r, err.Error(), http.StatusInternalServerError)
+	sub.Version = version
+	err = s.subsServ.Update(r.Context(), sub)
+	if err != nil {
+		s.handleError(w, r, err)
 		return
 	}
 
-	s.log.Info("Subscription updated", slog.Int("id", sub.Id))
+	log.Info("Subscription updated", slog.Int("id", sub.Id), slog.Int("version", sub.Version))
+	w.Header().Set("ETag", etag(sub.Version))
 	w.WriteHeader(http.StatusOK)
 }
 
 // @Summary Delete a subscription by ID
-// @Description Deletes a subscription by ID
+// @Description Deletes a subscription by ID. Needs `If-Match` with the `ETag` of the version to delete, or `*` for any version.
 // @Tags subscriptions
 // @Accept json
 // @Produce json
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Param X-Tenant-ID header string false "Tenant ID for platform admins, the default tenant if omitted. Other callers may only repeat their own"
+// @Param If-Match header string true "ETags of the subscription versions to delete or *"
 // @Param id path int true "Subscription ID"
 // @Success 204 {string} string "Subscription deleted"
-// @Failure 404 {string} string "Subscription not found"
+// @Failure 400 {object} Problem "Invalid input"
+// @Failure 404 {object} Problem "Subscription not found"
+// @Failure 412 {object} Problem "Subscription was changed since the If-Match version"
+// @Failure 428 {object} Problem "If-Match is missing"
+// @Failure 401 {object} Problem "Missing or invalid credentials"
+// @Failure 429 {object} Problem "Too many requests"
+// @Failure 403 {object} Problem "Caller lacks the scope required or asks for another user's subscriptions"
+// @Failure 500 {object} Problem "Internal error"
 // @Router /subscriptions/{id} [delete]
 func (s *Server) deleteSubscription(w http.ResponseWriter, r *http.Request) {
-	s.log.Info("Handling DELETE request to /api/subscriptions/{id}")
+	log := s.logger(r.Context())
+	log.Info("Handling DELETE request to /api/subscriptions/{id}")
 
 	vars := mux.Vars(r)
-	s.log.Debug("DELETE /api/subscriptions/{id}", slog.String("id", vars["id"]))
+	log.Debug("DELETE /api/subscriptions/{id}", slog.String("id", vars["id"]))
 
 	id, err := strconv.Atoi(vars["id"])
 	if err != nil {
-		s.handleError(w, r, err.Error(), http.StatusBadRequest)
+		s.handleError(w, r, errInvalidId)
 		return
 	}
 
-	err = s.subsServ.Delete(id)
-	if err == db.ErrNotFound {
-		s.handleError(w, r, err.Error(), http.StatusNotFound)
+	version, err := s.matchVersion(r, id)
+	if err != nil {
+		s.handleError(w, r, err)
 		return
-	} else if err != nil {
-		s.handleError(w, r, err.Error(), http.StatusInternalServerError)
+	}
+
+	err = s.subsServ.Delete(r.Context(), id, version)
+	if err != nil {
+		s.handleError(w, r, err)
 		return
 	}
 
-	s.log.Info("Subscription deleted", slog.Int("id", id))
+	log.Info("Subscription deleted", slog.Int("id", id))
 	w.WriteHeader(http.StatusNoContent)
 }
 
 // @Summary Calculate subscription price
-// @Description Calculates the subscription price based on a filter. Looks for all subscriptions with given `user_id` and `service_name` between `start_date` and `end_date`. Fields may be omitted but needs at least 1.
+// @Description Calculates the subscription price based on a filter. Looks for all subscriptions with given `user_id` and `service_name` between `start_date` and `end_date`. Fields may be omitted but needs at least 1. By default (`"mode": "overlap"`) every subscription active at any point of the window is counted, `"mode": "contain"` counts only subscriptions fully contained in the window. Each subscription costs `price` for every month it is active within the window, open-ended subscriptions are counted up to `end_date` (current month in the tenant time zone if omitted). The price is in the tenant `currency`.
 // @Tags subscriptions
 // @Accept json
 // @Produce json
-// @Param filter body models.Subscription true "Filter for subscription calculation"
-// @Success 200 {int} int "Calculated price"
-// @Failure 400 {string} string "Invalid input"
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Param X-Tenant-ID header string false "Tenant ID for platform admins, the default tenant if omitted. Other callers may only repeat their own"
+// @Param filter body models.SubscriptionFilter true "Filter for subscription calculation"
+// @Success 200 {object} map[string]any "Calculated price and its currency"
+// @Failure 400 {object} Problem "Invalid input"
+// @Failure 401 {object} Problem "Missing or invalid credentials"
+// @Failure 429 {object} Problem "Too many requests"
+// @Failure 403 {object} Problem "Caller lacks the scope required or asks for another user's subscriptions"
+// @Failure 500 {object} Problem "Internal error"
 // @Router /subscriptions/calc [post]
 func (s *Server) calculateSubscription(w http.ResponseWriter, r *http.Request) {
-	s.log.Info("Handling POST request to /api/subscriptions/calc")
+	log := s.logger(r.Context())
+	log.Info("Handling POST request to /api/subscriptions/calc")
 
-	var filter *models.Subscription
+	var filter *models.SubscriptionFilter
 	if err := json.NewDecoder(r.Body).Decode(&filter); err != nil {
-		s.handleError(w, r, err.Error(), http.StatusBadRequest)
+		s.handleError(w, r, err)
+		return
+	}
+	if filter == nil {
+		s.handleError(w, r, errNullBody)
+		return
+	}
+
+	if err := filter.Parse(); err != nil {
+		s.handleError(w, r, err)
+		return
+	}
+
+	price, err := s.subsServ.CalculatePrice(r.Context(), filter)
+	if err != nil {
+		s.handleError(w, r, err)
+		return
+	}
+
+	res := map[string]any{"price": price}
+	if t := tenant.FromContext(r.Context()); t != nil {
+		res["currency"] = t.Currency
+	}
+
+	log.Info("Price calculated", slog.Int("price", price))
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(res); err != nil {
+		log.Error("failed to encode response", slog.String("err", err.Error()))
+	}
+}
+
+// @Summary Calculate subscription cost breakdown
+// @Description Splits the cost of subscriptions matching the filter by `service_name`, by `user_id` and by calendar month. Takes the same filter as `/subscriptions/calc`, but `start_date` and `end_date` are required.
+// @Tags subscriptions
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Param X-Tenant-ID header string false "Tenant ID for platform admins, the default tenant if omitted. Other callers may only repeat their own"
+// @Param filter body models.SubscriptionFilter true "Filter for subscription calculation"
+// @Success 200 {object} models.CostBreakdown "Cost breakdown"
+// @Failure 400 {object} Problem "Invalid input"
+// @Failure 401 {object} Problem "Missing or invalid credentials"
+// @Failure 429 {object} Problem "Too many requests"
+// @Failure 403 {object} Problem "Caller lacks the scope required or asks for another user's subscriptions"
+// @Failure 500 {object} Problem "Internal error"
+// @Router /subscriptions/calc/breakdown [post]
+func (s *Server) breakdownSubscription(w http.ResponseWriter, r *http.Request) {
+	log := s.logger(r.Context())
+	log.Info("Handling POST request to /api/subscriptions/calc/breakdown")
+
+	var filter *models.SubscriptionFilter
+	if err := json.NewDecoder(r.Body).Decode(&filter); err != nil {
+		s.handleError(w, r, err)
+		return
+	}
+	if filter == nil {
+		s.handleError(w, r, errNullBody)
 		return
 	}
 
 	if err := filter.Parse(); err != nil {
-		s.log.Error("Error while parsing subscription",
-			slog.String("err", err.Error()),
-			slog.String("source", "models/Subscription.Parse"),
-		)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		s.handleError(w, r, err)
 		return
 	}
 
-	price, err := s.subsServ.CalculatePrice(filter)
+	breakdown, err := s.subsServ.Breakdown(r.Context(), filter)
 	if err != nil {
-		s.handleError(w, r, err.Error(), http.StatusInternalServerError)
+		s.handleError(w, r, err)
 		return
 	}
 
-	s.log.Info("Price calculated", slog.Int("price", price))
+	log.Info("Breakdown calculated", slog.Int("months", len(breakdown.ByMonth)))
 	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(map[string]int{"price": price}); err != nil {
-		s.log.Error("failed to encode response", slog.String("err", err.Error()))
+	if err := json.NewEncoder(w).Encode(breakdown); err != nil {
+		log.Error("failed to encode response", slog.String("err", err.Error()))
 	}
 }
@@ -0,0 +1,66 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHistory(t *testing.T) {
+	ts := newTestServer(t, testOptions{requestLogger: true, auth: true})
+	key := ts.newKey(t.Context(), "admin")
+
+	do := func(method, path, requestId, body string) *httptest.ResponseRecorder {
+		return ts.do(method, path, body, APIKeyHeader, key, IfMatchHeader, "*", RequestIDHeader, requestId)
+	}
+
+	require.Equal(t, http.StatusCreated, do(http.MethodPost, "/api/subscriptions", "create-1", newSub).Code)
+	require.Equal(t, http.StatusOK, do(http.MethodPatch, "/api/subscriptions/1", "update-1", `{"price":500}`).Code)
+	require.Equal(t, http.StatusNoContent, do(http.MethodDelete, "/api/subscriptions/1", "", "").Code)
+
+	w := do(http.MethodGet, "/api/subscriptions/1/history", "", "")
+	require.Equal(t, http.StatusOK, w.Code, "deleted subscriptions keep their history")
+	var events []map[string]any
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&events))
+	require.Len(t, events, 3)
+
+	assert.Equal(t, "create", events[0]["action"])
+	assert.Equal(t, "key:1", events[0]["actor"])
+	assert.Equal(t, "create-1", events[0]["request_id"])
+	assert.Nil(t, events[0]["before"])
+	assert.Equal(t, "07-2025", events[0]["after"].(map[string]any)["start_date"], "snapshots are formatted like responses")
+
+	assert.Equal(t, "update-1", events[1]["request_id"])
+	assert.EqualValues(t, 400, events[1]["before"].(map[string]any)["price"])
+	assert.EqualValues(t, 500, events[1]["after"].(map[string]any)["price"])
+
+	assert.Equal(t, "delete", events[2]["action"])
+	assert.NotEmpty(t, events[2]["request_id"], "generated request IDs are recorded")
+	assert.Nil(t, events[2]["after"])
+	assert.NotContains(t, events[2], "tenant_id")
+
+	assert.Equal(t, http.StatusNotFound, do(http.MethodGet, "/api/subscriptions/2/history", "", "").Code)
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodGet, "/api/subscriptions/x/history", "", "").Code)
+}
+
+func TestNullBody(t *testing.T) {
+	ts := newTestServer(t, testOptions{})
+
+	tests := []struct{ method, path string }{
+		{http.MethodPost, "/api/subscriptions"},
+		{http.MethodPatch, "/api/subscriptions/1"},
+		{http.MethodPost, "/api/subscriptions/calc"},
+		{http.MethodPost, "/api/subscriptions/calc/breakdown"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			w := ts.do(tt.method, tt.path, "null", IfMatchHeader, "*")
+			require.Equal(t, http.StatusBadRequest, w.Code)
+			assert.Equal(t, CodeMalformedBody, problemOf(t, w).Code)
+		})
+	}
+}
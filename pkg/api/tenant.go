@@ -0,0 +1,99 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/EternalQ/effective-mobile-test/pkg/auth"
+	"github.com/EternalQ/effective-mobile-test/pkg/logctx"
+	"github.com/EternalQ/effective-mobile-test/pkg/tenant"
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const TenantHeader = "X-Tenant-ID"
+
+var (
+	errTenantMismatch = errors.New("credentials are bound to another tenant")
+	errTenantRequired = errors.New("bearer token has no tenant claim")
+)
+
+// Tenant resolves the tenant of a request and stores it in the request
+// context. Callers act for the tenant of their API key or token, admins
+// included, X-Tenant-ID may only repeat it, and tokens without a tenant claim
+// are rejected. Platform admins pick a tenant with X-Tenant-ID and default to
+// DefaultID, so do requests without credentials when authentication is
+// disabled. Behind Authenticate.
+func Tenant(log *slog.Logger, tenants *tenant.Registry) mux.MiddlewareFunc {
+	log = log.With(slog.String("where", "api/Tenant"))
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			reqLog := logctx.From(r.Context(), log, "api/Tenant")
+
+			id := strings.ToLower(strings.TrimSpace(r.Header.Get(TenantHeader)))
+			p := auth.FromContext(r.Context())
+			switch {
+			case p == nil, p.Platform():
+			case p.Tenant == "":
+				respondError(reqLog, w, r, errTenantRequired)
+				return
+			case id != "" && id != p.Tenant:
+				respondError(reqLog, w, r, errTenantMismatch)
+				return
+			default:
+				id = p.Tenant
+			}
+
+			t, err := tenants.Lookup(id)
+			if err != nil {
+				respondError(reqLog, w, r, err)
+				return
+			}
+
+			trace.SpanFromContext(r.Context()).SetAttributes(attribute.String("tenant.id", t.Id))
+			ctx := logctx.WithAttrs(r.Context(), slog.String("tenant", t.Id))
+			next.ServeHTTP(w, r.WithContext(tenant.WithTenant(ctx, t)))
+		})
+	}
+}
+
+type TenantServer struct {
+	log *slog.Logger
+}
+
+// StartTenant registers the tenant settings route on the /api subrouter.
+func StartTenant(log *slog.Logger, api *mux.Router) {
+	s := &TenantServer{
+		log.With(slog.String("where", "api/TenantServer")),
+	}
+
+	api.HandleFunc("/tenant", s.currentTenant).Methods("GET")
+}
+
+// @Summary Current tenant
+// @Description Returns the tenant the request is resolved to and its defaults. API keys act for the tenant they were created in, bearer tokens for their `tenant` claim. Platform admins, the bootstrap key and admin tokens without a `tenant` claim, pick a tenant with the `X-Tenant-ID` header.
+// @Tags tenants
+// @Produce json
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Param X-Tenant-ID header string false "Tenant ID for platform admins, the default tenant if omitted. Other callers may only repeat their own"
+// @Success 200 {object} tenant.Tenant "Tenant settings"
+// @Failure 400 {object} Problem "Invalid tenant ID"
+// @Failure 401 {object} Problem "Missing or invalid credentials"
+// @Failure 429 {object} Problem "Too many requests"
+// @Failure 403 {object} Problem "Unknown tenant, credentials bound to another tenant or token without a tenant"
+// @Router /tenant [get]
+func (s *TenantServer) currentTenant(w http.ResponseWriter, r *http.Request) {
+	log := logctx.From(r.Context(), s.log, "api/TenantServer")
+	log.Info("Handling GET request to /api/tenant")
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(tenant.FromContext(r.Context())); err != nil {
+		log.Error("failed to encode response", slog.String("err", err.Error()))
+	}
+}
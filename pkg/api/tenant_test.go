@@ -0,0 +1,128 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/EternalQ/effective-mobile-test/pkg/auth"
+	"github.com/EternalQ/effective-mobile-test/pkg/models"
+	"github.com/EternalQ/effective-mobile-test/pkg/service"
+	"github.com/EternalQ/effective-mobile-test/pkg/tenant"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTenant(t *testing.T) {
+	tenants, err := tenant.NewRegistry(tenant.Tenant{Currency: "RUB", TimeZone: "UTC"}, []*tenant.Tenant{
+		{Id: "acme", Currency: "USD"},
+		{Id: "retail"},
+	})
+	require.NoError(t, err)
+	ts := newTestServer(t, testOptions{auth: true, bearer: true, tenants: tenants})
+
+	inTenant := func(id string) context.Context {
+		return tenant.WithTenant(t.Context(), &tenant.Tenant{Id: id})
+	}
+	retailKey, adminKey := ts.newKey(inTenant("retail"), "write"), ts.newKey(inTenant(tenant.DefaultID), "admin")
+	platformKey := auth.KeyPrefix + strings.Repeat("p", service.MinBootstrapKeyLength)
+	require.NoError(t, ts.keyServ.Bootstrap(t.Context(), platformKey))
+	acmeToken := newToken(t, jwt.MapClaims{"sub": testUser, "tenant": "acme"})
+	acmeAdminToken := newToken(t, jwt.MapClaims{"sub": testUser, "tenant": "acme", "scope": "admin"})
+	untenantedToken := newToken(t, jwt.MapClaims{"sub": testUser})
+	platformToken := newToken(t, jwt.MapClaims{"sub": testUser, "scope": "admin"})
+
+	// credentials starting with emk_ are API keys, others bearer tokens.
+	do := func(method, path, tenantId, body, credentials string) *httptest.ResponseRecorder {
+		if strings.HasPrefix(credentials, auth.KeyPrefix) {
+			return ts.do(method, path, body, APIKeyHeader, credentials, TenantHeader, tenantId)
+		}
+		return ts.do(method, path, body, "Authorization", "Bearer "+credentials, TenantHeader, tenantId)
+	}
+	tenantOf := func(w *httptest.ResponseRecorder) string {
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var got tenant.Tenant
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&got))
+		return got.Id
+	}
+
+	t.Run("settings", func(t *testing.T) {
+		w := do(http.MethodGet, "/api/tenant", "", "", adminKey)
+		require.Equal(t, http.StatusOK, w.Code)
+		var got tenant.Tenant
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&got))
+		assert.Equal(t, tenant.Tenant{Id: tenant.DefaultID, Currency: "RUB", TimeZone: "UTC"}, got)
+
+		w = do(http.MethodGet, "/api/tenant", "", "", acmeToken)
+		require.Equal(t, http.StatusOK, w.Code)
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&got))
+		assert.Equal(t, "acme", got.Id)
+		assert.Equal(t, "USD", got.Currency)
+	})
+
+	t.Run("resolved", func(t *testing.T) {
+		assert.Equal(t, "retail", tenantOf(do(http.MethodGet, "/api/tenant", "", "", retailKey)), "keys act for their tenant")
+		assert.Equal(t, "retail", tenantOf(do(http.MethodGet, "/api/tenant", "retail", "", retailKey)))
+		assert.Equal(t, "acme", tenantOf(do(http.MethodGet, "/api/tenant", "", "", acmeAdminToken)), "admins act for their tenant")
+		assert.Equal(t, "acme", tenantOf(do(http.MethodGet, "/api/tenant", "acme", "", platformKey)), "platform admins pick a tenant")
+		assert.Equal(t, "acme", tenantOf(do(http.MethodGet, "/api/tenant", "acme", "", platformToken)))
+		assert.Equal(t, tenant.DefaultID, tenantOf(do(http.MethodGet, "/api/tenant", "", "", platformToken)))
+	})
+
+	t.Run("rejected", func(t *testing.T) {
+		tests := []struct {
+			name        string
+			tenantId    string
+			credentials string
+			want        int
+		}{
+			{"invalid ID", "Not a slug", platformKey, http.StatusBadRequest},
+			{"unknown tenant", "other", platformKey, http.StatusForbidden},
+			{"key of another tenant", "acme", retailKey, http.StatusForbidden},
+			{"token of another tenant", "retail", acmeToken, http.StatusForbidden},
+			{"token without tenant", "", untenantedToken, http.StatusForbidden},
+			{"admin key of another tenant", "acme", adminKey, http.StatusForbidden},
+			{"admin token of another tenant", "retail", acmeAdminToken, http.StatusForbidden},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				w := do(http.MethodGet, "/api/tenant", tt.tenantId, "", tt.credentials)
+				assert.Equal(t, tt.want, w.Code, w.Body.String())
+			})
+		}
+	})
+
+	t.Run("isolation", func(t *testing.T) {
+		w := do(http.MethodPost, "/api/subscriptions", "", newSub, retailKey)
+		require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+
+		w = do(http.MethodGet, "/api/subscriptions/1", "", "", retailKey)
+		assert.Equal(t, http.StatusOK, w.Code)
+		w = do(http.MethodGet, "/api/subscriptions/1", "", "", acmeToken)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		w = do(http.MethodGet, "/api/subscriptions/1", "", "", adminKey)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		w = do(http.MethodGet, "/api/subscriptions/1", "retail", "", platformKey)
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("key isolation", func(t *testing.T) {
+		w := do(http.MethodGet, "/api/keys", "", "", adminKey)
+		require.Equal(t, http.StatusOK, w.Code)
+		var keys []models.APIKey
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&keys))
+		require.Len(t, keys, 1, "keys of other tenants aren't listed")
+
+		retailKeys, err := ts.keyServ.List(inTenant("retail"))
+		require.NoError(t, err)
+		require.Len(t, retailKeys, 1)
+		w = do(http.MethodDelete, "/api/keys/"+strconv.Itoa(retailKeys[0].Id), "", "", adminKey)
+		assert.Equal(t, http.StatusNotFound, w.Code, "keys of other tenants can't be revoked")
+		assert.Equal(t, "retail", tenantOf(do(http.MethodGet, "/api/tenant", "", "", retailKey)))
+	})
+}
@@ -0,0 +1,108 @@
+// Package auth holds the authenticated caller of a request and API key
+// helpers.
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"strconv"
+
+	"github.com/EternalQ/effective-mobile-test/pkg/models"
+)
+
+const (
+	KeyPrefix = "emk_"
+
+	// displayLength is the length of the key start kept in plain text.
+	displayLength = len(KeyPrefix) + 6
+)
+
+// Principal is the authenticated caller.
+type Principal struct {
+	// KeyId is the ID of the API key used, zero for other credentials.
+	KeyId int
+	// Subject is the user ID a bearer token was issued to or an API key is
+	// bound to. Only admin callers may have none.
+	Subject string
+	// Tenant is the tenant the API key was created in or a bearer token is
+	// bound to. Only platform admins have none, see Platform.
+	Tenant string
+	Name   string
+	Scopes models.Scopes
+}
+
+// RestrictedTo returns the user ID the caller may only access the
+// subscriptions of, empty for admins and requests without credentials. Every
+// other caller is bound to a user, API keys included.
+func (p *Principal) RestrictedTo() string {
+	if p == nil || p.Scopes.Allows(models.ScopeAdmin) {
+		return ""
+	}
+	return p.Subject
+}
+
+// Platform reports whether the caller is a platform admin, an admin bound to
+// no tenant. Only platform admins may act for any tenant, other admins manage
+// their own.
+func (p *Principal) Platform() bool {
+	return p != nil && p.Tenant == "" && p.Scopes.Allows(models.ScopeAdmin)
+}
+
+// Anonymous is the actor of requests without credentials.
+const Anonymous = "anonymous"
+
+// Actor names the caller in audit records: the API key or the token
+// subject, Anonymous without credentials.
+func (p *Principal) Actor() string {
+	switch {
+	case p == nil:
+		return Anonymous
+	case p.KeyId != 0:
+		return "key:" + strconv.Itoa(p.KeyId)
+	case p.Subject != "":
+		return "sub:" + p.Subject
+	default:
+		return Anonymous
+	}
+}
+
+type ctxKey struct{}
+
+// WithPrincipal returns a copy of ctx carrying p.
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, ctxKey{}, p)
+}
+
+// FromContext returns the caller stored in ctx, nil for unauthenticated
+// requests.
+func FromContext(ctx context.Context) *Principal {
+	p, _ := ctx.Value(ctxKey{}).(*Principal)
+	return p
+}
+
+// GenerateKey returns a new random API key.
+func GenerateKey() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return KeyPrefix + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// HashKey returns the hex SHA-256 of key. Keys are random, so a fast hash
+// is enough to keep them out of the database.
+func HashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// DisplayPrefix returns the start of key safe to show and store.
+func DisplayPrefix(key string) string {
+	if len(key) < displayLength {
+		return key[:len(key)/2]
+	}
+	return key[:displayLength]
+}
@@ -0,0 +1,190 @@
+package auth
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/EternalQ/effective-mobile-test/pkg/models"
+	"github.com/EternalQ/effective-mobile-test/pkg/tenant"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	ErrInvalidToken = errors.New("invalid bearer token")
+	ErrNoJWTKeys    = errors.New("neither HS256 secret nor JWKS file is configured")
+)
+
+var subjectRe = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// JWTConfig configures token verification. At least one of Secret and
+// JWKSFile must be set.
+type JWTConfig struct {
+	// Secret verifies HS256 tokens.
+	Secret string
+	// JWKSFile is a local JSON Web Key Set with RSA keys verifying RS256
+	// tokens, picked by the token kid header.
+	JWKSFile string
+	// Issuer and Audience are checked when set.
+	Issuer   string
+	Audience string
+	Leeway   time.Duration
+}
+
+// Verifier checks bearer tokens and turns them into principals.
+type Verifier struct {
+	secret  []byte
+	rsaKeys map[string]*rsa.PublicKey
+	parser  *jwt.Parser
+}
+
+type claims struct {
+	jwt.RegisteredClaims
+	// Scope is a space separated list of scopes, as in OAuth 2.0.
+	Scope string `json:"scope"`
+	Name  string `json:"name"`
+	// Tenant binds the token to a tenant, see tenant.Tenant.
+	Tenant string `json:"tenant"`
+}
+
+func NewVerifier(cfg JWTConfig) (*Verifier, error) {
+	v := &Verifier{rsaKeys: map[string]*rsa.PublicKey{}}
+	methods := []string{}
+
+	if cfg.Secret != "" {
+		v.secret = []byte(cfg.Secret)
+		methods = append(methods, jwt.SigningMethodHS256.Alg())
+	}
+	if cfg.JWKSFile != "" {
+		keys, err := LoadJWKS(cfg.JWKSFile)
+		if err != nil {
+			return nil, err
+		}
+		v.rsaKeys = keys
+		methods = append(methods, jwt.SigningMethodRS256.Alg())
+	}
+	if len(methods) == 0 {
+		return nil, ErrNoJWTKeys
+	}
+
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods(methods),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(cfg.Leeway),
+	}
+	if cfg.Issuer != "" {
+		opts = append(opts, jwt.WithIssuer(cfg.Issuer))
+	}
+	if cfg.Audience != "" {
+		opts = append(opts, jwt.WithAudience(cfg.Audience))
+	}
+	v.parser = jwt.NewParser(opts...)
+
+	return v, nil
+}
+
+func (v *Verifier) key(t *jwt.Token) (any, error) {
+	switch t.Method.Alg() {
+	case jwt.SigningMethodHS256.Alg():
+		return v.secret, nil
+	case jwt.SigningMethodRS256.Alg():
+		kid, _ := t.Header["kid"].(string)
+		if key, ok := v.rsaKeys[kid]; ok {
+			return key, nil
+		}
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	default:
+		return nil, fmt.Errorf("unexpected signing method %s", t.Method.Alg())
+	}
+}
+
+// Verify checks the token signature and claims. The subject must be the
+// user ID the caller acts for. Without a scope claim the caller gets write
+// access to its own subscriptions. Admin tokens without a tenant claim are
+// platform admins, see Principal.Platform, api.Tenant rejects other tokens
+// without one.
+func (v *Verifier) Verify(token string) (*Principal, error) {
+	var c claims
+	if _, err := v.parser.ParseWithClaims(token, &c, v.key); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+	if !subjectRe.MatchString(c.Subject) {
+		return nil, fmt.Errorf("%w: subject must be a user UUID", ErrInvalidToken)
+	}
+
+	c.Tenant = strings.ToLower(c.Tenant)
+	if c.Tenant != "" && !tenant.ValidID(c.Tenant) {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidToken, tenant.ErrInvalidID)
+	}
+
+	scopes := models.Scopes{models.ScopeWrite}
+	if c.Scope != "" {
+		var err error
+		scopes, err = models.ParseScopes(strings.Fields(c.Scope))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+		}
+	}
+
+	return &Principal{
+		Name:    c.Name,
+		Subject: strings.ToLower(c.Subject),
+		Tenant:  c.Tenant,
+		Scopes:  scopes,
+	}, nil
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+// LoadJWKS reads RSA public keys from a JSON Web Key Set file. Keys of other
+// types or meant for encryption are skipped.
+func LoadJWKS(path string) (map[string]*rsa.PublicKey, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read JWKS: %w", err)
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(raw, &set); err != nil {
+		return nil, fmt.Errorf("parse JWKS: %w", err)
+	}
+
+	keys := map[string]*rsa.PublicKey{}
+	for _, k := range set.Keys {
+		if k.Kty != "RSA" || (k.Use != "" && k.Use != "sig") || (k.Alg != "" && k.Alg != "RS256") {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("parse JWKS key %q modulus: %w", k.Kid, err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("parse JWKS key %q exponent: %w", k.Kid, err)
+		}
+		keys[k.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("JWKS %s has no RSA signing keys", path)
+	}
+	return keys, nil
+}
@@ -0,0 +1,152 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/EternalQ/effective-mobile-test/pkg/models"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testUser = "60601FEE-2bf1-4721-ae6f-7636e79a0cba"
+
+func sign(t *testing.T, method jwt.SigningMethod, key any, kid string, claims jwt.MapClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	s, err := token.SignedString(key)
+	require.NoError(t, err)
+	return s
+}
+
+func validClaims() jwt.MapClaims {
+	return jwt.MapClaims{
+		"sub": testUser,
+		"iss": "issuer",
+		"aud": "api",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}
+}
+
+func writeJWKS(t *testing.T, kid string, key *rsa.PublicKey) string {
+	t.Helper()
+	set := map[string]any{"keys": []map[string]string{{
+		"kty": "RSA",
+		"kid": kid,
+		"use": "sig",
+		"alg": "RS256",
+		"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}}}
+	raw, err := json.Marshal(set)
+	require.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	require.NoError(t, os.WriteFile(path, raw, 0o600))
+	return path
+}
+
+func TestVerifier(t *testing.T) {
+	secret := []byte("test-secret")
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	v, err := NewVerifier(JWTConfig{
+		Secret:   string(secret),
+		JWKSFile: writeJWKS(t, "k1", &rsaKey.PublicKey),
+		Issuer:   "issuer",
+		Audience: "api",
+	})
+	require.NoError(t, err)
+
+	t.Run("HS256", func(t *testing.T) {
+		p, err := v.Verify(sign(t, jwt.SigningMethodHS256, secret, "", validClaims()))
+		require.NoError(t, err)
+		assert.Equal(t, "60601fee-2bf1-4721-ae6f-7636e79a0cba", p.Subject)
+		assert.Equal(t, models.Scopes{models.ScopeWrite}, p.Scopes)
+		assert.Equal(t, p.Subject, p.RestrictedTo())
+	})
+
+	t.Run("RS256", func(t *testing.T) {
+		claims := validClaims()
+		claims["scope"] = "read admin"
+		claims["tenant"] = "Acme"
+		p, err := v.Verify(sign(t, jwt.SigningMethodRS256, rsaKey, "k1", claims))
+		require.NoError(t, err)
+		assert.Equal(t, models.Scopes{models.ScopeRead, models.ScopeAdmin}, p.Scopes)
+		assert.Equal(t, "acme", p.Tenant)
+		assert.Empty(t, p.RestrictedTo())
+	})
+
+	invalid := map[string]func() string{
+		"wrong secret": func() string {
+			return sign(t, jwt.SigningMethodHS256, []byte("other"), "", validClaims())
+		},
+		"unknown kid": func() string {
+			return sign(t, jwt.SigningMethodRS256, rsaKey, "k2", validClaims())
+		},
+		"wrong RSA key": func() string {
+			return sign(t, jwt.SigningMethodRS256, otherKey, "k1", validClaims())
+		},
+		"unsigned": func() string {
+			return sign(t, jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, "", validClaims())
+		},
+		"expired": func() string {
+			claims := validClaims()
+			claims["exp"] = time.Now().Add(-time.Hour).Unix()
+			return sign(t, jwt.SigningMethodHS256, secret, "", claims)
+		},
+		"no expiry": func() string {
+			claims := validClaims()
+			delete(claims, "exp")
+			return sign(t, jwt.SigningMethodHS256, secret, "", claims)
+		},
+		"wrong audience": func() string {
+			claims := validClaims()
+			claims["aud"] = "other"
+			return sign(t, jwt.SigningMethodHS256, secret, "", claims)
+		},
+		"subject is not a user": func() string {
+			claims := validClaims()
+			claims["sub"] = "admin"
+			return sign(t, jwt.SigningMethodHS256, secret, "", claims)
+		},
+		"unknown scope": func() string {
+			claims := validClaims()
+			claims["scope"] = "root"
+			return sign(t, jwt.SigningMethodHS256, secret, "", claims)
+		},
+		"invalid tenant": func() string {
+			claims := validClaims()
+			claims["tenant"] = "../acme"
+			return sign(t, jwt.SigningMethodHS256, secret, "", claims)
+		},
+	}
+	for name, token := range invalid {
+		t.Run(name, func(t *testing.T) {
+			_, err := v.Verify(token())
+			assert.ErrorIs(t, err, ErrInvalidToken)
+		})
+	}
+}
+
+func TestNewVerifier(t *testing.T) {
+	_, err := NewVerifier(JWTConfig{})
+	assert.ErrorIs(t, err, ErrNoJWTKeys)
+
+	_, err = NewVerifier(JWTConfig{JWKSFile: filepath.Join(t.TempDir(), "missing.json")})
+	assert.Error(t, err)
+}
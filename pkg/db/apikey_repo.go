@@ -0,0 +1,160 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"time"
+
+	"github.com/EternalQ/effective-mobile-test/pkg/logctx"
+	"github.com/EternalQ/effective-mobile-test/pkg/models"
+	"github.com/EternalQ/effective-mobile-test/pkg/tenant"
+	"github.com/jmoiron/sqlx"
+)
+
+// APIKeyRepo stores API keys in Postgres or SQLite, queries are rebound to
+// the driver placeholders.
+type APIKeyRepo struct {
+	db      *sqlx.DB
+	timeout time.Duration
+	log     *slog.Logger
+}
+
+func NewAPIKeyRepo(db *sqlx.DB, timeout time.Duration, log *slog.Logger) *APIKeyRepo {
+	return &APIKeyRepo{
+		db,
+		timeout,
+		log.With(slog.String("where", "db/APIKeyRepo")),
+	}
+}
+
+func (r *APIKeyRepo) logger(ctx context.Context) *slog.Logger {
+	return logctx.From(ctx, r.log, "db/APIKeyRepo")
+}
+
+func (r *APIKeyRepo) queryContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if r.timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, r.timeout)
+}
+
+// system names the database for spans.
+func (r *APIKeyRepo) system() string {
+	if r.db.DriverName() == "postgres" {
+		return "postgresql"
+	}
+	return r.db.DriverName()
+}
+
+var createAPIKey = `
+INSERT INTO api_keys (name, prefix, key_hash, scopes, user_id, tenant_id, created_at)
+VALUES (?, ?, ?, ?, ?, ?, ?)
+RETURNING id`
+
+func (r *APIKeyRepo) CreateKey(ctx context.Context, key *models.APIKey) error {
+	log := r.logger(ctx)
+	ctx, cancel := r.queryContext(ctx)
+	defer cancel()
+
+	query := r.db.Rebind(createAPIKey)
+	qctx, span := startQuery(ctx, r.system(), "CreateKey", query)
+	err := r.db.GetContext(qctx, &key.Id, query, key.Name, key.Prefix, key.Hash, key.Scopes, key.UserId, key.TenantId, key.CreatedAt)
+	endQuery(span, err)
+	if err != nil {
+		log.Error("Error while creating entity",
+			slog.String("err", err.Error()),
+			slog.String("method", "CreateKey"),
+		)
+		return classify(err)
+	}
+
+	return nil
+}
+
+var listAPIKeys = `
+SELECT *
+FROM api_keys
+WHERE tenant_id = ?
+ORDER BY id`
+
+func (r *APIKeyRepo) ListKeys(ctx context.Context) ([]*models.APIKey, error) {
+	log := r.logger(ctx)
+	ctx, cancel := r.queryContext(ctx)
+	defer cancel()
+
+	keys := []*models.APIKey{}
+	query := r.db.Rebind(listAPIKeys)
+	qctx, span := startQuery(ctx, r.system(), "ListKeys", query)
+	err := r.db.SelectContext(qctx, &keys, query, tenant.ID(ctx))
+	endQuery(span, err)
+	if err != nil {
+		log.Error("Error while listing entity",
+			slog.String("err", err.Error()),
+			slog.String("method", "ListKeys"),
+		)
+		return nil, classify(err)
+	}
+
+	return keys, nil
+}
+
+var revokeAPIKey = `
+UPDATE api_keys
+SET revoked_at = COALESCE(revoked_at, ?)
+WHERE id = ? AND tenant_id = ?`
+
+func (r *APIKeyRepo) RevokeKey(ctx context.Context, id int, at time.Time) error {
+	log := r.logger(ctx)
+	ctx, cancel := r.queryContext(ctx)
+	defer cancel()
+
+	query := r.db.Rebind(revokeAPIKey)
+	qctx, span := startQuery(ctx, r.system(), "RevokeKey", query)
+	res, err := r.db.ExecContext(qctx, query, at, id, tenant.ID(ctx))
+	endQuery(span, err)
+	if err != nil {
+		log.Error("Error while updating entity",
+			slog.String("err", err.Error()),
+			slog.String("method", "RevokeKey"),
+		)
+		return classify(err)
+	}
+
+	n, _ := res.RowsAffected()
+	if n == 0 {
+		log.Debug("Nothing revoked",
+			slog.String("method", "RevokeKey"),
+		)
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+var findAPIKey = `
+SELECT *
+FROM api_keys
+WHERE key_hash = ?`
+
+func (r *APIKeyRepo) FindKey(ctx context.Context, hash string) (*models.APIKey, error) {
+	log := r.logger(ctx)
+	ctx, cancel := r.queryContext(ctx)
+	defer cancel()
+
+	var key models.APIKey
+	query := r.db.Rebind(findAPIKey)
+	qctx, span := startQuery(ctx, r.system(), "FindKey", query)
+	err := r.db.GetContext(qctx, &key, query, hash)
+	endQuery(span, err)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		log.Error("Error while getting entity",
+			slog.String("err", err.Error()),
+			slog.String("method", "FindKey"),
+		)
+		return nil, classify(err)
+	}
+	return &key, nil
+}
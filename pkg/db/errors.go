@@ -0,0 +1,147 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/lib/pq"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// Domain errors a classified database error may match with errors.Is.
+var (
+	ErrInvalidInput = errors.New("invalid input value")
+	ErrConstraint   = errors.New("constraint violation")
+	ErrConflict     = errors.New("entity already exists")
+	ErrReference    = errors.New("referenced entity does not exist")
+	ErrTimeout      = errors.New("query timed out")
+)
+
+// PostgreSQL error codes, see https://www.postgresql.org/docs/current/errcodes-appendix.html
+const (
+	pgInvalidTextRepresentation = "22P02"
+	pgInvalidDatetimeFormat     = "22007"
+	pgNumericValueOutOfRange    = "22003"
+	pgNotNullViolation          = "23502"
+	pgForeignKeyViolation       = "23503"
+	pgUniqueViolation           = "23505"
+	pgCheckViolation            = "23514"
+	pgQueryCanceled             = "57014"
+	pgUndefinedTable            = "42P01"
+)
+
+// constraintFields maps table constraints to the fields they guard.
+var constraintFields = map[string]string{
+	"subscriptions_price_check": "price",
+}
+
+// typeFields maps column types to the field holding them when the driver
+// does not report the column of a malformed value.
+var typeFields = map[string]string{
+	"uuid": "user_id",
+}
+
+// Error is a database error classified into one of the domain errors.
+// Field names the offending input field when it is known.
+type Error struct {
+	Kind  error
+	Field string
+	Err   error
+}
+
+func (e *Error) Error() string {
+	return e.Kind.Error() + ": " + e.Err.Error()
+}
+
+func (e *Error) Unwrap() []error {
+	return []error{e.Kind, e.Err}
+}
+
+// classify wraps driver errors with a known meaning into *Error and returns
+// any other error as is.
+func classify(err error) error {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return &Error{Kind: ErrTimeout, Err: err}
+	}
+
+	var sqliteErr *sqlite.Error
+	if errors.As(err, &sqliteErr) {
+		return classifySQLite(err, sqliteErr)
+	}
+
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return err
+	}
+
+	var kind error
+	switch pqErr.Code {
+	case pgInvalidTextRepresentation, pgInvalidDatetimeFormat, pgNumericValueOutOfRange:
+		kind = ErrInvalidInput
+	case pgCheckViolation, pgNotNullViolation:
+		kind = ErrConstraint
+	case pgUniqueViolation:
+		kind = ErrConflict
+	case pgForeignKeyViolation:
+		kind = ErrReference
+	case pgQueryCanceled:
+		kind = ErrTimeout
+	default:
+		return err
+	}
+
+	field := pqErr.Column
+	if field == "" {
+		field = constraintFields[pqErr.Constraint]
+	}
+	if field == "" && kind == ErrInvalidInput {
+		for typ, f := range typeFields {
+			if strings.Contains(pqErr.Message, "type "+typ) {
+				field = f
+				break
+			}
+		}
+	}
+
+	return &Error{Kind: kind, Field: field, Err: err}
+}
+
+// classifySQLite is classify for SQLite errors. SQLite reports the failed
+// constraint in the message as "CHECK constraint failed: name" or
+// "NOT NULL constraint failed: table.column".
+func classifySQLite(err error, sqliteErr *sqlite.Error) error {
+	var kind error
+	switch sqliteErr.Code() {
+	case sqlite3.SQLITE_CONSTRAINT_CHECK, sqlite3.SQLITE_CONSTRAINT_NOTNULL:
+		kind = ErrConstraint
+	case sqlite3.SQLITE_CONSTRAINT_UNIQUE, sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY:
+		kind = ErrConflict
+	case sqlite3.SQLITE_CONSTRAINT_FOREIGNKEY:
+		kind = ErrReference
+	default:
+		return err
+	}
+
+	var field string
+	if _, failed, ok := strings.Cut(sqliteErr.Error(), "constraint failed: "); ok {
+		name, _, _ := strings.Cut(failed, " ")
+		if _, column, ok := strings.Cut(name, "."); ok {
+			field = column
+		} else {
+			field = constraintFields[name]
+		}
+	}
+
+	return &Error{Kind: kind, Field: field, Err: err}
+}
+
+func isUndefinedTable(err error) bool {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Code == pgUndefinedTable
+	}
+	var sqliteErr *sqlite.Error
+	return errors.As(err, &sqliteErr) && strings.Contains(sqliteErr.Error(), "no such table")
+}
@@ -0,0 +1,79 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+
+		wantKind  error
+		wantField string
+	}{
+		{
+			name:      "check violation",
+			err:       &pq.Error{Code: pgCheckViolation, Constraint: "subscriptions_price_check"},
+			wantKind:  ErrConstraint,
+			wantField: "price",
+		},
+		{
+			name:      "malformed uuid",
+			err:       &pq.Error{Code: pgInvalidTextRepresentation, Message: `invalid input syntax for type uuid: "abc"`},
+			wantKind:  ErrInvalidInput,
+			wantField: "user_id",
+		},
+		{
+			name:      "not null",
+			err:       &pq.Error{Code: pgNotNullViolation, Column: "service_name"},
+			wantKind:  ErrConstraint,
+			wantField: "service_name",
+		},
+		{
+			name:     "unique violation",
+			err:      fmt.Errorf("insert: %w", &pq.Error{Code: pgUniqueViolation}),
+			wantKind: ErrConflict,
+		},
+		{
+			name:     "foreign key violation",
+			err:      &pq.Error{Code: pgForeignKeyViolation},
+			wantKind: ErrReference,
+		},
+		{
+			name:     "query canceled",
+			err:      &pq.Error{Code: pgQueryCanceled},
+			wantKind: ErrTimeout,
+		},
+		{
+			name:     "deadline exceeded",
+			err:      fmt.Errorf("select: %w", context.DeadlineExceeded),
+			wantKind: ErrTimeout,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := classify(tt.err)
+			assert.ErrorIs(t, got, tt.wantKind)
+
+			var dbErr *Error
+			if assert.ErrorAs(t, got, &dbErr) {
+				assert.Equal(t, tt.wantField, dbErr.Field)
+			}
+		})
+	}
+
+	t.Run("unknown", func(t *testing.T) {
+		err := errors.New("connection refused")
+		assert.Equal(t, err, classify(err))
+
+		pqErr := &pq.Error{Code: "42P01"}
+		assert.Equal(t, error(pqErr), classify(pqErr))
+	})
+}
@@ -0,0 +1,83 @@
+package db
+
+import (
+	"context"
+
+	"github.com/EternalQ/effective-mobile-test/pkg/auth"
+	"github.com/EternalQ/effective-mobile-test/pkg/logctx"
+	"github.com/EternalQ/effective-mobile-test/pkg/models"
+	"github.com/EternalQ/effective-mobile-test/pkg/tenant"
+	"github.com/jmoiron/sqlx"
+)
+
+// newEvent describes a change of a subscription by the caller of ctx.
+// before is nil for creations, after for deletions.
+func newEvent(ctx context.Context, action models.EventAction, before, after *models.Subscription) (*models.SubscriptionEvent, error) {
+	e := &models.SubscriptionEvent{
+		TenantId:  tenant.ID(ctx),
+		Action:    action,
+		Actor:     auth.FromContext(ctx).Actor(),
+		RequestId: logctx.RequestID(ctx),
+	}
+
+	var err error
+	if e.Before, err = models.NewSnapshot(before); err != nil {
+		return nil, err
+	}
+	if e.After, err = models.NewSnapshot(after); err != nil {
+		return nil, err
+	}
+	if after != nil {
+		e.SubscriptionId = after.Id
+	} else {
+		e.SubscriptionId = before.Id
+	}
+	return e, nil
+}
+
+var createEvent = `
+INSERT INTO subscription_events (tenant_id, subscription_id, action, actor, request_id, before, after)
+VALUES (?, ?, ?, ?, ?, ?, ?)`
+
+// recordEvent appends the event of a change in the transaction making it.
+func recordEvent(ctx context.Context, tx *sqlx.Tx, action models.EventAction, before, after *models.Subscription) error {
+	e, err := newEvent(ctx, action, before, after)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, tx.Rebind(createEvent), e.TenantId, e.SubscriptionId, e.Action, e.Actor, e.RequestId, e.Before, e.After)
+	return err
+}
+
+var subscriptionHistory = `
+SELECT *
+FROM subscription_events
+WHERE subscription_id = ? AND tenant_id = ?
+ORDER BY id`
+
+var countSubscription = `
+SELECT COUNT(*)
+FROM subscriptions
+WHERE id = ? AND tenant_id = ?`
+
+// readHistory returns the events of subscription id in the tenant of ctx.
+// Subscriptions created before events were recorded have none, only a
+// subscription without a row either is reported as ErrNotFound.
+func readHistory(ctx context.Context, tx *sqlx.Tx, id int) ([]*models.SubscriptionEvent, error) {
+	events := []*models.SubscriptionEvent{}
+	if err := tx.SelectContext(ctx, &events, tx.Rebind(subscriptionHistory), id, tenant.ID(ctx)); err != nil {
+		return nil, err
+	}
+	if len(events) > 0 {
+		return events, nil
+	}
+
+	var n int
+	if err := tx.GetContext(ctx, &n, tx.Rebind(countSubscription), id, tenant.ID(ctx)); err != nil {
+		return nil, err
+	}
+	if n == 0 {
+		return nil, ErrNotFound
+	}
+	return events, nil
+}
@@ -0,0 +1,10 @@
+package db
+
+// ClearEvents forgets the recorded events, as if the subscriptions were
+// created before events were recorded.
+func (r *MemoryRepo) ClearEvents() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.events = nil
+}
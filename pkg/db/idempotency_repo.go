@@ -0,0 +1,201 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"time"
+
+	"github.com/EternalQ/effective-mobile-test/pkg/logctx"
+	"github.com/EternalQ/effective-mobile-test/pkg/models"
+	"github.com/jmoiron/sqlx"
+)
+
+// reserveAttempts bounds ReserveKey retries when the conflicting key is
+// released between the insert and the read. A key that keeps churning is
+// reported as pending.
+const reserveAttempts = 3
+
+// IdempotencyRepo stores idempotency keys in Postgres or SQLite, queries are
+// rebound to the driver placeholders.
+type IdempotencyRepo struct {
+	db      *sqlx.DB
+	timeout time.Duration
+	log     *slog.Logger
+}
+
+func NewIdempotencyRepo(db *sqlx.DB, timeout time.Duration, log *slog.Logger) *IdempotencyRepo {
+	return &IdempotencyRepo{
+		db,
+		timeout,
+		log.With(slog.String("where", "db/IdempotencyRepo")),
+	}
+}
+
+func (r *IdempotencyRepo) logger(ctx context.Context) *slog.Logger {
+	return logctx.From(ctx, r.log, "db/IdempotencyRepo")
+}
+
+func (r *IdempotencyRepo) queryContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if r.timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, r.timeout)
+}
+
+// system names the database for spans.
+func (r *IdempotencyRepo) system() string {
+	if r.db.DriverName() == "postgres" {
+		return "postgresql"
+	}
+	return r.db.DriverName()
+}
+
+var deleteStaleKey = `
+DELETE FROM idempotency_keys
+WHERE tenant_id = ? AND client = ? AND key = ?
+	AND (expires_at <= ? OR (status = 0 AND created_at <= ?))`
+
+var insertIdempotencyKey = `
+INSERT INTO idempotency_keys (tenant_id, client, key, request_hash, status, created_at, expires_at)
+VALUES (?, ?, ?, ?, 0, ?, ?)
+ON CONFLICT DO NOTHING`
+
+var readIdempotencyKey = `
+SELECT *
+FROM idempotency_keys
+WHERE tenant_id = ? AND client = ? AND key = ?`
+
+func (r *IdempotencyRepo) ReserveKey(ctx context.Context, key *models.IdempotencyKey, staleBefore time.Time) (*models.IdempotencyKey, error) {
+	log := r.logger(ctx)
+	ctx, cancel := r.queryContext(ctx)
+	defer cancel()
+
+	fail := func(err error, msg string) (*models.IdempotencyKey, error) {
+		log.Error(msg,
+			slog.String("err", err.Error()),
+			slog.String("method", "ReserveKey"),
+		)
+		return nil, classify(err)
+	}
+
+	query := r.db.Rebind(deleteStaleKey)
+	qctx, span := startQuery(ctx, r.system(), "ReserveKey", query)
+	_, err := r.db.ExecContext(qctx, query, key.TenantId, key.Client, key.Key, key.CreatedAt, staleBefore)
+	endQuery(span, err)
+	if err != nil {
+		return fail(err, "Error while deleting entity")
+	}
+
+	for range reserveAttempts {
+		query = r.db.Rebind(insertIdempotencyKey)
+		qctx, span = startQuery(ctx, r.system(), "ReserveKey", query)
+		res, err := r.db.ExecContext(qctx, query, key.TenantId, key.Client, key.Key, key.RequestHash, key.CreatedAt, key.ExpiresAt)
+		endQuery(span, err)
+		if err != nil {
+			return fail(err, "Error while creating entity")
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			return nil, nil
+		}
+
+		var stored models.IdempotencyKey
+		query = r.db.Rebind(readIdempotencyKey)
+		qctx, span = startQuery(ctx, r.system(), "ReserveKey", query)
+		err = r.db.GetContext(qctx, &stored, query, key.TenantId, key.Client, key.Key)
+		endQuery(span, err)
+		if err == sql.ErrNoRows {
+			continue
+		} else if err != nil {
+			return fail(err, "Error while getting entity")
+		}
+		return &stored, nil
+	}
+
+	log.Debug("Key released while reserving", slog.String("method", "ReserveKey"))
+	pending := *key
+	pending.Status = 0
+	return &pending, nil
+}
+
+var completeIdempotencyKey = `
+UPDATE idempotency_keys
+SET status = ?, headers = ?, response = ?
+WHERE tenant_id = ? AND client = ? AND key = ? AND status = 0`
+
+func (r *IdempotencyRepo) CompleteKey(ctx context.Context, key *models.IdempotencyKey) error {
+	log := r.logger(ctx)
+	ctx, cancel := r.queryContext(ctx)
+	defer cancel()
+
+	query := r.db.Rebind(completeIdempotencyKey)
+	qctx, span := startQuery(ctx, r.system(), "CompleteKey", query)
+	res, err := r.db.ExecContext(qctx, query, key.Status, key.Headers, key.Response, key.TenantId, key.Client, key.Key)
+	endQuery(span, err)
+	if err != nil {
+		log.Error("Error while updating entity",
+			slog.String("err", err.Error()),
+			slog.String("method", "CompleteKey"),
+		)
+		return classify(err)
+	}
+
+	n, _ := res.RowsAffected()
+	if n == 0 {
+		log.Debug("Nothing updated",
+			slog.String("method", "CompleteKey"),
+		)
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+var releaseIdempotencyKey = `
+DELETE FROM idempotency_keys
+WHERE tenant_id = ? AND client = ? AND key = ? AND status = 0`
+
+func (r *IdempotencyRepo) ReleaseKey(ctx context.Context, key *models.IdempotencyKey) error {
+	log := r.logger(ctx)
+	ctx, cancel := r.queryContext(ctx)
+	defer cancel()
+
+	query := r.db.Rebind(releaseIdempotencyKey)
+	qctx, span := startQuery(ctx, r.system(), "ReleaseKey", query)
+	_, err := r.db.ExecContext(qctx, query, key.TenantId, key.Client, key.Key)
+	endQuery(span, err)
+	if err != nil {
+		log.Error("Error while deleting entity",
+			slog.String("err", err.Error()),
+			slog.String("method", "ReleaseKey"),
+		)
+		return classify(err)
+	}
+
+	return nil
+}
+
+var purgeIdempotencyKeys = `
+DELETE FROM idempotency_keys
+WHERE expires_at <= ?`
+
+func (r *IdempotencyRepo) PurgeKeys(ctx context.Context, at time.Time) (int, error) {
+	log := r.logger(ctx)
+	ctx, cancel := r.queryContext(ctx)
+	defer cancel()
+
+	query := r.db.Rebind(purgeIdempotencyKeys)
+	qctx, span := startQuery(ctx, r.system(), "PurgeKeys", query)
+	res, err := r.db.ExecContext(qctx, query, at)
+	endQuery(span, err)
+	if err != nil {
+		log.Error("Error while deleting entities",
+			slog.String("err", err.Error()),
+			slog.String("method", "PurgeKeys"),
+		)
+		return 0, classify(err)
+	}
+
+	n, _ := res.RowsAffected()
+	return int(n), nil
+}
@@ -0,0 +1,103 @@
+package db
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/EternalQ/effective-mobile-test/pkg/logctx"
+	"github.com/EternalQ/effective-mobile-test/pkg/models"
+	"github.com/EternalQ/effective-mobile-test/pkg/tenant"
+)
+
+// MemoryAPIKeyRepo keeps API keys in memory. It mirrors APIKeyRepo
+// semantics and is safe for concurrent use.
+type MemoryAPIKeyRepo struct {
+	mu     sync.RWMutex
+	lastId int
+	keys   map[int]*models.APIKey
+	log    *slog.Logger
+}
+
+func NewMemoryAPIKeyRepo(log *slog.Logger) *MemoryAPIKeyRepo {
+	return &MemoryAPIKeyRepo{
+		keys: map[int]*models.APIKey{},
+		log:  log.With(slog.String("where", "db/MemoryAPIKeyRepo")),
+	}
+}
+
+func (r *MemoryAPIKeyRepo) logger(ctx context.Context) *slog.Logger {
+	return logctx.From(ctx, r.log, "db/MemoryAPIKeyRepo")
+}
+
+func storedKey(key *models.APIKey) *models.APIKey {
+	c := *key
+	c.Scopes = append(models.Scopes{}, key.Scopes...)
+	c.CreatedAt = key.CreatedAt.UTC()
+	if key.RevokedAt != nil {
+		at := key.RevokedAt.UTC()
+		c.RevokedAt = &at
+	}
+	return &c
+}
+
+func (r *MemoryAPIKeyRepo) CreateKey(ctx context.Context, key *models.APIKey) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, k := range r.keys {
+		if k.Hash == key.Hash {
+			return &Error{Kind: ErrConflict, Field: "key_hash", Err: ErrConflict}
+		}
+	}
+
+	r.lastId++
+	key.Id = r.lastId
+	r.keys[key.Id] = storedKey(key)
+	return nil
+}
+
+func (r *MemoryAPIKeyRepo) ListKeys(ctx context.Context) ([]*models.APIKey, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	keys := []*models.APIKey{}
+	for id := 1; id <= r.lastId; id++ {
+		if k, ok := r.keys[id]; ok && k.TenantId == tenant.ID(ctx) {
+			keys = append(keys, storedKey(k))
+		}
+	}
+	return keys, nil
+}
+
+func (r *MemoryAPIKeyRepo) RevokeKey(ctx context.Context, id int, at time.Time) error {
+	log := r.logger(ctx)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	k, ok := r.keys[id]
+	if !ok || k.TenantId != tenant.ID(ctx) {
+		log.Debug("Nothing revoked",
+			slog.String("method", "RevokeKey"),
+		)
+		return ErrNotFound
+	}
+	if k.RevokedAt == nil {
+		at = at.UTC()
+		k.RevokedAt = &at
+	}
+	return nil
+}
+
+func (r *MemoryAPIKeyRepo) FindKey(ctx context.Context, hash string) (*models.APIKey, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, k := range r.keys {
+		if k.Hash == hash {
+			return storedKey(k), nil
+		}
+	}
+	return nil, nil
+}
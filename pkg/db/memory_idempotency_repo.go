@@ -0,0 +1,110 @@
+package db
+
+import (
+	"context"
+	"log/slog"
+	"maps"
+	"sync"
+	"time"
+
+	"github.com/EternalQ/effective-mobile-test/pkg/logctx"
+	"github.com/EternalQ/effective-mobile-test/pkg/models"
+)
+
+type idempotencyId struct {
+	tenant, client, key string
+}
+
+func idOf(key *models.IdempotencyKey) idempotencyId {
+	return idempotencyId{key.TenantId, key.Client, key.Key}
+}
+
+// MemoryIdempotencyRepo keeps idempotency keys in memory. It mirrors
+// IdempotencyRepo semantics and is safe for concurrent use.
+type MemoryIdempotencyRepo struct {
+	mu   sync.Mutex
+	keys map[idempotencyId]*models.IdempotencyKey
+	log  *slog.Logger
+}
+
+func NewMemoryIdempotencyRepo(log *slog.Logger) *MemoryIdempotencyRepo {
+	return &MemoryIdempotencyRepo{
+		keys: map[idempotencyId]*models.IdempotencyKey{},
+		log:  log.With(slog.String("where", "db/MemoryIdempotencyRepo")),
+	}
+}
+
+func (r *MemoryIdempotencyRepo) logger(ctx context.Context) *slog.Logger {
+	return logctx.From(ctx, r.log, "db/MemoryIdempotencyRepo")
+}
+
+func storedIdempotencyKey(key *models.IdempotencyKey) *models.IdempotencyKey {
+	c := *key
+	c.Headers = maps.Clone(key.Headers)
+	c.Response = append([]byte(nil), key.Response...)
+	c.CreatedAt = key.CreatedAt.UTC()
+	c.ExpiresAt = key.ExpiresAt.UTC()
+	return &c
+}
+
+func (r *MemoryIdempotencyRepo) ReserveKey(ctx context.Context, key *models.IdempotencyKey, staleBefore time.Time) (*models.IdempotencyKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	id := idOf(key)
+	if stored, ok := r.keys[id]; ok {
+		stale := !stored.ExpiresAt.After(key.CreatedAt) || (stored.Pending() && !stored.CreatedAt.After(staleBefore))
+		if !stale {
+			return storedIdempotencyKey(stored), nil
+		}
+	}
+
+	c := storedIdempotencyKey(key)
+	c.Status = 0
+	c.Headers = nil
+	c.Response = nil
+	r.keys[id] = c
+	return nil, nil
+}
+
+func (r *MemoryIdempotencyRepo) CompleteKey(ctx context.Context, key *models.IdempotencyKey) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.keys[idOf(key)]
+	if !ok || !stored.Pending() {
+		r.logger(ctx).Debug("Nothing updated",
+			slog.String("method", "CompleteKey"),
+		)
+		return ErrNotFound
+	}
+	stored.Status = key.Status
+	stored.Headers = maps.Clone(key.Headers)
+	stored.Response = append([]byte(nil), key.Response...)
+	return nil
+}
+
+func (r *MemoryIdempotencyRepo) ReleaseKey(ctx context.Context, key *models.IdempotencyKey) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	id := idOf(key)
+	if stored, ok := r.keys[id]; ok && stored.Pending() {
+		delete(r.keys, id)
+	}
+	return nil
+}
+
+func (r *MemoryIdempotencyRepo) PurgeKeys(ctx context.Context, at time.Time) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	n := 0
+	for id, key := range r.keys {
+		if !key.ExpiresAt.After(at) {
+			delete(r.keys, id)
+			n++
+		}
+	}
+	return n, nil
+}
@@ -0,0 +1,397 @@
+package db
+
+import (
+	"cmp"
+	"context"
+	"log/slog"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/EternalQ/effective-mobile-test/pkg/logctx"
+	"github.com/EternalQ/effective-mobile-test/pkg/models"
+	"github.com/EternalQ/effective-mobile-test/pkg/tenant"
+)
+
+var uuidRe = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// MemoryRepo keeps subscriptions in memory. It mirrors SubscriptionRepo
+// semantics, including the errors Postgres constraints would produce, and is
+// safe for concurrent use.
+type MemoryRepo struct {
+	mu            sync.RWMutex
+	lastId        int
+	subscriptions map[int]*models.Subscription
+	events        []*models.SubscriptionEvent
+	log           *slog.Logger
+}
+
+func NewMemoryRepo(log *slog.Logger) *MemoryRepo {
+	return &MemoryRepo{
+		subscriptions: map[int]*models.Subscription{},
+		log:           log.With(slog.String("where", "db/MemoryRepo")),
+	}
+}
+
+func (r *MemoryRepo) logger(ctx context.Context) *slog.Logger {
+	return logctx.From(ctx, r.log, "db/MemoryRepo")
+}
+
+// stored returns a copy of s the way Postgres would return it.
+func stored(s *models.Subscription) *models.Subscription {
+	c := &models.Subscription{
+		Id:          s.Id,
+		ServiceName: s.ServiceName,
+		Price:       s.Price,
+		UserId:      strings.ToLower(s.UserId),
+		TenantId:    s.TenantId,
+		Version:     s.Version,
+		StartDate:   s.StartDate.UTC(),
+		CreatedAt:   s.CreatedAt.UTC(),
+		UpdatedAt:   s.UpdatedAt.UTC(),
+	}
+	if s.EndDate != nil {
+		end := s.EndDate.UTC()
+		c.EndDate = &end
+	}
+	return c
+}
+
+// scopedFilter returns a copy of filter limited to the tenant of ctx.
+func scopedFilter(ctx context.Context, filter *models.SubscriptionFilter) *models.SubscriptionFilter {
+	scoped := models.SubscriptionFilter{}
+	if filter != nil {
+		scoped = *filter
+	}
+	scoped.TenantId = tenant.ID(ctx)
+	return &scoped
+}
+
+func checkUserId(id string) error {
+	if !uuidRe.MatchString(id) {
+		return &Error{Kind: ErrInvalidInput, Field: "user_id", Err: ErrInvalidInput}
+	}
+	return nil
+}
+
+func checkPrice(price int) error {
+	if price <= 0 {
+		return &Error{Kind: ErrConstraint, Field: "price", Err: ErrConstraint}
+	}
+	return nil
+}
+
+// record appends the event of a change. Called with mu held.
+func (r *MemoryRepo) record(ctx context.Context, action models.EventAction, before, after *models.Subscription) error {
+	e, err := newEvent(ctx, action, before, after)
+	if err != nil {
+		return err
+	}
+	e.Id = len(r.events) + 1
+	e.CreatedAt = time.Now().UTC()
+	r.events = append(r.events, e)
+	return nil
+}
+
+func (r *MemoryRepo) Create(ctx context.Context, s *models.Subscription) error {
+	if err := checkUserId(s.UserId); err != nil {
+		return err
+	}
+	if err := checkPrice(s.Price); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.lastId++
+	s.Id = r.lastId
+	s.UserId = strings.ToLower(s.UserId)
+	s.TenantId = tenant.ID(ctx)
+	s.Version = 1
+	s.CreatedAt = time.Now().UTC()
+	s.UpdatedAt = s.CreatedAt
+	r.subscriptions[s.Id] = stored(s)
+
+	return r.record(ctx, models.EventCreate, nil, s)
+}
+
+func (r *MemoryRepo) Read(ctx context.Context, id int) (*models.Subscription, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	s, ok := r.subscriptions[id]
+	if !ok || s.TenantId != tenant.ID(ctx) {
+		return nil, ErrNotFound
+	}
+	return stored(s), nil
+}
+
+func (r *MemoryRepo) Update(ctx context.Context, subscription *models.Subscription, owner string) error {
+	log := r.logger(ctx)
+	if subscription.UserId != "" {
+		if err := checkUserId(subscription.UserId); err != nil {
+			return err
+		}
+	}
+	if subscription.Price != 0 {
+		if err := checkPrice(subscription.Price); err != nil {
+			return err
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	current, ok := r.subscriptions[subscription.Id]
+	if !ok || current.TenantId != tenant.ID(ctx) || !owns(current, owner) {
+		log.Debug("Nothing updated",
+			slog.String("method", "Update"),
+		)
+		return ErrNotFound
+	}
+	if subscription.Version != 0 && subscription.Version != current.Version {
+		log.Debug("Version mismatch",
+			slog.String("method", "Update"),
+		)
+		return ErrVersionMismatch
+	}
+
+	s := stored(current)
+	s.Version++
+	s.UpdatedAt = time.Now().UTC()
+	if subscription.UserId != "" {
+		s.UserId = subscription.UserId
+	}
+	if subscription.ServiceName != "" {
+		s.ServiceName = subscription.ServiceName
+	}
+	if subscription.Price != 0 {
+		s.Price = subscription.Price
+	}
+	if !subscription.StartDate.IsZero() {
+		s.StartDate = subscription.StartDate
+	}
+	if subscription.EndDateFormatted == "0" {
+		s.EndDate = nil
+	} else if subscription.EndDate != nil && !subscription.EndDate.IsZero() {
+		s.EndDate = subscription.EndDate
+	}
+	r.subscriptions[s.Id] = stored(s)
+	subscription.Version = s.Version
+
+	return r.record(ctx, models.EventUpdate, current, s)
+}
+
+func (r *MemoryRepo) Delete(ctx context.Context, id, version int, owner string) error {
+	log := r.logger(ctx)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s, ok := r.subscriptions[id]
+	if !ok || s.TenantId != tenant.ID(ctx) || !owns(s, owner) {
+		log.Debug("Nothing deleted",
+			slog.String("method", "Delete"),
+		)
+		return ErrNotFound
+	}
+	if version != 0 && version != s.Version {
+		log.Debug("Version mismatch",
+			slog.String("method", "Delete"),
+		)
+		return ErrVersionMismatch
+	}
+	delete(r.subscriptions, id)
+
+	return r.record(ctx, models.EventDelete, s, nil)
+}
+
+func (r *MemoryRepo) History(ctx context.Context, id int) ([]*models.SubscriptionEvent, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	events := []*models.SubscriptionEvent{}
+	for _, e := range r.events {
+		if e.SubscriptionId == id && e.TenantId == tenant.ID(ctx) {
+			c := *e
+			events = append(events, &c)
+		}
+	}
+	if s, ok := r.subscriptions[id]; len(events) == 0 && (!ok || s.TenantId != tenant.ID(ctx)) {
+		return nil, ErrNotFound
+	}
+	return events, nil
+}
+
+// owns reports whether s belongs to owner, any subscription does when owner
+// is empty.
+func owns(s *models.Subscription, owner string) bool {
+	return owner == "" || strings.EqualFold(s.UserId, owner)
+}
+
+// matches mirrors filterConditions.
+func matches(filter *models.SubscriptionFilter, s *models.Subscription) bool {
+	if filter.TenantId != "" && s.TenantId != filter.TenantId {
+		return false
+	}
+	if filter.UserId != "" && !strings.EqualFold(s.UserId, filter.UserId) {
+		return false
+	}
+	if filter.ServiceName != "" && s.ServiceName != filter.ServiceName {
+		return false
+	}
+	if filter.UpdatedSince != nil && s.UpdatedAt.Before(*filter.UpdatedSince) {
+		return false
+	}
+
+	hasStart := !filter.StartDate.IsZero()
+	hasEnd := filter.EndDate != nil && !filter.EndDate.IsZero()
+	if filter.Mode == models.FilterContain {
+		if hasStart && s.StartDate.Before(filter.StartDate) {
+			return false
+		}
+		if hasEnd && (s.EndDate == nil || s.EndDate.After(*filter.EndDate)) {
+			return false
+		}
+	} else {
+		if hasStart && s.EndDate != nil && s.EndDate.Before(filter.StartDate) {
+			return false
+		}
+		if hasEnd && s.StartDate.After(*filter.EndDate) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// filtered returns copies of subscriptions of the tenant of ctx matching the
+// filter ordered by id.
+func (r *MemoryRepo) filtered(ctx context.Context, filter *models.SubscriptionFilter) ([]*models.Subscription, error) {
+	filter = scopedFilter(ctx, filter)
+	if filter.UserId != "" {
+		if err := checkUserId(filter.UserId); err != nil {
+			return nil, err
+		}
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	subs := []*models.Subscription{}
+	for _, s := range r.subscriptions {
+		if matches(filter, s) {
+			subs = append(subs, stored(s))
+		}
+	}
+	slices.SortFunc(subs, func(a, b *models.Subscription) int {
+		return cmp.Compare(a.Id, b.Id)
+	})
+	return subs, nil
+}
+
+func (r *MemoryRepo) List(ctx context.Context, filter *models.SubscriptionFilter, page *models.Pagination) ([]*models.Subscription, error) {
+	subs, err := r.filtered(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	if page == nil {
+		return subs, nil
+	}
+
+	field, desc := page.SortField()
+	if !slices.Contains(models.SortFields, field) {
+		return nil, models.ErrInvalidSort
+	}
+	slices.SortStableFunc(subs, func(a, b *models.Subscription) int {
+		var c int
+		switch field {
+		case "price":
+			c = cmp.Compare(a.Price, b.Price)
+		case "start_date":
+			c = a.StartDate.Compare(b.StartDate)
+		case "service_name":
+			c = strings.Compare(a.ServiceName, b.ServiceName)
+		}
+		if c == 0 {
+			c = cmp.Compare(a.Id, b.Id)
+		}
+		if desc {
+			return -c
+		}
+		return c
+	})
+
+	start := min(page.Offset, len(subs))
+	end := min(start+page.Limit, len(subs))
+	return subs[start:end], nil
+}
+
+func (r *MemoryRepo) Count(ctx context.Context, filter *models.SubscriptionFilter) (int, error) {
+	subs, err := r.filtered(ctx, filter)
+	if err != nil {
+		return 0, err
+	}
+	return len(subs), nil
+}
+
+// Breakdown mirrors the SQL aggregation of SubscriptionRepo.Breakdown.
+func (r *MemoryRepo) Breakdown(ctx context.Context, filter *models.SubscriptionFilter) (*models.CostBreakdown, error) {
+	subs, err := r.filtered(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	from, to := filter.StartDate, *filter.EndDate
+	byService := map[string]*models.CostGroup{}
+	byUser := map[string]*models.CostGroup{}
+	add := func(groups map[string]*models.CostGroup, key string, total int) {
+		g, ok := groups[key]
+		if !ok {
+			g = &models.CostGroup{Key: key}
+			groups[key] = g
+		}
+		g.Count++
+		g.Total += total
+	}
+
+	breakdown := &models.CostBreakdown{ByMonth: []*models.CostGroup{}}
+	for _, s := range subs {
+		months := s.ActiveMonths(from, to)
+		if months <= 0 {
+			continue
+		}
+		add(byService, s.ServiceName, s.Price*months)
+		add(byUser, s.UserId, s.Price*months)
+	}
+
+	first := time.Date(from.Year(), from.Month(), 1, 0, 0, 0, 0, time.UTC)
+	last := time.Date(to.Year(), to.Month(), 1, 0, 0, 0, 0, time.UTC)
+	for m := first; !m.After(last); m = m.AddDate(0, 1, 0) {
+		g := &models.CostGroup{Key: m.Format(models.SubscrTimeLayout)}
+		for _, s := range subs {
+			if s.ActiveMonths(m, m) > 0 {
+				g.Count++
+				g.Total += s.Price
+			}
+		}
+		breakdown.ByMonth = append(breakdown.ByMonth, g)
+	}
+
+	breakdown.ByService = sortedGroups(byService)
+	breakdown.ByUser = sortedGroups(byUser)
+	return breakdown, nil
+}
+
+func sortedGroups(groups map[string]*models.CostGroup) []*models.CostGroup {
+	res := make([]*models.CostGroup, 0, len(groups))
+	for _, g := range groups {
+		res = append(res, g)
+	}
+	slices.SortFunc(res, func(a, b *models.CostGroup) int {
+		return strings.Compare(a.Key, b.Key)
+	})
+	return res
+}
@@ -0,0 +1,67 @@
+package db_test
+
+import (
+	"log/slog"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/EternalQ/effective-mobile-test/pkg/db"
+	"github.com/EternalQ/effective-mobile-test/pkg/db/repotest"
+	"github.com/EternalQ/effective-mobile-test/pkg/models"
+	"github.com/EternalQ/effective-mobile-test/pkg/service"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryRepo(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	repotest.Run(t, func(t *testing.T) service.Repository {
+		return db.NewMemoryRepo(logger)
+	})
+}
+
+func TestMemoryRepo_Unrecorded(t *testing.T) {
+	repo := db.NewMemoryRepo(slog.New(slog.NewTextHandler(os.Stdout, nil)))
+	repotest.RunUnrecorded(t, repo, func(t *testing.T) { repo.ClearEvents() })
+}
+
+func TestMemoryAPIKeyRepo(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	repotest.RunKeys(t, func(t *testing.T) service.KeyRepository {
+		return db.NewMemoryAPIKeyRepo(logger)
+	})
+}
+
+func TestMemoryIdempotencyRepo(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	repotest.RunIdempotency(t, func(t *testing.T) service.IdempotencyRepository {
+		return db.NewMemoryIdempotencyRepo(logger)
+	})
+}
+
+func TestMemoryRepo_Concurrent(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	repo := db.NewMemoryRepo(logger)
+
+	var wg sync.WaitGroup
+	for range 50 {
+		wg.Go(func() {
+			s := &models.Subscription{
+				ServiceName: "Yandex Plus",
+				Price:       400,
+				UserId:      "60601fee-2bf1-4721-ae6f-7636e79a0cba",
+				StartDate:   time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC),
+			}
+			assert.Nil(t, repo.Create(t.Context(), s))
+			assert.Nil(t, repo.Update(t.Context(), &models.Subscription{Id: s.Id, Price: 500}, ""))
+			_, err := repo.List(t.Context(), nil, &models.Pagination{Limit: 10, Sort: "-price"})
+			assert.Nil(t, err)
+		})
+	}
+	wg.Wait()
+
+	count, err := repo.Count(t.Context(), nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 50, count)
+}
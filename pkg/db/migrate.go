@@ -0,0 +1,231 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// ErrNoMigration is returned by Down when there is nothing to revert.
+var ErrNoMigration = errors.New("no migration to revert")
+
+// migrationLock is a key of the advisory lock held by Postgres migrations,
+// so replicas starting together don't migrate at once.
+const migrationLock = 7_240_511
+
+type Migration struct {
+	Version uint
+	Name    string
+	Up      string
+	Down    string
+}
+
+type MigrationStatus struct {
+	Version uint
+	Dirty   bool
+	Latest  uint
+	Pending []*Migration
+}
+
+// Migrator applies SQL migrations named NNNNNN_name.up.sql and
+// NNNNNN_name.down.sql, keeping the applied version in schema_migrations.
+type Migrator struct {
+	db         *sqlx.DB
+	migrations []*Migration
+	log        *slog.Logger
+}
+
+func NewMigrator(db *sqlx.DB, fsys fs.FS, log *slog.Logger) (*Migrator, error) {
+	migrations, err := loadMigrations(fsys)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{
+		db,
+		migrations,
+		log.With(slog.String("where", "db/Migrator")),
+	}, nil
+}
+
+func loadMigrations(fsys fs.FS) ([]*Migration, error) {
+	files, err := fs.Glob(fsys, "*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[uint]*Migration{}
+	for _, f := range files {
+		base, direction, ok := strings.Cut(strings.TrimSuffix(f, ".sql"), ".")
+		if !ok || (direction != "up" && direction != "down") {
+			return nil, fmt.Errorf("migration %s: expected .up.sql or .down.sql suffix", f)
+		}
+		prefix, name, _ := strings.Cut(base, "_")
+		v, err := strconv.ParseUint(prefix, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("migration %s: invalid version: %w", f, err)
+		}
+
+		body, err := fs.ReadFile(fsys, path.Clean(f))
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[uint(v)]
+		if !ok {
+			m = &Migration{Version: uint(v), Name: name}
+			byVersion[uint(v)] = m
+		}
+		if direction == "up" {
+			m.Up = string(body)
+		} else {
+			m.Down = string(body)
+		}
+	}
+
+	migrations := make([]*Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration %d_%s: missing up migration", m.Version, m.Name)
+		}
+		migrations = append(migrations, m)
+	}
+	slices.SortFunc(migrations, func(a, b *Migration) int {
+		return int(a.Version) - int(b.Version)
+	})
+	return migrations, nil
+}
+
+var createSchemaMigrations = `
+CREATE TABLE IF NOT EXISTS schema_migrations (
+    version BIGINT NOT NULL PRIMARY KEY,
+    dirty BOOLEAN NOT NULL
+)`
+
+var lockMigrations = `SELECT pg_advisory_xact_lock($1)`
+
+var setSchemaVersion = `INSERT INTO schema_migrations (version, dirty) VALUES (?, FALSE)`
+
+// Up applies every pending migration, each one in its own transaction.
+func (m *Migrator) Up(ctx context.Context) error {
+	for {
+		applied, err := m.step(ctx, func(version uint) (*Migration, uint, string) {
+			for _, mg := range m.migrations {
+				if mg.Version > version {
+					return mg, mg.Version, mg.Up
+				}
+			}
+			return nil, 0, ""
+		})
+		if err != nil {
+			return err
+		}
+		if applied == nil {
+			return nil
+		}
+		m.log.Info("Migration applied", slog.Uint64("version", uint64(applied.Version)), slog.String("name", applied.Name))
+	}
+}
+
+// Down reverts the latest applied migration.
+func (m *Migrator) Down(ctx context.Context) error {
+	reverted, err := m.step(ctx, func(version uint) (*Migration, uint, string) {
+		for i, mg := range m.migrations {
+			if mg.Version == version {
+				prev := uint(0)
+				if i > 0 {
+					prev = m.migrations[i-1].Version
+				}
+				return mg, prev, mg.Down
+			}
+		}
+		return nil, 0, ""
+	})
+	if err != nil {
+		return err
+	}
+	if reverted == nil {
+		return ErrNoMigration
+	}
+
+	m.log.Info("Migration reverted", slog.Uint64("version", uint64(reverted.Version)), slog.String("name", reverted.Name))
+	return nil
+}
+
+// step runs a single migration picked by next for the current version and
+// moves the schema to the returned target version.
+func (m *Migrator) step(ctx context.Context, next func(version uint) (*Migration, uint, string)) (*Migration, error) {
+	tx, err := m.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if m.db.DriverName() == "postgres" {
+		if _, err := tx.ExecContext(ctx, lockMigrations, migrationLock); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := tx.ExecContext(ctx, createSchemaMigrations); err != nil {
+		return nil, err
+	}
+
+	version, dirty, err := schemaVersionTx(ctx, tx)
+	if err != nil && !errors.Is(err, ErrNoSchema) {
+		return nil, err
+	}
+	if dirty {
+		return nil, fmt.Errorf("schema version %d is dirty, fix it manually", version)
+	}
+
+	mg, target, body := next(version)
+	if mg == nil {
+		return nil, tx.Commit()
+	}
+
+	if strings.TrimSpace(body) != "" {
+		if _, err := tx.ExecContext(ctx, body); err != nil {
+			m.log.Error("Error while migrating",
+				slog.String("err", err.Error()),
+				slog.Uint64("version", uint64(mg.Version)),
+			)
+			return nil, fmt.Errorf("migration %d_%s: %w", mg.Version, mg.Name, err)
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM schema_migrations"); err != nil {
+		return nil, err
+	}
+	if target > 0 {
+		if _, err := tx.ExecContext(ctx, tx.Rebind(setSchemaVersion), target); err != nil {
+			return nil, err
+		}
+	}
+
+	return mg, tx.Commit()
+}
+
+// Status reports the applied version and migrations waiting to be applied.
+func (m *Migrator) Status(ctx context.Context) (*MigrationStatus, error) {
+	version, dirty, err := SchemaVersion(ctx, m.db)
+	if err != nil && !errors.Is(err, ErrNoSchema) {
+		return nil, err
+	}
+
+	status := &MigrationStatus{Version: version, Dirty: dirty}
+	for _, mg := range m.migrations {
+		status.Latest = max(status.Latest, mg.Version)
+		if mg.Version > version {
+			status.Pending = append(status.Pending, mg)
+		}
+	}
+	return status, nil
+}
@@ -0,0 +1,45 @@
+package db
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	t.Run("sorted by version", func(t *testing.T) {
+		fsys := fstest.MapFS{
+			"000010_later.up.sql":   {Data: []byte("CREATE TABLE b ();")},
+			"000002_init.up.sql":    {Data: []byte("CREATE TABLE a ();")},
+			"000002_init.down.sql":  {Data: []byte("DROP TABLE a;")},
+			"000010_later.down.sql": {Data: []byte("")},
+		}
+
+		got, err := loadMigrations(fsys)
+
+		assert.Nil(t, err)
+		if assert.Len(t, got, 2) {
+			assert.Equal(t, &Migration{Version: 2, Name: "init", Up: "CREATE TABLE a ();", Down: "DROP TABLE a;"}, got[0])
+			assert.Equal(t, &Migration{Version: 10, Name: "later", Up: "CREATE TABLE b ();"}, got[1])
+		}
+	})
+
+	t.Run("missing up", func(t *testing.T) {
+		fsys := fstest.MapFS{
+			"000001_init.down.sql": {Data: []byte("DROP TABLE a;")},
+		}
+
+		_, err := loadMigrations(fsys)
+		assert.Error(t, err)
+	})
+
+	t.Run("invalid name", func(t *testing.T) {
+		fsys := fstest.MapFS{
+			"init.up.sql": {Data: []byte("CREATE TABLE a ();")},
+		}
+
+		_, err := loadMigrations(fsys)
+		assert.Error(t, err)
+	})
+}
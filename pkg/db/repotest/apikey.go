@@ -0,0 +1,105 @@
+package repotest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/EternalQ/effective-mobile-test/pkg/db"
+	"github.com/EternalQ/effective-mobile-test/pkg/models"
+	"github.com/EternalQ/effective-mobile-test/pkg/service"
+	"github.com/EternalQ/effective-mobile-test/pkg/tenant"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// NewKeyRepo returns an empty API key repository for a single test.
+type NewKeyRepo func(t *testing.T) service.KeyRepository
+
+// RunKeys runs the API key suite against repositories created by newRepo.
+func RunKeys(t *testing.T, newRepo NewKeyRepo) {
+	t.Run("Keys", func(t *testing.T) { testKeys(t, newRepo(t)) })
+	t.Run("DuplicateKey", func(t *testing.T) { testDuplicateKey(t, newRepo(t)) })
+	t.Run("KeyIsolation", func(t *testing.T) { testKeyIsolation(t, newRepo(t)) })
+}
+
+func key(name, hash string, scopes ...models.Scope) *models.APIKey {
+	return &models.APIKey{
+		Name:      name,
+		Prefix:    "emk_" + hash[:4],
+		Hash:      hash,
+		Scopes:    scopes,
+		TenantId:  tenant.DefaultID,
+		CreatedAt: time.Date(2026, 3, 1, 12, 30, 0, 0, time.UTC),
+	}
+}
+
+func testKeys(t *testing.T, repo service.KeyRepository) {
+	ctx := t.Context()
+
+	reader := key("reader", "aaaa1111", models.ScopeRead)
+	reader.UserId = "60601fee-2bf1-4721-ae6f-7636e79a0cba"
+	admin := key("admin", "bbbb2222", models.ScopeRead, models.ScopeAdmin)
+	require.Nil(t, repo.CreateKey(ctx, reader))
+	require.Nil(t, repo.CreateKey(ctx, admin))
+	require.NotZero(t, reader.Id)
+	require.NotEqual(t, reader.Id, admin.Id)
+
+	got, err := repo.FindKey(ctx, "bbbb2222")
+	require.Nil(t, err)
+	require.NotNil(t, got)
+	assert.Equal(t, admin.Id, got.Id)
+	assert.Equal(t, models.Scopes{models.ScopeRead, models.ScopeAdmin}, got.Scopes)
+	assert.True(t, admin.CreatedAt.Equal(got.CreatedAt))
+	assert.Nil(t, got.RevokedAt)
+
+	missing, err := repo.FindKey(ctx, "cccc3333")
+	assert.Nil(t, err)
+	assert.Nil(t, missing)
+
+	at := time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC)
+	require.Nil(t, repo.RevokeKey(ctx, reader.Id, at))
+	require.Nil(t, repo.RevokeKey(ctx, reader.Id, at.AddDate(0, 1, 0)))
+	assert.ErrorIs(t, repo.RevokeKey(ctx, 100, at), db.ErrNotFound)
+
+	keys, err := repo.ListKeys(ctx)
+	require.Nil(t, err)
+	require.Len(t, keys, 2)
+	assert.Equal(t, "reader", keys[0].Name)
+	assert.Equal(t, reader.UserId, keys[0].UserId)
+	assert.Equal(t, tenant.DefaultID, keys[0].TenantId)
+	require.NotNil(t, keys[0].RevokedAt)
+	assert.True(t, at.Equal(*keys[0].RevokedAt), "first revocation is kept")
+	assert.Nil(t, keys[1].RevokedAt)
+}
+
+func testDuplicateKey(t *testing.T, repo service.KeyRepository) {
+	require.Nil(t, repo.CreateKey(t.Context(), key("first", "aaaa1111", models.ScopeRead)))
+
+	err := repo.CreateKey(t.Context(), key("second", "aaaa1111", models.ScopeRead))
+	assert.ErrorIs(t, err, db.ErrConflict)
+}
+
+func testKeyIsolation(t *testing.T, repo service.KeyRepository) {
+	acme := tenant.WithTenant(t.Context(), &tenant.Tenant{Id: "acme"})
+
+	own := key("own", "aaaa1111", models.ScopeAdmin)
+	other := key("other", "bbbb2222", models.ScopeAdmin)
+	other.TenantId = "acme"
+	require.Nil(t, repo.CreateKey(t.Context(), own))
+	require.Nil(t, repo.CreateKey(acme, other))
+
+	keys, err := repo.ListKeys(acme)
+	require.Nil(t, err)
+	require.Len(t, keys, 1)
+	assert.Equal(t, other.Id, keys[0].Id)
+
+	at := time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC)
+	assert.ErrorIs(t, repo.RevokeKey(t.Context(), other.Id, at), db.ErrNotFound)
+	got, err := repo.FindKey(t.Context(), "bbbb2222")
+	require.Nil(t, err)
+	require.NotNil(t, got, "keys are found in any tenant")
+	assert.Nil(t, got.RevokedAt)
+	assert.Equal(t, "acme", got.TenantId)
+
+	require.Nil(t, repo.RevokeKey(acme, other.Id, at))
+}
@@ -0,0 +1,129 @@
+package repotest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/EternalQ/effective-mobile-test/pkg/db"
+	"github.com/EternalQ/effective-mobile-test/pkg/models"
+	"github.com/EternalQ/effective-mobile-test/pkg/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// NewIdempotencyRepo returns an empty idempotency key repository for a
+// single test.
+type NewIdempotencyRepo func(t *testing.T) service.IdempotencyRepository
+
+// RunIdempotency runs the idempotency key suite against repositories created
+// by newRepo.
+func RunIdempotency(t *testing.T, newRepo NewIdempotencyRepo) {
+	t.Run("ReserveKey", func(t *testing.T) { testReserveKey(t, newRepo(t)) })
+	t.Run("StaleKeys", func(t *testing.T) { testStaleKeys(t, newRepo(t)) })
+	t.Run("PurgeKeys", func(t *testing.T) { testPurgeKeys(t, newRepo(t)) })
+}
+
+var keyTime = time.Date(2026, 3, 1, 12, 30, 0, 0, time.UTC)
+
+func idemKey(tenant, client, value, hash string, at time.Time) *models.IdempotencyKey {
+	return &models.IdempotencyKey{
+		TenantId:    tenant,
+		Client:      client,
+		Key:         value,
+		RequestHash: hash,
+		CreatedAt:   at,
+		ExpiresAt:   at.Add(time.Hour),
+	}
+}
+
+func testReserveKey(t *testing.T, repo service.IdempotencyRepository) {
+	ctx := t.Context()
+	stale := keyTime.Add(-time.Minute)
+
+	k := idemKey("default", "key:1", "abc", "h1", keyTime)
+	stored, err := repo.ReserveKey(ctx, k, stale)
+	require.Nil(t, err)
+	require.Nil(t, stored)
+
+	stored, err = repo.ReserveKey(ctx, idemKey("default", "key:1", "abc", "h2", keyTime), stale)
+	require.Nil(t, err)
+	require.NotNil(t, stored)
+	assert.Equal(t, "h1", stored.RequestHash)
+	assert.True(t, stored.Pending())
+
+	for _, other := range []*models.IdempotencyKey{
+		idemKey("default", "key:2", "abc", "h1", keyTime),
+		idemKey("acme", "key:1", "abc", "h1", keyTime),
+	} {
+		stored, err = repo.ReserveKey(ctx, other, stale)
+		require.Nil(t, err)
+		assert.Nil(t, stored, "keys are per tenant and client")
+	}
+
+	k.Status = 201
+	k.Headers = models.Headers{"Content-Type": "application/json", "ETag": `"1"`}
+	k.Response = []byte(`{"id":1}`)
+	require.Nil(t, repo.CompleteKey(ctx, k))
+	assert.ErrorIs(t, repo.CompleteKey(ctx, k), db.ErrNotFound, "completed keys are final")
+	require.Nil(t, repo.ReleaseKey(ctx, k))
+
+	stored, err = repo.ReserveKey(ctx, idemKey("default", "key:1", "abc", "h1", keyTime), stale)
+	require.Nil(t, err)
+	require.NotNil(t, stored)
+	assert.Equal(t, 201, stored.Status)
+	assert.Equal(t, models.Headers{"Content-Type": "application/json", "ETag": `"1"`}, stored.Headers)
+	assert.Equal(t, []byte(`{"id":1}`), stored.Response)
+	assert.True(t, keyTime.Equal(stored.CreatedAt))
+	assert.True(t, keyTime.Add(time.Hour).Equal(stored.ExpiresAt))
+
+	pending := idemKey("default", "key:2", "abc", "h1", keyTime)
+	require.Nil(t, repo.ReleaseKey(ctx, pending))
+	stored, err = repo.ReserveKey(ctx, pending, stale)
+	require.Nil(t, err)
+	assert.Nil(t, stored, "released keys can be reserved again")
+}
+
+func testStaleKeys(t *testing.T, repo service.IdempotencyRepository) {
+	ctx := t.Context()
+
+	pending := idemKey("default", "key:1", "pending", "h1", keyTime)
+	_, err := repo.ReserveKey(ctx, pending, keyTime)
+	require.Nil(t, err)
+
+	later := keyTime.Add(2 * time.Minute)
+	stored, err := repo.ReserveKey(ctx, idemKey("default", "key:1", "pending", "h2", later), later.Add(-time.Minute))
+	require.Nil(t, err)
+	assert.Nil(t, stored, "abandoned pending keys are replaced")
+
+	done := idemKey("default", "key:1", "done", "h1", keyTime)
+	_, err = repo.ReserveKey(ctx, done, keyTime)
+	require.Nil(t, err)
+	done.Status = 201
+	require.Nil(t, repo.CompleteKey(ctx, done))
+
+	stored, err = repo.ReserveKey(ctx, idemKey("default", "key:1", "done", "h2", later), later.Add(-time.Minute))
+	require.Nil(t, err)
+	require.NotNil(t, stored, "completed keys live until they expire")
+
+	expired := keyTime.Add(2 * time.Hour)
+	stored, err = repo.ReserveKey(ctx, idemKey("default", "key:1", "done", "h2", expired), expired.Add(-time.Minute))
+	require.Nil(t, err)
+	assert.Nil(t, stored, "expired keys are replaced")
+}
+
+func testPurgeKeys(t *testing.T, repo service.IdempotencyRepository) {
+	ctx := t.Context()
+
+	for i, at := range []time.Time{keyTime, keyTime, keyTime.Add(time.Hour)} {
+		_, err := repo.ReserveKey(ctx, idemKey("default", "key:1", string(rune('a'+i)), "h", at), keyTime)
+		require.Nil(t, err)
+	}
+
+	n, err := repo.PurgeKeys(ctx, keyTime.Add(90*time.Minute))
+	require.Nil(t, err)
+	assert.Equal(t, 2, n)
+
+	stored, err := repo.ReserveKey(ctx, idemKey("default", "key:1", "c", "h", keyTime.Add(time.Hour)), keyTime)
+	require.Nil(t, err)
+	assert.NotNil(t, stored, "live keys are kept")
+}
@@ -0,0 +1,576 @@
+// Package repotest is a conformance suite for service.Repository
+// implementations, so every storage backend behaves the same way.
+package repotest
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/EternalQ/effective-mobile-test/pkg/auth"
+	"github.com/EternalQ/effective-mobile-test/pkg/db"
+	"github.com/EternalQ/effective-mobile-test/pkg/logctx"
+	"github.com/EternalQ/effective-mobile-test/pkg/models"
+	"github.com/EternalQ/effective-mobile-test/pkg/service"
+	"github.com/EternalQ/effective-mobile-test/pkg/tenant"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	userA = "60601fee-2bf1-4721-ae6f-7636e79a0cba"
+	userB = "2b8e5a3c-9d4f-4c1e-8a7b-6f5d4e3c2b1a"
+)
+
+// NewRepo returns an empty repository for a single test.
+type NewRepo func(t *testing.T) service.Repository
+
+// Run runs the whole suite against repositories created by newRepo.
+func Run(t *testing.T, newRepo NewRepo) {
+	t.Run("CRUD", func(t *testing.T) { testCRUD(t, newRepo(t)) })
+	t.Run("NotFound", func(t *testing.T) { testNotFound(t, newRepo(t)) })
+	t.Run("PartialUpdate", func(t *testing.T) { testPartialUpdate(t, newRepo(t)) })
+	t.Run("NullEndDate", func(t *testing.T) { testNullEndDate(t, newRepo(t)) })
+	t.Run("Constraints", func(t *testing.T) { testConstraints(t, newRepo(t)) })
+	t.Run("Filters", func(t *testing.T) { testFilters(t, newRepo(t)) })
+	t.Run("Pagination", func(t *testing.T) { testPagination(t, newRepo(t)) })
+	t.Run("Breakdown", func(t *testing.T) { testBreakdown(t, newRepo(t)) })
+	t.Run("Tenants", func(t *testing.T) { testTenants(t, newRepo(t)) })
+	t.Run("Versions", func(t *testing.T) { testVersions(t, newRepo(t)) })
+	t.Run("Owners", func(t *testing.T) { testOwners(t, newRepo(t)) })
+	t.Run("Timestamps", func(t *testing.T) { testTimestamps(t, newRepo(t)) })
+	t.Run("History", func(t *testing.T) { testHistory(t, newRepo(t)) })
+}
+
+func month(m time.Month, y int) time.Time {
+	return time.Date(y, m, 1, 0, 0, 0, 0, time.UTC)
+}
+
+func ptr[T any](v T) *T { return &v }
+
+func sub(service string, price int, user string, start time.Time, end *time.Time) *models.Subscription {
+	return &models.Subscription{
+		ServiceName: service,
+		Price:       price,
+		UserId:      user,
+		StartDate:   start,
+		EndDate:     end,
+	}
+}
+
+func create(t *testing.T, repo service.Repository, subs ...*models.Subscription) []int {
+	t.Helper()
+
+	ids := make([]int, 0, len(subs))
+	for _, s := range subs {
+		require.Nil(t, repo.Create(t.Context(), s))
+		require.NotZero(t, s.Id)
+		ids = append(ids, s.Id)
+	}
+	return ids
+}
+
+// assertSame compares stored fields, dates are compared as instants since
+// drivers return them in different locations.
+func assertSame(t *testing.T, want, got *models.Subscription) {
+	t.Helper()
+
+	assert.Equal(t, want.Id, got.Id)
+	assert.Equal(t, want.ServiceName, got.ServiceName)
+	assert.Equal(t, want.Price, got.Price)
+	assert.Equal(t, want.UserId, got.UserId)
+	assert.True(t, want.StartDate.Equal(got.StartDate), "start_date: want %s, got %s", want.StartDate, got.StartDate)
+	if want.EndDate == nil {
+		assert.Nil(t, got.EndDate)
+	} else if assert.NotNil(t, got.EndDate) {
+		assert.True(t, want.EndDate.Equal(*got.EndDate), "end_date: want %s, got %s", want.EndDate, got.EndDate)
+	}
+}
+
+func idsOf(subs []*models.Subscription) []int {
+	res := make([]int, 0, len(subs))
+	for _, s := range subs {
+		res = append(res, s.Id)
+	}
+	return res
+}
+
+func testCRUD(t *testing.T, repo service.Repository) {
+	s := sub("Yandex Plus", 400, userA, month(7, 2025), ptr(month(6, 2026)))
+	create(t, repo, s)
+
+	got, err := repo.Read(t.Context(), s.Id)
+	require.Nil(t, err)
+	assertSame(t, s, got)
+
+	update := &models.Subscription{Id: s.Id, ServiceName: "Kinopoisk", Price: 300, UserId: userB, StartDate: month(8, 2025), EndDate: ptr(month(9, 2026))}
+	require.Nil(t, repo.Update(t.Context(), update, ""))
+
+	got, err = repo.Read(t.Context(), s.Id)
+	require.Nil(t, err)
+	assertSame(t, update, got)
+
+	require.Nil(t, repo.Delete(t.Context(), s.Id, 0, ""))
+	_, err = repo.Read(t.Context(), s.Id)
+	assert.ErrorIs(t, err, db.ErrNotFound)
+}
+
+func testNotFound(t *testing.T, repo service.Repository) {
+	_, err := repo.Read(t.Context(), 100500)
+	assert.ErrorIs(t, err, db.ErrNotFound)
+
+	err = repo.Update(t.Context(), &models.Subscription{Id: 100500, Price: 100}, "")
+	assert.ErrorIs(t, err, db.ErrNotFound)
+
+	err = repo.Delete(t.Context(), 100500, 0, "")
+	assert.ErrorIs(t, err, db.ErrNotFound)
+}
+
+func testVersions(t *testing.T, repo service.Repository) {
+	ctx := t.Context()
+	s := sub("Yandex Plus", 400, userA, month(7, 2025), nil)
+	create(t, repo, s)
+	assert.Equal(t, 1, s.Version)
+
+	update := &models.Subscription{Id: s.Id, Price: 500}
+	require.Nil(t, repo.Update(ctx, update, ""))
+	assert.Equal(t, 2, update.Version, "updates bump the version")
+
+	stale := &models.Subscription{Id: s.Id, Price: 600, Version: 1}
+	assert.ErrorIs(t, repo.Update(ctx, stale, ""), db.ErrVersionMismatch)
+	assert.ErrorIs(t, repo.Update(ctx, &models.Subscription{Id: 100500, Price: 600, Version: 1}, ""), db.ErrNotFound)
+
+	current := &models.Subscription{Id: s.Id, Price: 600, Version: 2}
+	require.Nil(t, repo.Update(ctx, current, ""))
+	assert.Equal(t, 3, current.Version)
+
+	got, err := repo.Read(ctx, s.Id)
+	require.Nil(t, err)
+	assert.Equal(t, 600, got.Price)
+	assert.Equal(t, 3, got.Version)
+
+	assert.ErrorIs(t, repo.Delete(ctx, s.Id, 2, ""), db.ErrVersionMismatch)
+	assert.ErrorIs(t, repo.Delete(ctx, 100500, 2, ""), db.ErrNotFound)
+	require.Nil(t, repo.Delete(ctx, s.Id, 3, ""))
+	_, err = repo.Read(ctx, s.Id)
+	assert.ErrorIs(t, err, db.ErrNotFound)
+}
+
+func testOwners(t *testing.T, repo service.Repository) {
+	ctx := t.Context()
+	s := sub("Yandex Plus", 400, userA, month(7, 2025), nil)
+	create(t, repo, s)
+
+	assert.ErrorIs(t, repo.Update(ctx, &models.Subscription{Id: s.Id, Price: 500}, userB), db.ErrNotFound)
+	assert.ErrorIs(t, repo.Delete(ctx, s.Id, 0, userB), db.ErrNotFound)
+	got, err := repo.Read(ctx, s.Id)
+	require.Nil(t, err)
+	assert.Equal(t, 400, got.Price)
+	assert.Equal(t, 1, got.Version, "changes of other users are not applied")
+
+	update := &models.Subscription{Id: s.Id, Price: 500, UserId: userB}
+	require.Nil(t, repo.Update(ctx, update, userA))
+	assert.Equal(t, 2, update.Version)
+	assert.ErrorIs(t, repo.Delete(ctx, s.Id, 0, userA), db.ErrNotFound, "the subscription moved to userB")
+	require.Nil(t, repo.Delete(ctx, s.Id, 2, userB))
+}
+
+func testTimestamps(t *testing.T, repo service.Repository) {
+	ctx := t.Context()
+	older := sub("Yandex Plus", 400, userA, month(7, 2025), nil)
+	changed := sub("Kinopoisk", 300, userA, month(7, 2025), nil)
+	create(t, repo, older, changed)
+	assert.False(t, changed.CreatedAt.IsZero())
+	assert.True(t, changed.CreatedAt.Equal(changed.UpdatedAt))
+
+	// Timestamps of some drivers have millisecond precision.
+	time.Sleep(10 * time.Millisecond)
+	require.Nil(t, repo.Update(ctx, &models.Subscription{Id: changed.Id, Price: 500}, ""))
+
+	got, err := repo.Read(ctx, changed.Id)
+	require.Nil(t, err)
+	assert.True(t, changed.CreatedAt.Equal(got.CreatedAt), "created_at is kept")
+	assert.True(t, got.UpdatedAt.After(got.CreatedAt), "updated_at follows updates")
+
+	subs, err := repo.List(ctx, &models.SubscriptionFilter{UpdatedSince: &got.UpdatedAt}, nil)
+	require.Nil(t, err)
+	assert.Equal(t, []int{changed.Id}, idsOf(subs))
+
+	count, err := repo.Count(ctx, &models.SubscriptionFilter{UpdatedSince: &older.CreatedAt})
+	require.Nil(t, err)
+	assert.Equal(t, 2, count)
+}
+
+// snapshotPrice returns the price of a snapshot, zero when it is empty.
+func snapshotPrice(t *testing.T, s models.Snapshot) int {
+	t.Helper()
+
+	if len(s) == 0 {
+		return 0
+	}
+	var sub models.Subscription
+	require.Nil(t, json.Unmarshal(s, &sub))
+	return sub.Price
+}
+
+func testHistory(t *testing.T, repo service.Repository) {
+	ctx := auth.WithPrincipal(t.Context(), &auth.Principal{KeyId: 7})
+	ctx = logctx.WithRequestID(ctx, "req-1")
+	s := sub("Yandex Plus", 400, userA, month(7, 2025), nil)
+	require.Nil(t, repo.Create(ctx, s))
+
+	assert.ErrorIs(t, repo.Update(ctx, &models.Subscription{Id: s.Id, Price: 600, Version: 5}, ""), db.ErrVersionMismatch)
+	require.Nil(t, repo.Update(logctx.WithRequestID(ctx, "req-2"), &models.Subscription{Id: s.Id, Price: 500}, ""))
+	require.Nil(t, repo.Delete(t.Context(), s.Id, 0, ""))
+
+	events, err := repo.History(ctx, s.Id)
+	require.Nil(t, err)
+	require.Len(t, events, 3, "failed changes are not recorded")
+
+	actions := []models.EventAction{}
+	for _, e := range events {
+		assert.Equal(t, s.Id, e.SubscriptionId)
+		assert.False(t, e.CreatedAt.IsZero())
+		actions = append(actions, e.Action)
+	}
+	assert.Equal(t, []models.EventAction{models.EventCreate, models.EventUpdate, models.EventDelete}, actions)
+
+	assert.Equal(t, "key:7", events[0].Actor)
+	assert.Equal(t, "req-1", events[0].RequestId)
+	assert.Equal(t, 0, snapshotPrice(t, events[0].Before))
+	assert.Equal(t, 400, snapshotPrice(t, events[0].After))
+
+	assert.Equal(t, "req-2", events[1].RequestId)
+	assert.Equal(t, 400, snapshotPrice(t, events[1].Before))
+	assert.Equal(t, 500, snapshotPrice(t, events[1].After))
+
+	assert.Equal(t, auth.Anonymous, events[2].Actor)
+	assert.Empty(t, events[2].RequestId)
+	assert.Equal(t, 500, snapshotPrice(t, events[2].Before))
+	assert.Equal(t, 0, snapshotPrice(t, events[2].After))
+
+	_, err = repo.History(tenant.WithTenant(ctx, &tenant.Tenant{Id: "acme"}), s.Id)
+	assert.ErrorIs(t, err, db.ErrNotFound, "histories are per tenant")
+	_, err = repo.History(ctx, 100500)
+	assert.ErrorIs(t, err, db.ErrNotFound)
+}
+
+// RunUnrecorded checks the history of a subscription created before events
+// were recorded, clearEvents deletes the events of repo.
+func RunUnrecorded(t *testing.T, repo service.Repository, clearEvents func(t *testing.T)) {
+	ctx := t.Context()
+	s := sub("Yandex Plus", 400, userA, month(7, 2025), nil)
+	require.Nil(t, repo.Create(ctx, s))
+	clearEvents(t)
+
+	events, err := repo.History(ctx, s.Id)
+	require.Nil(t, err)
+	assert.NotNil(t, events)
+	assert.Empty(t, events)
+
+	_, err = repo.History(tenant.WithTenant(ctx, &tenant.Tenant{Id: "acme"}), s.Id)
+	assert.ErrorIs(t, err, db.ErrNotFound, "histories are per tenant")
+	_, err = repo.History(ctx, 100500)
+	assert.ErrorIs(t, err, db.ErrNotFound)
+}
+
+func testPartialUpdate(t *testing.T, repo service.Repository) {
+	tests := []struct {
+		name   string
+		update models.Subscription
+		apply  func(s *models.Subscription)
+	}{
+		{
+			name:   "service name",
+			update: models.Subscription{ServiceName: "Kinopoisk"},
+			apply:  func(s *models.Subscription) { s.ServiceName = "Kinopoisk" },
+		},
+		{
+			name:   "price",
+			update: models.Subscription{Price: 999},
+			apply:  func(s *models.Subscription) { s.Price = 999 },
+		},
+		{
+			name:   "user",
+			update: models.Subscription{UserId: userB},
+			apply:  func(s *models.Subscription) { s.UserId = userB },
+		},
+		{
+			name:   "start date",
+			update: models.Subscription{StartDate: month(1, 2025)},
+			apply:  func(s *models.Subscription) { s.StartDate = month(1, 2025) },
+		},
+		{
+			name:   "end date",
+			update: models.Subscription{EndDate: ptr(month(12, 2027))},
+			apply:  func(s *models.Subscription) { s.EndDate = ptr(month(12, 2027)) },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := sub("Yandex Plus", 400, userA, month(7, 2025), ptr(month(6, 2026)))
+			create(t, repo, s)
+
+			tt.update.Id = s.Id
+			require.Nil(t, repo.Update(t.Context(), &tt.update, ""))
+			tt.apply(s)
+
+			got, err := repo.Read(t.Context(), s.Id)
+			require.Nil(t, err)
+			assertSame(t, s, got)
+		})
+	}
+}
+
+func testNullEndDate(t *testing.T, repo service.Repository) {
+	s := sub("Yandex Plus", 400, userA, month(7, 2025), ptr(month(6, 2026)))
+	create(t, repo, s)
+
+	require.Nil(t, repo.Update(t.Context(), &models.Subscription{Id: s.Id, EndDateFormatted: "0"}, ""))
+
+	got, err := repo.Read(t.Context(), s.Id)
+	require.Nil(t, err)
+	s.EndDate = nil
+	assertSame(t, s, got)
+}
+
+func testConstraints(t *testing.T, repo service.Repository) {
+	err := repo.Create(t.Context(), sub("Yandex Plus", 0, userA, month(7, 2025), nil))
+	assert.ErrorIs(t, err, db.ErrConstraint)
+
+	err = repo.Create(t.Context(), sub("Yandex Plus", 400, "not-a-uuid", month(7, 2025), nil))
+	assert.ErrorIs(t, err, db.ErrInvalidInput)
+
+	s := sub("Yandex Plus", 400, userA, month(7, 2025), nil)
+	create(t, repo, s)
+	err = repo.Update(t.Context(), &models.Subscription{Id: s.Id, Price: -1}, "")
+	assert.ErrorIs(t, err, db.ErrConstraint)
+
+	_, err = repo.List(t.Context(), &models.SubscriptionFilter{Subscription: models.Subscription{UserId: "42"}}, nil)
+	assert.ErrorIs(t, err, db.ErrInvalidInput)
+}
+
+func testFilters(t *testing.T, repo service.Repository) {
+	ids := create(t, repo,
+		// 0: inside 2026
+		sub("Yandex Plus", 100, userA, month(3, 2026), ptr(month(5, 2026))),
+		// 1: started before 2026, ends inside
+		sub("Yandex Plus", 200, userB, month(6, 2025), ptr(month(2, 2026))),
+		// 2: open-ended, started inside
+		sub("Kinopoisk", 300, userA, month(10, 2026), nil),
+		// 3: open-ended, started before
+		sub("Kinopoisk", 400, userB, month(1, 2024), nil),
+		// 4: ended before 2026
+		sub("Yandex Plus", 500, userA, month(1, 2025), ptr(month(6, 2025))),
+		// 5: starts after 2026
+		sub("Kinopoisk", 600, userA, month(2, 2027), ptr(month(3, 2027))),
+	)
+
+	window := func(f models.SubscriptionFilter) *models.SubscriptionFilter {
+		if f.Mode == "" {
+			f.Mode = models.FilterOverlap
+		}
+		return &f
+	}
+	year := models.Subscription{StartDate: month(1, 2026), EndDate: ptr(month(12, 2026))}
+
+	tests := []struct {
+		name   string
+		filter *models.SubscriptionFilter
+		want   []int
+	}{
+		{
+			name: "no filter",
+			want: ids,
+		},
+		{
+			name:   "user",
+			filter: window(models.SubscriptionFilter{Subscription: models.Subscription{UserId: userA}}),
+			want:   []int{ids[0], ids[2], ids[4], ids[5]},
+		},
+		{
+			name:   "service",
+			filter: window(models.SubscriptionFilter{Subscription: models.Subscription{ServiceName: "Kinopoisk"}}),
+			want:   []int{ids[2], ids[3], ids[5]},
+		},
+		{
+			name:   "user and service",
+			filter: window(models.SubscriptionFilter{Subscription: models.Subscription{UserId: userB, ServiceName: "Kinopoisk"}}),
+			want:   []int{ids[3]},
+		},
+		{
+			name:   "overlap start",
+			filter: window(models.SubscriptionFilter{Subscription: models.Subscription{StartDate: month(1, 2026)}}),
+			want:   []int{ids[0], ids[1], ids[2], ids[3], ids[5]},
+		},
+		{
+			name:   "overlap end",
+			filter: window(models.SubscriptionFilter{Subscription: models.Subscription{EndDate: ptr(month(12, 2026))}}),
+			want:   []int{ids[0], ids[1], ids[2], ids[3], ids[4]},
+		},
+		{
+			name:   "overlap window",
+			filter: window(models.SubscriptionFilter{Subscription: year}),
+			want:   []int{ids[0], ids[1], ids[2], ids[3]},
+		},
+		{
+			name:   "contain start",
+			filter: window(models.SubscriptionFilter{Subscription: models.Subscription{StartDate: month(1, 2026)}, Mode: models.FilterContain}),
+			want:   []int{ids[0], ids[2], ids[5]},
+		},
+		{
+			name:   "contain end",
+			filter: window(models.SubscriptionFilter{Subscription: models.Subscription{EndDate: ptr(month(12, 2026))}, Mode: models.FilterContain}),
+			want:   []int{ids[0], ids[1], ids[4]},
+		},
+		{
+			name:   "contain window",
+			filter: window(models.SubscriptionFilter{Subscription: year, Mode: models.FilterContain}),
+			want:   []int{ids[0]},
+		},
+		{
+			name: "everything",
+			filter: window(models.SubscriptionFilter{Subscription: models.Subscription{
+				UserId: userA, ServiceName: "Kinopoisk", StartDate: month(1, 2026), EndDate: ptr(month(12, 2026)),
+			}}),
+			want: []int{ids[2]},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			subs, err := repo.List(t.Context(), tt.filter, nil)
+			require.Nil(t, err)
+			assert.ElementsMatch(t, tt.want, idsOf(subs))
+
+			count, err := repo.Count(t.Context(), tt.filter)
+			require.Nil(t, err)
+			assert.Equal(t, len(tt.want), count)
+		})
+	}
+}
+
+func testPagination(t *testing.T, repo service.Repository) {
+	created := create(t, repo,
+		sub("Netflix", 300, userA, month(3, 2026), nil),
+		sub("Apple Music", 100, userA, month(1, 2026), nil),
+		sub("Kinopoisk", 300, userA, month(2, 2026), nil),
+		sub("Yandex Plus", 200, userA, month(4, 2026), nil),
+	)
+
+	tests := []struct {
+		name string
+		page models.Pagination
+		want []int
+	}{
+		{
+			name: "by id",
+			page: models.Pagination{Limit: 10, Sort: "id"},
+			want: created,
+		},
+		{
+			name: "by id descending",
+			page: models.Pagination{Limit: 10, Sort: "-id"},
+			want: []int{created[3], created[2], created[1], created[0]},
+		},
+		{
+			name: "by price, ties by id",
+			page: models.Pagination{Limit: 10, Sort: "price"},
+			want: []int{created[1], created[3], created[0], created[2]},
+		},
+		{
+			name: "by start date descending",
+			page: models.Pagination{Limit: 10, Sort: "-start_date"},
+			want: []int{created[3], created[0], created[2], created[1]},
+		},
+		{
+			name: "by service name",
+			page: models.Pagination{Limit: 10, Sort: "service_name"},
+			want: []int{created[1], created[2], created[0], created[3]},
+		},
+		{
+			name: "limit and offset",
+			page: models.Pagination{Limit: 2, Offset: 1, Sort: "id"},
+			want: []int{created[1], created[2]},
+		},
+		{
+			name: "offset past the end",
+			page: models.Pagination{Limit: 2, Offset: 10, Sort: "id"},
+			want: []int{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			subs, err := repo.List(t.Context(), nil, &tt.page)
+			require.Nil(t, err)
+			assert.Equal(t, tt.want, idsOf(subs))
+		})
+	}
+}
+
+func testBreakdown(t *testing.T, repo service.Repository) {
+	create(t, repo,
+		sub("Yandex Plus", 100, userA, month(1, 2026), ptr(month(2, 2026))),
+		sub("Yandex Plus", 200, userB, month(2, 2026), nil),
+		sub("Kinopoisk", 300, userA, month(6, 2025), ptr(month(1, 2026))),
+		sub("Kinopoisk", 400, userB, month(1, 2025), ptr(month(6, 2025))),
+	)
+
+	filter := &models.SubscriptionFilter{
+		Subscription: models.Subscription{StartDate: month(1, 2026), EndDate: ptr(month(3, 2026))},
+		Mode:         models.FilterOverlap,
+	}
+	got, err := repo.Breakdown(t.Context(), filter)
+	require.Nil(t, err)
+
+	assert.Equal(t, []*models.CostGroup{
+		{Key: "Kinopoisk", Count: 1, Total: 300},
+		{Key: "Yandex Plus", Count: 2, Total: 100*2 + 200*2},
+	}, got.ByService)
+	assert.Equal(t, []*models.CostGroup{
+		{Key: userB, Count: 1, Total: 200 * 2},
+		{Key: userA, Count: 2, Total: 100*2 + 300},
+	}, got.ByUser)
+	assert.Equal(t, []*models.CostGroup{
+		{Key: "01-2026", Count: 2, Total: 100 + 300},
+		{Key: "02-2026", Count: 2, Total: 100 + 200},
+		{Key: "03-2026", Count: 1, Total: 200},
+	}, got.ByMonth)
+}
+
+func testTenants(t *testing.T, repo service.Repository) {
+	acme := tenant.WithTenant(t.Context(), &tenant.Tenant{Id: "acme"})
+	own := sub("Yandex Plus", 100, userA, month(1, 2026), nil)
+	require.Nil(t, repo.Create(acme, own))
+	assert.Equal(t, "acme", own.TenantId)
+	other := sub("Yandex Plus", 200, userA, month(1, 2026), nil)
+	create(t, repo, other)
+	assert.Equal(t, tenant.DefaultID, other.TenantId)
+
+	got, err := repo.Read(acme, own.Id)
+	require.Nil(t, err)
+	assert.Equal(t, "acme", got.TenantId)
+
+	_, err = repo.Read(acme, other.Id)
+	assert.ErrorIs(t, err, db.ErrNotFound)
+	assert.ErrorIs(t, repo.Update(acme, &models.Subscription{Id: other.Id, Price: 300}, ""), db.ErrNotFound)
+	assert.ErrorIs(t, repo.Delete(acme, other.Id, 0, ""), db.ErrNotFound)
+
+	filter := &models.SubscriptionFilter{
+		Subscription: models.Subscription{UserId: userA, StartDate: month(1, 2026), EndDate: ptr(month(1, 2026))},
+	}
+	subs, err := repo.List(acme, filter, nil)
+	require.Nil(t, err)
+	assert.Equal(t, []int{own.Id}, idsOf(subs))
+
+	count, err := repo.Count(t.Context(), filter)
+	require.Nil(t, err)
+	assert.Equal(t, 1, count)
+
+	breakdown, err := repo.Breakdown(acme, filter)
+	require.Nil(t, err)
+	assert.Equal(t, []*models.CostGroup{{Key: "Yandex Plus", Count: 1, Total: 100}}, breakdown.ByService)
+
+	got, err = repo.Read(t.Context(), other.Id)
+	require.Nil(t, err)
+	assert.Equal(t, 200, got.Price)
+}
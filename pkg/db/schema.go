@@ -0,0 +1,37 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// ErrNoSchema means the migrations table is missing or empty.
+var ErrNoSchema = errors.New("no migrations applied")
+
+var schemaVersion = `
+SELECT version, dirty
+FROM schema_migrations
+LIMIT 1`
+
+// SchemaVersion returns the applied migration version and whether the last
+// migration failed half way.
+func SchemaVersion(ctx context.Context, db *sqlx.DB) (uint, bool, error) {
+	return schemaVersionTx(ctx, db)
+}
+
+func schemaVersionTx(ctx context.Context, q sqlx.QueryerContext) (uint, bool, error) {
+	var row struct {
+		Version uint `db:"version"`
+		Dirty   bool `db:"dirty"`
+	}
+	err := sqlx.GetContext(ctx, q, &row, schemaVersion)
+	if errors.Is(err, sql.ErrNoRows) || isUndefinedTable(err) {
+		return 0, false, ErrNoSchema
+	} else if err != nil {
+		return 0, false, err
+	}
+	return row.Version, row.Dirty, nil
+}
@@ -0,0 +1,480 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/EternalQ/effective-mobile-test/pkg/logctx"
+	"github.com/EternalQ/effective-mobile-test/pkg/models"
+	"github.com/EternalQ/effective-mobile-test/pkg/tenant"
+	"github.com/jmoiron/sqlx"
+	_ "modernc.org/sqlite"
+)
+
+func init() {
+	sqlx.BindDriver("sqlite", sqlx.QUESTION)
+}
+
+// ConnectSQLite opens a SQLite database. Dates are written in a format
+// SQLite date functions understand, which the repository queries rely on.
+func ConnectSQLite(dsn string) (*sqlx.DB, error) {
+	sep := "?"
+	if strings.Contains(dsn, "?") {
+		sep = "&"
+	}
+	dsn += sep + "_time_format=sqlite&_pragma=busy_timeout(5000)&_pragma=foreign_keys(1)"
+
+	db, err := sqlx.Connect("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+	// SQLite allows a single writer, one connection avoids busy errors
+	// and keeps in-memory databases alive.
+	db.SetMaxOpenConns(1)
+	return db, nil
+}
+
+// SQLiteRepo stores subscriptions in SQLite. It mirrors SubscriptionRepo
+// semantics, dates are stored in UTC as text.
+type SQLiteRepo struct {
+	db      *sqlx.DB
+	timeout time.Duration
+	log     *slog.Logger
+}
+
+func NewSQLiteRepo(db *sqlx.DB, timeout time.Duration, log *slog.Logger) *SQLiteRepo {
+	return &SQLiteRepo{
+		db,
+		timeout,
+		log.With(slog.String("where", "db/SQLiteRepo")),
+	}
+}
+
+func (r *SQLiteRepo) logger(ctx context.Context) *slog.Logger {
+	return logctx.From(ctx, r.log, "db/SQLiteRepo")
+}
+
+func (r *SQLiteRepo) queryContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if r.timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, r.timeout)
+}
+
+// inTx runs fn in a transaction, so changes are written with their events.
+func (r *SQLiteRepo) inTx(ctx context.Context, fn func(tx *sqlx.Tx) error) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// filterArgs binds filter values the way they are stored.
+func filterArgs(filter *models.SubscriptionFilter) map[string]any {
+	args := map[string]any{
+		"tenant_id":    filter.TenantId,
+		"user_id":      strings.ToLower(filter.UserId),
+		"service_name": filter.ServiceName,
+		"start_date":   filter.StartDate.UTC(),
+	}
+	if filter.EndDate != nil {
+		args["end_date"] = filter.EndDate.UTC()
+	}
+	if filter.UpdatedSince != nil {
+		args["updated_since"] = filter.UpdatedSince.UTC()
+	}
+	return args
+}
+
+var sqliteCreateSubscription = `
+INSERT INTO subscriptions (service_name, price, user_id, start_date, end_date, tenant_id)
+VALUES (?, ?, ?, ?, ?, ?)
+RETURNING *;`
+
+func (r *SQLiteRepo) Create(ctx context.Context, s *models.Subscription) error {
+	log := r.logger(ctx)
+	if err := checkUserId(s.UserId); err != nil {
+		return err
+	}
+
+	ctx, cancel := r.queryContext(ctx)
+	defer cancel()
+
+	v := stored(s)
+	qctx, span := startQuery(ctx, "sqlite", "Create", sqliteCreateSubscription)
+	err := r.inTx(qctx, func(tx *sqlx.Tx) error {
+		if err := tx.GetContext(qctx, s, sqliteCreateSubscription, v.ServiceName, v.Price, v.UserId, v.StartDate, v.EndDate, tenant.ID(ctx)); err != nil {
+			return err
+		}
+		return recordEvent(qctx, tx, models.EventCreate, nil, s)
+	})
+	endQuery(span, err)
+	if err != nil {
+		log.Error("Error while creating entity",
+			slog.String("err", err.Error()),
+			slog.String("method", "Create"),
+		)
+		return classify(err)
+	}
+
+	return nil
+}
+
+var sqliteReadSubscription = `
+SELECT *
+FROM subscriptions
+WHERE id = ? AND tenant_id = ?`
+
+func (r *SQLiteRepo) Read(ctx context.Context, id int) (*models.Subscription, error) {
+	log := r.logger(ctx)
+	ctx, cancel := r.queryContext(ctx)
+	defer cancel()
+
+	var subscription models.Subscription
+	qctx, span := startQuery(ctx, "sqlite", "Read", sqliteReadSubscription)
+	err := r.db.GetContext(qctx, &subscription, sqliteReadSubscription, id, tenant.ID(ctx))
+	endQuery(span, err)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	} else if err != nil {
+		log.Error("Error while getting entity",
+			slog.String("err", err.Error()),
+			slog.String("method", "Read"),
+		)
+		return nil, classify(err)
+	}
+	return &subscription, nil
+}
+
+// sqliteLockSubscription reads a subscription about to change, only of the
+// given user unless it is empty.
+var sqliteLockSubscription = sqliteReadSubscription + ` AND (? = '' OR user_id = ?)`
+
+func (r *SQLiteRepo) Update(ctx context.Context, subscription *models.Subscription, owner string) error {
+	log := r.logger(ctx)
+	if subscription.UserId != "" {
+		if err := checkUserId(subscription.UserId); err != nil {
+			return err
+		}
+	}
+
+	ctx, cancel := r.queryContext(ctx)
+	defer cancel()
+
+	query := updateQuery(subscription, owner)
+	log.Debug("Update query", slog.String("string", query))
+
+	v := &ownedUpdate{*stored(subscription), owner}
+	v.TenantId = tenant.ID(ctx)
+	qctx, span := startQuery(ctx, "sqlite", "Update", query)
+	err := r.inTx(qctx, func(tx *sqlx.Tx) error {
+		var before, after models.Subscription
+		err := tx.GetContext(qctx, &before, sqliteLockSubscription, v.Id, v.TenantId, owner, owner)
+		if err == sql.ErrNoRows {
+			return ErrNotFound
+		} else if err != nil {
+			return err
+		}
+
+		q, args, err := tx.BindNamed(query, v)
+		if err != nil {
+			return err
+		}
+		err = tx.GetContext(qctx, &subscription.Version, q, args...)
+		if err == sql.ErrNoRows {
+			return ErrVersionMismatch
+		} else if err != nil {
+			return err
+		}
+
+		// RETURNING misses the updated_at set by the trigger, read it back.
+		if err := tx.GetContext(qctx, &after, sqliteReadSubscription, v.Id, v.TenantId); err != nil {
+			return err
+		}
+		return recordEvent(qctx, tx, models.EventUpdate, &before, &after)
+	})
+	endQuery(span, err)
+	if errors.Is(err, ErrNotFound) || errors.Is(err, ErrVersionMismatch) {
+		log.Debug("Nothing updated",
+			slog.String("err", err.Error()),
+			slog.String("method", "Update"),
+		)
+		return err
+	} else if err != nil {
+		log.Error("Error while updating entity",
+			slog.String("err", err.Error()),
+			slog.String("method", "Update"),
+		)
+		return classify(err)
+	}
+
+	return nil
+}
+
+// sqliteDeleteSubscription deletes any version when the version is 0, of any
+// user when the user is empty.
+var sqliteDeleteSubscription = `
+DELETE FROM subscriptions
+WHERE id = ? AND tenant_id = ? AND (? = 0 OR version = ?) AND (? = '' OR user_id = ?)`
+
+func (r *SQLiteRepo) Delete(ctx context.Context, id, version int, owner string) error {
+	log := r.logger(ctx)
+	ctx, cancel := r.queryContext(ctx)
+	defer cancel()
+
+	qctx, span := startQuery(ctx, "sqlite", "Delete", sqliteDeleteSubscription)
+	err := r.inTx(qctx, func(tx *sqlx.Tx) error {
+		var before models.Subscription
+		err := tx.GetContext(qctx, &before, sqliteLockSubscription, id, tenant.ID(ctx), owner, owner)
+		if err == sql.ErrNoRows {
+			return ErrNotFound
+		} else if err != nil {
+			return err
+		}
+
+		res, err := tx.ExecContext(qctx, sqliteDeleteSubscription, id, tenant.ID(ctx), version, version, owner, owner)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return ErrVersionMismatch
+		}
+		return recordEvent(qctx, tx, models.EventDelete, &before, nil)
+	})
+	endQuery(span, err)
+	if errors.Is(err, ErrNotFound) || errors.Is(err, ErrVersionMismatch) {
+		log.Debug("Nothing deleted",
+			slog.String("err", err.Error()),
+			slog.String("method", "Delete"),
+		)
+		return err
+	} else if err != nil {
+		log.Error("Error while deleting entity",
+			slog.String("err", err.Error()),
+			slog.String("method", "Delete"),
+		)
+		return classify(err)
+	}
+
+	return nil
+}
+
+func (r *SQLiteRepo) History(ctx context.Context, id int) ([]*models.SubscriptionEvent, error) {
+	log := r.logger(ctx)
+	ctx, cancel := r.queryContext(ctx)
+	defer cancel()
+
+	var events []*models.SubscriptionEvent
+	qctx, span := startQuery(ctx, "sqlite", "History", subscriptionHistory)
+	err := r.inTx(qctx, func(tx *sqlx.Tx) (err error) {
+		events, err = readHistory(qctx, tx, id)
+		return err
+	})
+	endQuery(span, err)
+	if errors.Is(err, ErrNotFound) {
+		return nil, err
+	} else if err != nil {
+		log.Error("Error while getting history",
+			slog.String("err", err.Error()),
+			slog.String("method", "History"),
+		)
+		return nil, classify(err)
+	}
+	return events, nil
+}
+
+func (r *SQLiteRepo) List(ctx context.Context, filter *models.SubscriptionFilter, page *models.Pagination) ([]*models.Subscription, error) {
+	log := r.logger(ctx)
+	filter = scopedFilter(ctx, filter)
+	if filter.UserId != "" {
+		if err := checkUserId(filter.UserId); err != nil {
+			return nil, err
+		}
+	}
+
+	ctx, cancel := r.queryContext(ctx)
+	defer cancel()
+
+	query := "SELECT * FROM subscriptions" + filterConditions(filter)
+	if page != nil {
+		field, desc := page.SortField()
+		if !slices.Contains(models.SortFields, field) {
+			return nil, models.ErrInvalidSort
+		}
+		order := "ASC"
+		if desc {
+			order = "DESC"
+		}
+		query += fmt.Sprintf(" ORDER BY %s %s, id %s LIMIT %d OFFSET %d", field, order, order, page.Limit, page.Offset)
+	}
+
+	query, args, err := sqlx.BindNamed(sqlx.QUESTION, query, filterArgs(filter))
+	log.Debug("Prepared query", slog.String("string", query), slog.Any("args", args))
+	if err != nil {
+		log.Error("Error while preparing quary",
+			slog.String("err", err.Error()),
+			slog.String("method", "List"),
+		)
+		return nil, err
+	}
+
+	subscriptions := []*models.Subscription{}
+	qctx, span := startQuery(ctx, "sqlite", "List", query)
+	err = r.db.SelectContext(qctx, &subscriptions, query, args...)
+	endQuery(span, err)
+	if err != nil {
+		log.Error("Error while listing entity",
+			slog.String("err", err.Error()),
+			slog.String("method", "List"),
+		)
+		return nil, classify(err)
+	}
+
+	return subscriptions, nil
+}
+
+func (r *SQLiteRepo) Count(ctx context.Context, filter *models.SubscriptionFilter) (int, error) {
+	log := r.logger(ctx)
+	filter = scopedFilter(ctx, filter)
+	if filter.UserId != "" {
+		if err := checkUserId(filter.UserId); err != nil {
+			return 0, err
+		}
+	}
+
+	ctx, cancel := r.queryContext(ctx)
+	defer cancel()
+
+	query, args, err := sqlx.BindNamed(sqlx.QUESTION, "SELECT COUNT(*) FROM subscriptions"+filterConditions(filter), filterArgs(filter))
+	log.Debug("Prepared query", slog.String("string", query), slog.Any("args", args))
+	if err != nil {
+		log.Error("Error while preparing quary",
+			slog.String("err", err.Error()),
+			slog.String("method", "Count"),
+		)
+		return 0, err
+	}
+
+	var count int
+	qctx, span := startQuery(ctx, "sqlite", "Count", query)
+	err = r.db.GetContext(qctx, &count, query, args...)
+	endQuery(span, err)
+	if err != nil {
+		log.Error("Error while counting entities",
+			slog.String("err", err.Error()),
+			slog.String("method", "Count"),
+		)
+		return 0, classify(err)
+	}
+
+	return count, nil
+}
+
+// sqliteBreakdownWindow mirrors breakdownWindow, months are counted as
+// year * 12 + month indexes. Formatted with the filter conditions.
+var sqliteBreakdownWindow = `
+WITH RECURSIVE windowed AS (
+	SELECT service_name, user_id, price, from_idx, to_idx, to_idx - from_idx + 1 AS months
+	FROM (
+		SELECT service_name, user_id, price,
+			MAX(CAST(strftime('%%Y', start_date) AS INTEGER) * 12 + CAST(strftime('%%m', start_date) AS INTEGER) - 1, :from_idx) AS from_idx,
+			MIN(COALESCE(CAST(strftime('%%Y', end_date) AS INTEGER) * 12 + CAST(strftime('%%m', end_date) AS INTEGER) - 1, :to_idx), :to_idx) AS to_idx
+		FROM subscriptions%s
+	) AS clipped
+)`
+
+var sqliteBreakdownByService = `
+SELECT service_name AS key, COUNT(*) AS count, COALESCE(SUM(price * months), 0) AS total
+FROM windowed
+WHERE months > 0
+GROUP BY service_name
+ORDER BY service_name`
+
+var sqliteBreakdownByUser = `
+SELECT user_id AS key, COUNT(*) AS count, COALESCE(SUM(price * months), 0) AS total
+FROM windowed
+WHERE months > 0
+GROUP BY user_id
+ORDER BY user_id`
+
+var sqliteBreakdownByMonth = `
+, months(m) AS (
+	SELECT :from_idx
+	UNION ALL
+	SELECT m + 1 FROM months WHERE m < :to_idx
+)
+SELECT printf('%02d-%04d', m % 12 + 1, m / 12) AS key, COUNT(w.price) AS count, COALESCE(SUM(w.price), 0) AS total
+FROM months
+LEFT JOIN windowed w ON w.from_idx <= months.m AND w.to_idx >= months.m
+GROUP BY m
+ORDER BY m`
+
+func monthIdx(t time.Time) int {
+	return t.Year()*12 + int(t.Month()) - 1
+}
+
+// Breakdown mirrors SubscriptionRepo.Breakdown.
+func (r *SQLiteRepo) Breakdown(ctx context.Context, filter *models.SubscriptionFilter) (*models.CostBreakdown, error) {
+	log := r.logger(ctx)
+	filter = scopedFilter(ctx, filter)
+	if filter.UserId != "" {
+		if err := checkUserId(filter.UserId); err != nil {
+			return nil, err
+		}
+	}
+
+	ctx, cancel := r.queryContext(ctx)
+	defer cancel()
+
+	window := fmt.Sprintf(sqliteBreakdownWindow, filterConditions(filter))
+	args := filterArgs(filter)
+	args["from_idx"] = monthIdx(filter.StartDate.UTC())
+	args["to_idx"] = monthIdx(filter.EndDate.UTC())
+
+	breakdown := &models.CostBreakdown{}
+	groups := []struct {
+		query string
+		dest  *[]*models.CostGroup
+	}{
+		{sqliteBreakdownByService, &breakdown.ByService},
+		{sqliteBreakdownByUser, &breakdown.ByUser},
+		{sqliteBreakdownByMonth, &breakdown.ByMonth},
+	}
+	for _, g := range groups {
+		query, args, err := sqlx.BindNamed(sqlx.QUESTION, window+g.query, args)
+		log.Debug("Prepared query", slog.String("string", query), slog.Any("args", args))
+		if err != nil {
+			log.Error("Error while preparing quary",
+				slog.String("err", err.Error()),
+				slog.String("method", "Breakdown"),
+			)
+			return nil, err
+		}
+
+		*g.dest = []*models.CostGroup{}
+		qctx, span := startQuery(ctx, "sqlite", "Breakdown", query)
+		err = r.db.SelectContext(qctx, g.dest, query, args...)
+		endQuery(span, err)
+		if err != nil {
+			log.Error("Error while aggregating entities",
+				slog.String("err", err.Error()),
+				slog.String("method", "Breakdown"),
+			)
+			return nil, classify(err)
+		}
+	}
+
+	return breakdown, nil
+}
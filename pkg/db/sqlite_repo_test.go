@@ -0,0 +1,67 @@
+package db_test
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/EternalQ/effective-mobile-test/migrations"
+	"github.com/EternalQ/effective-mobile-test/pkg/db"
+	"github.com/EternalQ/effective-mobile-test/pkg/db/repotest"
+	"github.com/EternalQ/effective-mobile-test/pkg/service"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/require"
+)
+
+// testSQLite opens a migrated database in a temporary directory.
+func testSQLite(t *testing.T, logger *slog.Logger) *sqlx.DB {
+	t.Helper()
+
+	sqlite, err := db.ConnectSQLite(filepath.Join(t.TempDir(), "test.db"))
+	require.Nil(t, err)
+	t.Cleanup(func() { sqlite.Close() })
+
+	migrator, err := db.NewMigrator(sqlite, migrations.SQLite, logger)
+	require.Nil(t, err)
+	require.Nil(t, migrator.Up(t.Context()))
+
+	return sqlite
+}
+
+func TestSQLiteRepo(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+
+	repotest.Run(t, func(t *testing.T) service.Repository {
+		return db.NewSQLiteRepo(testSQLite(t, logger), 5*time.Second, logger)
+	})
+}
+
+func TestSQLiteRepo_Unrecorded(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	sqlite := testSQLite(t, logger)
+
+	repotest.RunUnrecorded(t, db.NewSQLiteRepo(sqlite, 5*time.Second, logger), func(t *testing.T) {
+		_, err := sqlite.ExecContext(t.Context(), "DROP TRIGGER subscription_events_no_delete")
+		require.Nil(t, err)
+		_, err = sqlite.ExecContext(t.Context(), "DELETE FROM subscription_events")
+		require.Nil(t, err)
+	})
+}
+
+func TestSQLiteAPIKeyRepo(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+
+	repotest.RunKeys(t, func(t *testing.T) service.KeyRepository {
+		return db.NewAPIKeyRepo(testSQLite(t, logger), 5*time.Second, logger)
+	})
+}
+
+func TestSQLiteIdempotencyRepo(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+
+	repotest.RunIdempotency(t, func(t *testing.T) service.IdempotencyRepository {
+		return db.NewIdempotencyRepo(testSQLite(t, logger), 5*time.Second, logger)
+	})
+}
@@ -1,43 +1,98 @@
 package db
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
 	"log/slog"
+	"slices"
 	"strings"
+	"time"
 
+	"github.com/EternalQ/effective-mobile-test/pkg/logctx"
 	"github.com/EternalQ/effective-mobile-test/pkg/models"
+	"github.com/EternalQ/effective-mobile-test/pkg/tenant"
 	"github.com/jmoiron/sqlx"
 )
 
-var ErrNotFound = errors.New("entity not found")
+var (
+	ErrNotFound = errors.New("entity not found")
+	// ErrVersionMismatch is returned when an entity was changed since the
+	// version the caller expects.
+	ErrVersionMismatch = errors.New("entity version mismatch")
+)
 
 type SubscriptionRepo struct {
-	db  *sqlx.DB
-	log *slog.Logger
+	db      *sqlx.DB
+	timeout time.Duration
+	log     *slog.Logger
 }
 
-func NewSubscriptionRepo(db *sqlx.DB, log *slog.Logger) *SubscriptionRepo {
+// NewSubscriptionRepo creates a repository running every query with the
+// given timeout. Zero timeout leaves queries bound by the caller context only.
+func NewSubscriptionRepo(db *sqlx.DB, timeout time.Duration, log *slog.Logger) *SubscriptionRepo {
 	return &SubscriptionRepo{
 		db,
+		timeout,
 		log.With(slog.String("where", "db/SubscriptionRepo")),
 	}
 }
 
+func (r *SubscriptionRepo) logger(ctx context.Context) *slog.Logger {
+	return logctx.From(ctx, r.log, "db/SubscriptionRepo")
+}
+
+func (r *SubscriptionRepo) queryContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if r.timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, r.timeout)
+}
+
+// inTenant runs fn in a transaction with app.tenant_id set to the tenant of
+// ctx. The row-level security policy on subscriptions only lets rows of that
+// tenant through, on top of the tenant conditions of every query.
+func (r *SubscriptionRepo) inTenant(ctx context.Context, fn func(tx *sqlx.Tx) error) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "SELECT set_config('app.tenant_id', $1, true)", tenant.ID(ctx)); err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
 var createSubscription = `
-INSERT INTO subscriptions (service_name, price, user_id, start_date, end_date)
-VALUES ($1, $2, $3, $4, $5)
+INSERT INTO subscriptions (service_name, price, user_id, start_date, end_date, tenant_id)
+VALUES ($1, $2, $3, $4, $5, $6)
 RETURNING *;`
 
-func (r *SubscriptionRepo) Create(s *models.Subscription) error {
-	err := r.db.Get(s, createSubscription, s.ServiceName, s.Price, s.UserId, s.StartDate, s.EndDate)
+func (r *SubscriptionRepo) Create(ctx context.Context, s *models.Subscription) error {
+	log := r.logger(ctx)
+	ctx, cancel := r.queryContext(ctx)
+	defer cancel()
+
+	qctx, span := startQuery(ctx, "postgresql", "Create", createSubscription)
+	err := r.inTenant(qctx, func(tx *sqlx.Tx) error {
+		if err := tx.GetContext(qctx, s, createSubscription, s.ServiceName, s.Price, s.UserId, s.StartDate, s.EndDate, tenant.ID(ctx)); err != nil {
+			return err
+		}
+		return recordEvent(qctx, tx, models.EventCreate, nil, s)
+	})
+	endQuery(span, err)
 	if err != nil {
-		r.log.Error("Error while creating entity",
+		log.Error("Error while creating entity",
 			slog.String("err", err.Error()),
 			slog.String("method", "Create"),
 		)
-		return err
+		return classify(err)
 	}
 
 	return nil
@@ -46,29 +101,34 @@ func (r *SubscriptionRepo) Create(s *models.Subscription) error {
 var readSubscription = `
 SELECT * 
 FROM subscriptions 
-WHERE id = $1`
+WHERE id = $1 AND tenant_id = $2`
+
+func (r *SubscriptionRepo) Read(ctx context.Context, id int) (*models.Subscription, error) {
+	log := r.logger(ctx)
+	ctx, cancel := r.queryContext(ctx)
+	defer cancel()
 
-func (r *SubscriptionRepo) Read(id int) (*models.Subscription, error) {
 	var subscription models.Subscription
-	err := r.db.Get(&subscription, readSubscription, id)
+	qctx, span := startQuery(ctx, "postgresql", "Read", readSubscription)
+	err := r.inTenant(qctx, func(tx *sqlx.Tx) error {
+		return tx.GetContext(qctx, &subscription, readSubscription, id, tenant.ID(ctx))
+	})
+	endQuery(span, err)
 	if err == sql.ErrNoRows {
 		return nil, ErrNotFound
 	} else if err != nil {
-		r.log.Error("Error while getting entity",
+		log.Error("Error while getting entity",
 			slog.String("err", err.Error()),
 			slog.String("method", "Read"),
 		)
-		return nil, err
+		return nil, classify(err)
 	}
 	return &subscription, nil
 }
 
-// var updateSubsription = `
-// UPDATE subscriptions
-// SET service_name = :service_name, price = :price, user_id = :user_id, start_date = :start_date, end_date = :end_date
-// WHERE id = :id`
-
-func (r *SubscriptionRepo) Update(subscription *models.Subscription) error {
+// updateQuery builds an UPDATE of the fields set in subscription, bound to
+// an ownedUpdate. Sending "0" as end_date sets it to NULL.
+func updateQuery(subscription *models.Subscription, owner string) string {
 	fields := []string{}
 	if subscription.UserId != "" {
 		fields = append(fields, "user_id = :user_id")
@@ -91,104 +151,381 @@ func (r *SubscriptionRepo) Update(subscription *models.Subscription) error {
 	// if len(fields) == 0 {
 	// 	return err
 	// }
-	query := fmt.Sprintf("UPDATE subscriptions SET %s WHERE id = :id", strings.Join(fields, ", "))
-	r.log.Debug("Update query", slog.String("string", query))
+	fields = append(fields, "version = version + 1")
 
-	res, err := r.db.NamedExec(query, subscription)
-	if err != nil {
-		r.log.Error("Error while updating entity",
+	condition := ""
+	if subscription.Version != 0 {
+		condition += " AND version = :version"
+	}
+	if owner != "" {
+		condition += " AND user_id = :owner"
+	}
+	return fmt.Sprintf("UPDATE subscriptions SET %s WHERE id = :id AND tenant_id = :tenant_id%s RETURNING version", strings.Join(fields, ", "), condition)
+}
+
+// ownedUpdate binds the parameters of updateQuery.
+type ownedUpdate struct {
+	models.Subscription
+	Owner string `db:"owner"`
+}
+
+// lockSubscription reads a subscription about to change, so its event has
+// the state replaced. Only subscriptions of the user $3 are locked unless it
+// is empty.
+var lockSubscription = readSubscription + ` AND (CAST($3 AS TEXT) = '' OR user_id::text = $3)
+FOR UPDATE`
+
+// var updateSubsription = `
+// UPDATE subscriptions
+// SET service_name = :service_name, price = :price, user_id = :user_id, start_date = :start_date, end_date = :end_date
+// WHERE id = :id`
+
+func (r *SubscriptionRepo) Update(ctx context.Context, subscription *models.Subscription, owner string) error {
+	log := r.logger(ctx)
+	ctx, cancel := r.queryContext(ctx)
+	defer cancel()
+
+	query := updateQuery(subscription, owner)
+	log.Debug("Update query", slog.String("string", query))
+
+	scoped := ownedUpdate{*subscription, owner}
+	scoped.TenantId = tenant.ID(ctx)
+	qctx, span := startQuery(ctx, "postgresql", "Update", query)
+	err := r.inTenant(qctx, func(tx *sqlx.Tx) error {
+		var before, after models.Subscription
+		err := tx.GetContext(qctx, &before, lockSubscription, scoped.Id, scoped.TenantId, owner)
+		if err == sql.ErrNoRows {
+			return ErrNotFound
+		} else if err != nil {
+			return err
+		}
+
+		q, args, err := tx.BindNamed(query, &scoped)
+		if err != nil {
+			return err
+		}
+		err = tx.GetContext(qctx, &subscription.Version, q, args...)
+		if err == sql.ErrNoRows {
+			return ErrVersionMismatch
+		} else if err != nil {
+			return err
+		}
+
+		if err := tx.GetContext(qctx, &after, readSubscription, scoped.Id, scoped.TenantId); err != nil {
+			return err
+		}
+		return recordEvent(qctx, tx, models.EventUpdate, &before, &after)
+	})
+	endQuery(span, err)
+	if errors.Is(err, ErrNotFound) || errors.Is(err, ErrVersionMismatch) {
+		log.Debug("Nothing updated",
 			slog.String("err", err.Error()),
 			slog.String("method", "Update"),
 		)
 		return err
-	}
-
-	n, _ := res.RowsAffected()
-	if n == 0 {
-		r.log.Debug("Nothing updated",
+	} else if err != nil {
+		log.Error("Error while updating entity",
+			slog.String("err", err.Error()),
 			slog.String("method", "Update"),
 		)
-		return ErrNotFound
+		return classify(err)
 	}
 
 	return nil
 }
 
+// deleteSubscription deletes any version when $3 is 0, of any user when $4
+// is empty.
 var deleteSubscription = `
 DELETE FROM subscriptions 
-WHERE id = $1`
+WHERE id = $1 AND tenant_id = $2 AND (CAST($3 AS INT) = 0 OR version = $3) AND (CAST($4 AS TEXT) = '' OR user_id::text = $4)`
 
-func (r *SubscriptionRepo) Delete(id int) error {
-	res, err := r.db.Exec(deleteSubscription, id)
-	if err != nil {
-		r.log.Error("Error while creating entity",
+func (r *SubscriptionRepo) Delete(ctx context.Context, id, version int, owner string) error {
+	log := r.logger(ctx)
+	ctx, cancel := r.queryContext(ctx)
+	defer cancel()
+
+	qctx, span := startQuery(ctx, "postgresql", "Delete", deleteSubscription)
+	err := r.inTenant(qctx, func(tx *sqlx.Tx) error {
+		var before models.Subscription
+		err := tx.GetContext(qctx, &before, lockSubscription, id, tenant.ID(ctx), owner)
+		if err == sql.ErrNoRows {
+			return ErrNotFound
+		} else if err != nil {
+			return err
+		}
+
+		res, err := tx.ExecContext(qctx, deleteSubscription, id, tenant.ID(ctx), version, owner)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return ErrVersionMismatch
+		}
+		return recordEvent(qctx, tx, models.EventDelete, &before, nil)
+	})
+	endQuery(span, err)
+	if errors.Is(err, ErrNotFound) || errors.Is(err, ErrVersionMismatch) {
+		log.Debug("Nothing deleted",
 			slog.String("err", err.Error()),
 			slog.String("method", "Delete"),
 		)
 		return err
-	}
-
-	n, _ := res.RowsAffected()
-	if n == 0 {
-		r.log.Debug("Nothing deleted",
+	} else if err != nil {
+		log.Error("Error while creating entity",
+			slog.String("err", err.Error()),
 			slog.String("method", "Delete"),
 		)
-		return ErrNotFound
+		return classify(err)
 	}
 
 	return nil
 }
 
+// filterConditions builds the WHERE clause for the filter. Depending on the
+// filter mode the date window selects subscriptions overlapping it or fully
+// contained in it.
+func filterConditions(filter *models.SubscriptionFilter) string {
+	conditions := []string{}
+
+	if filter.TenantId != "" {
+		conditions = append(conditions, "tenant_id = :tenant_id")
+	}
+	if filter.UserId != "" {
+		conditions = append(conditions, "user_id = :user_id")
+	}
+	if filter.ServiceName != "" {
+		conditions = append(conditions, "service_name = :service_name")
+	}
+	if filter.UpdatedSince != nil {
+		conditions = append(conditions, "updated_at >= :updated_since")
+	}
+
+	hasStart := !filter.StartDate.IsZero()
+	hasEnd := filter.EndDate != nil && !filter.EndDate.IsZero()
+	if filter.Mode == models.FilterContain {
+		if hasStart {
+			conditions = append(conditions, "start_date >= :start_date")
+		}
+		if hasEnd {
+			conditions = append(conditions, "end_date <= :end_date")
+		}
+	} else {
+		if hasStart {
+			conditions = append(conditions, "(end_date IS NULL OR end_date >= :start_date)")
+		}
+		if hasEnd {
+			conditions = append(conditions, "start_date <= :end_date")
+		}
+	}
+
+	if len(conditions) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(conditions, " AND ")
+}
+
 // var listSubscription = `
 // SELECT *
 // FROM subscriptions
 // WHERE 1=1`
 
-func (r *SubscriptionRepo) List(filter *models.Subscription) ([]*models.Subscription, error) {
-	var subscriptions []*models.Subscription
-	query := "SELECT * FROM subscriptions"
+// History returns the events of a subscription oldest first, deleted
+// subscriptions keep theirs. ErrNotFound means the subscription never existed
+// in the tenant.
+func (r *SubscriptionRepo) History(ctx context.Context, id int) ([]*models.SubscriptionEvent, error) {
+	log := r.logger(ctx)
+	ctx, cancel := r.queryContext(ctx)
+	defer cancel()
 
-	if filter != nil {
-		conditions := []string{}
+	var events []*models.SubscriptionEvent
+	qctx, span := startQuery(ctx, "postgresql", "History", r.db.Rebind(subscriptionHistory))
+	err := r.inTenant(qctx, func(tx *sqlx.Tx) (err error) {
+		events, err = readHistory(qctx, tx, id)
+		return err
+	})
+	endQuery(span, err)
+	if errors.Is(err, ErrNotFound) {
+		return nil, err
+	} else if err != nil {
+		log.Error("Error while getting history",
+			slog.String("err", err.Error()),
+			slog.String("method", "History"),
+		)
+		return nil, classify(err)
+	}
+	return events, nil
+}
 
-		if filter.UserId != "" {
-			conditions = append(conditions, "user_id = :user_id")
-		}
-		if filter.ServiceName != "" {
-			conditions = append(conditions, "service_name = :service_name")
-		}
-		if !filter.StartDate.IsZero() {
-			conditions = append(conditions, "start_date >= :start_date")
-		}
-		if filter.EndDate != nil && !filter.EndDate.IsZero() {
-			conditions = append(conditions, "end_date <= :end_date")
-		}
+// List returns subscriptions matching the filter. A nil page returns every
+// matching row.
+func (r *SubscriptionRepo) List(ctx context.Context, filter *models.SubscriptionFilter, page *models.Pagination) ([]*models.Subscription, error) {
+	log := r.logger(ctx)
+	ctx, cancel := r.queryContext(ctx)
+	defer cancel()
+
+	subscriptions := []*models.Subscription{}
+	filter = scopedFilter(ctx, filter)
 
-		if len(conditions) > 0 {
-			query += " WHERE " + strings.Join(conditions, " AND ")
+	query := "SELECT * FROM subscriptions" + filterConditions(filter)
+	if page != nil {
+		field, desc := page.SortField()
+		if !slices.Contains(models.SortFields, field) {
+			return nil, models.ErrInvalidSort
 		}
-	} else {
-		filter = &models.Subscription{}
+		order := "ASC"
+		if desc {
+			order = "DESC"
+		}
+		query += fmt.Sprintf(" ORDER BY %s %s, id %s LIMIT %d OFFSET %d", field, order, order, page.Limit, page.Offset)
 	}
-	r.log.Debug("Select query", slog.String("string", query))
+	log.Debug("Select query", slog.String("string", query))
 
 	query, args, err := sqlx.BindNamed(sqlx.DOLLAR, query, filter)
-	r.log.Debug("Prepared query", slog.String("string", query), slog.Any("args", args))
+	log.Debug("Prepared query", slog.String("string", query), slog.Any("args", args))
 	if err != nil {
-		r.log.Error("Error while preparing quary",
+		log.Error("Error while preparing quary",
 			slog.String("err", err.Error()),
 			slog.String("method", "List"),
 		)
 		return nil, err
 	}
-	err = r.db.Select(&subscriptions, query, args...)
+	qctx, span := startQuery(ctx, "postgresql", "List", query)
+	err = r.inTenant(qctx, func(tx *sqlx.Tx) error {
+		return tx.SelectContext(qctx, &subscriptions, query, args...)
+	})
+	endQuery(span, err)
 	if err != nil {
-		r.log.Error("Error while listing entity",
+		log.Error("Error while listing entity",
 			slog.String("err", err.Error()),
 			slog.String("method", "List"),
 		)
-		return nil, err
+		return nil, classify(err)
 	}
 
 	return subscriptions, nil
 }
+
+// Count returns the number of subscriptions matching the filter.
+func (r *SubscriptionRepo) Count(ctx context.Context, filter *models.SubscriptionFilter) (int, error) {
+	log := r.logger(ctx)
+	ctx, cancel := r.queryContext(ctx)
+	defer cancel()
+
+	filter = scopedFilter(ctx, filter)
+
+	query, args, err := sqlx.BindNamed(sqlx.DOLLAR, "SELECT COUNT(*) FROM subscriptions"+filterConditions(filter), filter)
+	log.Debug("Prepared query", slog.String("string", query), slog.Any("args", args))
+	if err != nil {
+		log.Error("Error while preparing quary",
+			slog.String("err", err.Error()),
+			slog.String("method", "Count"),
+		)
+		return 0, err
+	}
+
+	var count int
+	qctx, span := startQuery(ctx, "postgresql", "Count", query)
+	err = r.inTenant(qctx, func(tx *sqlx.Tx) error {
+		return tx.GetContext(qctx, &count, query, args...)
+	})
+	endQuery(span, err)
+	if err != nil {
+		log.Error("Error while counting entities",
+			slog.String("err", err.Error()),
+			slog.String("method", "Count"),
+		)
+		return 0, classify(err)
+	}
+
+	return count, nil
+}
+
+// breakdownWindow clips every matching subscription to the filter window
+// and counts the months it is active within it. Formatted with the filter
+// conditions.
+var breakdownWindow = `
+WITH windowed AS (
+	SELECT service_name, user_id, price, from_month, to_month,
+		(EXTRACT(YEAR FROM to_month) - EXTRACT(YEAR FROM from_month)) * 12
+			+ EXTRACT(MONTH FROM to_month) - EXTRACT(MONTH FROM from_month) + 1 AS months
+	FROM (
+		SELECT service_name, user_id, price,
+			date_trunc('month', GREATEST(start_date, :start_date)) AS from_month,
+			date_trunc('month', LEAST(COALESCE(end_date, :end_date), :end_date)) AS to_month
+		FROM subscriptions%s
+	) AS clipped
+)`
+
+var breakdownByService = `
+SELECT service_name AS key, COUNT(*) AS count, CAST(COALESCE(SUM(price * months), 0) AS BIGINT) AS total
+FROM windowed
+WHERE months > 0
+GROUP BY service_name
+ORDER BY service_name`
+
+var breakdownByUser = `
+SELECT CAST(user_id AS TEXT) AS key, COUNT(*) AS count, CAST(COALESCE(SUM(price * months), 0) AS BIGINT) AS total
+FROM windowed
+WHERE months > 0
+GROUP BY user_id
+ORDER BY user_id`
+
+var breakdownByMonth = `
+SELECT to_char(m, 'MM-YYYY') AS key, COUNT(w.price) AS count, CAST(COALESCE(SUM(w.price), 0) AS BIGINT) AS total
+FROM generate_series(
+	date_trunc('month', CAST(:start_date AS TIMESTAMP)),
+	date_trunc('month', CAST(:end_date AS TIMESTAMP)),
+	INTERVAL '1 month'
+) AS m
+LEFT JOIN windowed w ON w.from_month <= m AND w.to_month >= m
+GROUP BY m
+ORDER BY m`
+
+// Breakdown aggregates the cost of subscriptions matching the filter by
+// service, by user and by month. The filter must have both window dates set.
+func (r *SubscriptionRepo) Breakdown(ctx context.Context, filter *models.SubscriptionFilter) (*models.CostBreakdown, error) {
+	log := r.logger(ctx)
+	ctx, cancel := r.queryContext(ctx)
+	defer cancel()
+
+	filter = scopedFilter(ctx, filter)
+	window := fmt.Sprintf(breakdownWindow, filterConditions(filter))
+
+	breakdown := &models.CostBreakdown{}
+	groups := []struct {
+		query string
+		dest  *[]*models.CostGroup
+	}{
+		{breakdownByService, &breakdown.ByService},
+		{breakdownByUser, &breakdown.ByUser},
+		{breakdownByMonth, &breakdown.ByMonth},
+	}
+	for _, g := range groups {
+		query, args, err := sqlx.BindNamed(sqlx.DOLLAR, window+g.query, filter)
+		log.Debug("Prepared query", slog.String("string", query), slog.Any("args", args))
+		if err != nil {
+			log.Error("Error while preparing quary",
+				slog.String("err", err.Error()),
+				slog.String("method", "Breakdown"),
+			)
+			return nil, err
+		}
+
+		*g.dest = []*models.CostGroup{}
+		qctx, span := startQuery(ctx, "postgresql", "Breakdown", query)
+		err = r.inTenant(qctx, func(tx *sqlx.Tx) error {
+			return tx.SelectContext(qctx, g.dest, query, args...)
+		})
+		endQuery(span, err)
+		if err != nil {
+			log.Error("Error while aggregating entities",
+				slog.String("err", err.Error()),
+				slog.String("method", "Breakdown"),
+			)
+			return nil, classify(err)
+		}
+	}
+
+	return breakdown, nil
+}
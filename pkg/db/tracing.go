@@ -0,0 +1,36 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/EternalQ/effective-mobile-test/pkg/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("github.com/EternalQ/effective-mobile-test/pkg/db")
+
+// startQuery starts a span for a single SQL statement of a repository
+// method.
+func startQuery(ctx context.Context, system, method, query string) (context.Context, trace.Span) {
+	return tracer.Start(ctx, "SQL "+method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system.name", system),
+			attribute.String("db.operation.name", method),
+			attribute.String("db.query.text", query),
+		),
+	)
+}
+
+// endQuery ends a statement span. No rows is an expected outcome, not an
+// error.
+func endQuery(span trace.Span, err error) {
+	if errors.Is(err, sql.ErrNoRows) {
+		err = nil
+	}
+	tracing.End(span, err)
+}
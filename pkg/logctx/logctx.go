@@ -0,0 +1,48 @@
+// Package logctx carries a request-scoped logger and the request ID through a
+// context, so log lines and audit records written by api, service and db
+// share the request attributes.
+package logctx
+
+import (
+	"context"
+	"log/slog"
+)
+
+type ctxKey struct{}
+
+type requestIDKey struct{}
+
+// With returns a copy of ctx carrying log.
+func With(ctx context.Context, log *slog.Logger) context.Context {
+	return context.WithValue(ctx, ctxKey{}, log)
+}
+
+// From returns the logger stored in ctx tagged with where, or fallback when
+// ctx has none. fallback is expected to be tagged with where already.
+func From(ctx context.Context, fallback *slog.Logger, where string) *slog.Logger {
+	if log, ok := ctx.Value(ctxKey{}).(*slog.Logger); ok {
+		return log.With(slog.String("where", where))
+	}
+	return fallback
+}
+
+// WithAttrs returns a copy of ctx whose logger carries attrs as well. ctx
+// without a logger is returned as is.
+func WithAttrs(ctx context.Context, attrs ...any) context.Context {
+	log, ok := ctx.Value(ctxKey{}).(*slog.Logger)
+	if !ok {
+		return ctx
+	}
+	return With(ctx, log.With(attrs...))
+}
+
+// WithRequestID returns a copy of ctx carrying the request ID.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the request ID stored in ctx, empty outside requests.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
@@ -0,0 +1,43 @@
+package logctx
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFrom(t *testing.T) {
+	var buf bytes.Buffer
+	root := slog.New(slog.NewJSONHandler(&buf, nil))
+	fallback := root.With(slog.String("where", "test/Fallback"))
+
+	From(context.Background(), fallback, "test/Component").Info("no request")
+
+	ctx := With(context.Background(), root.With(slog.String("request_id", "abc")))
+	From(ctx, fallback, "test/Component").Info("in request")
+
+	ctx = WithAttrs(ctx, slog.String("tenant", "acme"))
+	From(ctx, fallback, "test/Component").Info("in tenant")
+
+	dec := json.NewDecoder(&buf)
+	var line map[string]any
+
+	require.NoError(t, dec.Decode(&line))
+	assert.Equal(t, "test/Fallback", line["where"])
+	assert.NotContains(t, line, "request_id")
+
+	line = nil
+	require.NoError(t, dec.Decode(&line))
+	assert.Equal(t, "test/Component", line["where"])
+	assert.Equal(t, "abc", line["request_id"])
+
+	line = nil
+	require.NoError(t, dec.Decode(&line))
+	assert.Equal(t, "abc", line["request_id"])
+	assert.Equal(t, "acme", line["tenant"])
+}
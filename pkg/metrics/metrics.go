@@ -0,0 +1,135 @@
+// Package metrics exposes HTTP, repository, connection pool and business
+// metrics in the Prometheus text format.
+package metrics
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/EternalQ/effective-mobile-test/pkg/models"
+	"github.com/EternalQ/effective-mobile-test/pkg/tenant"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const collectTimeout = 5 * time.Second
+
+type Metrics struct {
+	log      *slog.Logger
+	registry *prometheus.Registry
+
+	httpRequests  *prometheus.CounterVec
+	httpDuration  *prometheus.HistogramVec
+	queryDuration *prometheus.HistogramVec
+}
+
+func New(log *slog.Logger) *Metrics {
+	m := &Metrics{
+		log.With(slog.String("where", "metrics/Metrics")),
+		prometheus.NewRegistry(),
+		prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "http_requests_total",
+			Help: "Number of handled HTTP requests.",
+		}, []string{"method", "route", "status"}),
+		prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "http_request_duration_seconds",
+			Help:    "Latency of handled HTTP requests.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"method", "route", "status"}),
+		prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "repository_query_duration_seconds",
+			Help:    "Duration of subscription repository calls.",
+			Buckets: []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+		}, []string{"method", "outcome"}),
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.httpRequests,
+		m.httpDuration,
+		m.queryDuration,
+	)
+	return m
+}
+
+// Handler serves every registered metric.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{
+		ErrorLog: slog.NewLogLogger(m.log.Handler(), slog.LevelError),
+	})
+}
+
+// ObserveRequest records a handled HTTP request. route is the route
+// template so paths with IDs share a series.
+func (m *Metrics) ObserveRequest(method, route string, status int, d time.Duration) {
+	code := strconv.Itoa(status)
+	m.httpRequests.WithLabelValues(method, route, code).Inc()
+	m.httpDuration.WithLabelValues(method, route, code).Observe(d.Seconds())
+}
+
+// ObserveQuery records a repository call.
+func (m *Metrics) ObserveQuery(method string, err error, d time.Duration) {
+	outcome := "ok"
+	if err != nil {
+		outcome = "error"
+	}
+	m.queryDuration.WithLabelValues(method, outcome).Observe(d.Seconds())
+}
+
+// RegisterDB exports the connection pool stats of db, labeled with name.
+func (m *Metrics) RegisterDB(db *sql.DB, name string) {
+	m.registry.MustRegister(collectors.NewDBStatsCollector(db, name))
+}
+
+// RegisterSubscriptions exports the number of active subscriptions and
+// their monthly recurring spend for each of tenants, calling recurring on
+// every scrape.
+func (m *Metrics) RegisterSubscriptions(recurring func(context.Context, time.Time) (*models.CostGroup, error), tenants []*tenant.Tenant) {
+	m.registry.MustRegister(&subscriptionCollector{
+		m.log,
+		recurring,
+		tenants,
+		prometheus.NewDesc("subscriptions_active", "Number of subscriptions active in the current month of the tenant.", []string{"tenant"}, nil),
+		prometheus.NewDesc("subscriptions_monthly_spend", "Sum of monthly prices of subscriptions active in the current month of the tenant.", []string{"tenant"}, nil),
+	})
+}
+
+type subscriptionCollector struct {
+	log       *slog.Logger
+	recurring func(context.Context, time.Time) (*models.CostGroup, error)
+	tenants   []*tenant.Tenant
+	active    *prometheus.Desc
+	spend     *prometheus.Desc
+}
+
+func (c *subscriptionCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.active
+	ch <- c.spend
+}
+
+// Collect skips both gauges of a tenant when the repository fails, so
+// scrapes still return the other metrics.
+func (c *subscriptionCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), collectTimeout)
+	defer cancel()
+
+	for _, t := range c.tenants {
+		group, err := c.recurring(tenant.WithTenant(ctx, t), t.CurrentMonth())
+		if err != nil {
+			c.log.Error("Error while collecting subscription metrics",
+				slog.String("err", err.Error()),
+				slog.String("tenant", t.Id),
+			)
+			continue
+		}
+
+		ch <- prometheus.MustNewConstMetric(c.active, prometheus.GaugeValue, float64(group.Count), t.Id)
+		ch <- prometheus.MustNewConstMetric(c.spend, prometheus.GaugeValue, float64(group.Total), t.Id)
+	}
+}
@@ -0,0 +1,87 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/EternalQ/effective-mobile-test/pkg/db"
+	"github.com/EternalQ/effective-mobile-test/pkg/models"
+	"github.com/EternalQ/effective-mobile-test/pkg/tenant"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func scrape(t *testing.T, m *Metrics) string {
+	t.Helper()
+	w := httptest.NewRecorder()
+	m.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	body, err := io.ReadAll(w.Body)
+	require.NoError(t, err)
+	return string(body)
+}
+
+func TestMetrics(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+
+	t.Run("http requests", func(t *testing.T) {
+		m := New(logger)
+		m.ObserveRequest("GET", "/api/subscriptions/{id}", 404, 10*time.Millisecond)
+
+		out := scrape(t, m)
+		assert.Contains(t, out, `http_requests_total{method="GET",route="/api/subscriptions/{id}",status="404"} 1`)
+		assert.Contains(t, out, `http_request_duration_seconds_count{method="GET",route="/api/subscriptions/{id}",status="404"} 1`)
+	})
+
+	t.Run("repository calls", func(t *testing.T) {
+		m := New(logger)
+		repo := InstrumentRepository(db.NewMemoryRepo(logger), m)
+
+		ctx := context.Background()
+		require.NoError(t, repo.Create(ctx, &models.Subscription{
+			ServiceName: "Yandex Plus",
+			Price:       400,
+			UserId:      "60601fee-2bf1-4721-ae6f-7636e79a0cba",
+			StartDate:   time.Date(2025, 7, 1, 0, 0, 0, 0, time.UTC),
+		}))
+		_, err := repo.Read(ctx, 100)
+		require.ErrorIs(t, err, db.ErrNotFound)
+
+		out := scrape(t, m)
+		assert.Contains(t, out, `repository_query_duration_seconds_count{method="Create",outcome="ok"} 1`)
+		assert.Contains(t, out, `repository_query_duration_seconds_count{method="Read",outcome="error"} 1`)
+	})
+
+	t.Run("subscriptions", func(t *testing.T) {
+		m := New(logger)
+		m.RegisterSubscriptions(func(ctx context.Context, _ time.Time) (*models.CostGroup, error) {
+			if tenant.ID(ctx) == "acme" {
+				return &models.CostGroup{Key: "07-2025", Count: 1, Total: 500}, nil
+			}
+			return &models.CostGroup{Key: "07-2025", Count: 3, Total: 1200}, nil
+		}, []*tenant.Tenant{{Id: "acme"}, {Id: tenant.DefaultID}})
+
+		out := scrape(t, m)
+		assert.Contains(t, out, `subscriptions_active{tenant="default"} 3`)
+		assert.Contains(t, out, `subscriptions_monthly_spend{tenant="default"} 1200`)
+		assert.Contains(t, out, `subscriptions_active{tenant="acme"} 1`)
+	})
+
+	t.Run("subscriptions unavailable", func(t *testing.T) {
+		m := New(logger)
+		m.RegisterSubscriptions(func(context.Context, time.Time) (*models.CostGroup, error) {
+			return nil, errors.New("database is down")
+		}, []*tenant.Tenant{{Id: tenant.DefaultID}})
+
+		out := scrape(t, m)
+		assert.NotContains(t, out, "subscriptions_active")
+		assert.Contains(t, out, "go_goroutines")
+	})
+}
@@ -0,0 +1,76 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/EternalQ/effective-mobile-test/pkg/models"
+	"github.com/EternalQ/effective-mobile-test/pkg/service"
+)
+
+// Repository wraps a service.Repository and records the duration of every
+// call.
+type Repository struct {
+	next    service.Repository
+	metrics *Metrics
+}
+
+func InstrumentRepository(next service.Repository, m *Metrics) *Repository {
+	return &Repository{next, m}
+}
+
+func (r *Repository) Create(ctx context.Context, s *models.Subscription) error {
+	start := time.Now()
+	err := r.next.Create(ctx, s)
+	r.metrics.ObserveQuery("Create", err, time.Since(start))
+	return err
+}
+
+func (r *Repository) Read(ctx context.Context, id int) (*models.Subscription, error) {
+	start := time.Now()
+	sub, err := r.next.Read(ctx, id)
+	r.metrics.ObserveQuery("Read", err, time.Since(start))
+	return sub, err
+}
+
+func (r *Repository) Update(ctx context.Context, s *models.Subscription, owner string) error {
+	start := time.Now()
+	err := r.next.Update(ctx, s, owner)
+	r.metrics.ObserveQuery("Update", err, time.Since(start))
+	return err
+}
+
+func (r *Repository) Delete(ctx context.Context, id, version int, owner string) error {
+	start := time.Now()
+	err := r.next.Delete(ctx, id, version, owner)
+	r.metrics.ObserveQuery("Delete", err, time.Since(start))
+	return err
+}
+
+func (r *Repository) History(ctx context.Context, id int) ([]*models.SubscriptionEvent, error) {
+	start := time.Now()
+	events, err := r.next.History(ctx, id)
+	r.metrics.ObserveQuery("History", err, time.Since(start))
+	return events, err
+}
+
+func (r *Repository) List(ctx context.Context, filter *models.SubscriptionFilter, page *models.Pagination) ([]*models.Subscription, error) {
+	start := time.Now()
+	subs, err := r.next.List(ctx, filter, page)
+	r.metrics.ObserveQuery("List", err, time.Since(start))
+	return subs, err
+}
+
+func (r *Repository) Count(ctx context.Context, filter *models.SubscriptionFilter) (int, error) {
+	start := time.Now()
+	count, err := r.next.Count(ctx, filter)
+	r.metrics.ObserveQuery("Count", err, time.Since(start))
+	return count, err
+}
+
+func (r *Repository) Breakdown(ctx context.Context, filter *models.SubscriptionFilter) (*models.CostBreakdown, error) {
+	start := time.Now()
+	breakdown, err := r.next.Breakdown(ctx, filter)
+	r.metrics.ObserveQuery("Breakdown", err, time.Since(start))
+	return breakdown, err
+}
@@ -0,0 +1,118 @@
+package models
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Scope grants access to a part of the API. Scopes are ordered, each one
+// includes the ones before it: read < write < admin.
+type Scope string
+
+const (
+	ScopeRead  Scope = "read"
+	ScopeWrite Scope = "write"
+	ScopeAdmin Scope = "admin"
+)
+
+var scopeOrder = []Scope{ScopeRead, ScopeWrite, ScopeAdmin}
+
+var ErrInvalidScope = errors.New("invalid scope")
+
+// Scopes is a set of scopes, stored as a comma separated list.
+type Scopes []Scope
+
+// ParseScopes validates scopes and removes duplicates.
+func ParseScopes(scopes []string) (Scopes, error) {
+	if len(scopes) == 0 {
+		return nil, &FieldError{Field: "scopes", Message: "needs at least one of read, write, admin", Err: ErrInvalidScope}
+	}
+
+	res := Scopes{}
+	for _, s := range scopes {
+		scope := Scope(strings.TrimSpace(s))
+		if !slices.Contains(scopeOrder, scope) {
+			return nil, &FieldError{Field: "scopes", Message: fmt.Sprintf("unknown scope %q, expected read, write or admin", s), Err: ErrInvalidScope}
+		}
+		if !slices.Contains(res, scope) {
+			res = append(res, scope)
+		}
+	}
+	return res, nil
+}
+
+// Allows reports whether any of the scopes includes required.
+func (s Scopes) Allows(required Scope) bool {
+	need := slices.Index(scopeOrder, required)
+	for _, scope := range s {
+		if slices.Index(scopeOrder, scope) >= need {
+			return true
+		}
+	}
+	return false
+}
+
+func (s Scopes) Value() (driver.Value, error) {
+	parts := make([]string, len(s))
+	for i, scope := range s {
+		parts[i] = string(scope)
+	}
+	return strings.Join(parts, ","), nil
+}
+
+func (s *Scopes) Scan(src any) error {
+	var raw string
+	switch v := src.(type) {
+	case string:
+		raw = v
+	case []byte:
+		raw = string(v)
+	default:
+		return fmt.Errorf("can't scan %T into Scopes", src)
+	}
+
+	*s = Scopes{}
+	if raw == "" {
+		return nil
+	}
+	for _, part := range strings.Split(raw, ",") {
+		*s = append(*s, Scope(part))
+	}
+	return nil
+}
+
+// APIKey is a stored API key. Only the SHA-256 hash of the key is kept,
+// Prefix holds its first characters so keys can be told apart.
+type APIKey struct {
+	Id        int        `json:"id" db:"id"`
+	Name      string     `json:"name" db:"name" example:"billing-export"`
+	Prefix    string     `json:"prefix" db:"prefix" example:"emk_3f9a1c"`
+	Hash      string     `json:"-" db:"key_hash"`
+	Scopes    Scopes     `json:"scopes" db:"scopes" swaggertype:"array,string" example:"read,write"`
+	CreatedAt time.Time  `json:"created_at" db:"created_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty" db:"revoked_at"`
+	// UserId is the user a non-admin key acts for, see auth.Principal.
+	UserId string `json:"user_id,omitempty" db:"user_id" example:"60601fee-2bf1-4721-ae6f-7636e79a0cba"`
+	// TenantId is the tenant the key was created in, non-admin keys only
+	// act for it.
+	TenantId string `json:"tenant_id" db:"tenant_id" example:"default"`
+}
+
+// NewAPIKey is the request body of API key creation.
+type NewAPIKey struct {
+	Name   string   `json:"name" example:"billing-export"`
+	Scopes []string `json:"scopes" example:"read,write"`
+	// UserId binds the key to a user, required unless the key is an admin
+	// one.
+	UserId string `json:"user_id" example:"60601fee-2bf1-4721-ae6f-7636e79a0cba"`
+}
+
+// CreatedAPIKey returns the plain key once, right after creation.
+type CreatedAPIKey struct {
+	*APIKey
+	Key string `json:"key" example:"emk_3f9a1c0e5b2d4c7a9e8f1b3d5c7a9e0f2b4d6c8a0e2f4b6d"`
+}
@@ -0,0 +1,48 @@
+package models_test
+
+import (
+	"testing"
+
+	"github.com/EternalQ/effective-mobile-test/pkg/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseScopes(t *testing.T) {
+	scopes, err := models.ParseScopes([]string{"read", " write", "read"})
+	assert.Nil(t, err)
+	assert.Equal(t, models.Scopes{models.ScopeRead, models.ScopeWrite}, scopes)
+
+	_, err = models.ParseScopes(nil)
+	assert.ErrorIs(t, err, models.ErrInvalidScope)
+
+	_, err = models.ParseScopes([]string{"root"})
+	assert.ErrorIs(t, err, models.ErrInvalidScope)
+}
+
+func TestScopes_Allows(t *testing.T) {
+	tests := []struct {
+		scopes   models.Scopes
+		required models.Scope
+		want     bool
+	}{
+		{models.Scopes{models.ScopeRead}, models.ScopeRead, true},
+		{models.Scopes{models.ScopeRead}, models.ScopeWrite, false},
+		{models.Scopes{models.ScopeWrite}, models.ScopeRead, true},
+		{models.Scopes{models.ScopeWrite}, models.ScopeAdmin, false},
+		{models.Scopes{models.ScopeAdmin}, models.ScopeWrite, true},
+		{models.Scopes{}, models.ScopeRead, false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, tt.scopes.Allows(tt.required), "%v allows %s", tt.scopes, tt.required)
+	}
+}
+
+func TestScopes_ValueScan(t *testing.T) {
+	v, err := models.Scopes{models.ScopeRead, models.ScopeAdmin}.Value()
+	assert.Nil(t, err)
+	assert.Equal(t, "read,admin", v)
+
+	var s models.Scopes
+	assert.Nil(t, s.Scan([]byte("read,admin")))
+	assert.Equal(t, models.Scopes{models.ScopeRead, models.ScopeAdmin}, s)
+}
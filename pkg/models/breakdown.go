@@ -0,0 +1,18 @@
+package models
+
+// CostGroup is a total cost of subscriptions sharing the same key.
+type CostGroup struct {
+	Key   string `json:"key" db:"key"`
+	Count int    `json:"count" db:"count"`
+	Total int    `json:"total" db:"total"`
+}
+
+// CostBreakdown splits the total cost of a filter window by service, by user
+// and by calendar month. Month keys use SubscrTimeLayout.
+type CostBreakdown struct {
+	// Currency is the ISO 4217 code of the tenant the totals are in.
+	Currency  string       `json:"currency,omitempty"`
+	ByService []*CostGroup `json:"by_service"`
+	ByUser    []*CostGroup `json:"by_user"`
+	ByMonth   []*CostGroup `json:"by_month"`
+}
@@ -0,0 +1,17 @@
+package models
+
+// FieldError reports an invalid value of a single input field. Err keeps the
+// underlying sentinel error, if any, for errors.Is checks.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+	Err     error  `json:"-"`
+}
+
+func (e *FieldError) Error() string {
+	return e.Field + ": " + e.Message
+}
+
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
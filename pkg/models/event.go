@@ -0,0 +1,86 @@
+package models
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// EventAction is the kind of change a SubscriptionEvent records.
+type EventAction string
+
+const (
+	EventCreate EventAction = "create"
+	EventUpdate EventAction = "update"
+	EventDelete EventAction = "delete"
+)
+
+// SubscriptionEvent is an entry of the change history of a subscription.
+// Events are never changed once written.
+type SubscriptionEvent struct {
+	Id             int         `json:"id" db:"id"`
+	TenantId       string      `json:"-" db:"tenant_id"`
+	SubscriptionId int         `json:"subscription_id" db:"subscription_id"`
+	Action         EventAction `json:"action" db:"action" enums:"create,update,delete"`
+	// Actor is the caller that made the change, see auth.Principal.Actor.
+	Actor     string `json:"actor" db:"actor" example:"key:1"`
+	RequestId string `json:"request_id" db:"request_id"`
+	// Before and After hold the subscription around the change, null when
+	// it did not exist.
+	Before    Snapshot  `json:"before" db:"before" swaggertype:"object"`
+	After     Snapshot  `json:"after" db:"after" swaggertype:"object"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+// Snapshot is a subscription serialized as JSON the way the API returns
+// it, empty when there is none.
+type Snapshot []byte
+
+// NewSnapshot serializes s, nil gives an empty snapshot.
+func NewSnapshot(s *Subscription) (Snapshot, error) {
+	if s == nil {
+		return nil, nil
+	}
+	c := *s
+	c.Format()
+	return json.Marshal(&c)
+}
+
+func (s Snapshot) MarshalJSON() ([]byte, error) {
+	if len(s) == 0 {
+		return []byte("null"), nil
+	}
+	return s, nil
+}
+
+func (s *Snapshot) UnmarshalJSON(b []byte) error {
+	if bytes.Equal(b, []byte("null")) {
+		*s = nil
+		return nil
+	}
+	*s = bytes.Clone(b)
+	return nil
+}
+
+func (s Snapshot) Value() (driver.Value, error) {
+	if len(s) == 0 {
+		return nil, nil
+	}
+	return string(s), nil
+}
+
+func (s *Snapshot) Scan(src any) error {
+	switch v := src.(type) {
+	case nil:
+		*s = nil
+	case string:
+		*s = Snapshot(v)
+	case []byte:
+		*s = bytes.Clone(v)
+	default:
+		return fmt.Errorf("can't scan %T into Snapshot", src)
+	}
+	return nil
+}
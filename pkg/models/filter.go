@@ -0,0 +1,42 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+var ErrInvalidFilterMode = errors.New("invalid filter mode")
+
+// FilterMode selects how the filter date window is matched against
+// subscription dates.
+type FilterMode string
+
+const (
+	// FilterOverlap matches every subscription active at any point of the window.
+	FilterOverlap FilterMode = "overlap"
+	// FilterContain matches only subscriptions fully contained in the window.
+	FilterContain FilterMode = "contain"
+)
+
+type SubscriptionFilter struct {
+	Subscription
+	Mode FilterMode `json:"mode" db:"-" enums:"overlap,contain" default:"overlap"`
+	// UpdatedSince matches subscriptions changed at or after the time.
+	UpdatedSince *time.Time `json:"updated_since,omitempty" db:"updated_since"`
+}
+
+func (f *SubscriptionFilter) Parse() error {
+	if err := f.Subscription.Parse(); err != nil {
+		return err
+	}
+
+	switch f.Mode {
+	case "":
+		f.Mode = FilterOverlap
+	case FilterOverlap, FilterContain:
+	default:
+		return &FieldError{Field: "mode", Message: "must be one of overlap, contain", Err: ErrInvalidFilterMode}
+	}
+
+	return nil
+}
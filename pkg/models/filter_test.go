@@ -0,0 +1,51 @@
+package models_test
+
+import (
+	"testing"
+
+	"github.com/EternalQ/effective-mobile-test/pkg/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSubscriptionFilter_Parse(t *testing.T) {
+	tests := []struct {
+		name string
+		mode models.FilterMode
+
+		wantMode models.FilterMode
+		wantErr  bool
+	}{
+		{
+			name:     "default",
+			mode:     "",
+			wantMode: models.FilterOverlap,
+		},
+		{
+			name:     "overlap",
+			mode:     models.FilterOverlap,
+			wantMode: models.FilterOverlap,
+		},
+		{
+			name:     "contain",
+			mode:     models.FilterContain,
+			wantMode: models.FilterContain,
+		},
+		{
+			name:    "invalid",
+			mode:    "wrong",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &models.SubscriptionFilter{Mode: tt.mode}
+			gotErr := f.Parse()
+			if tt.wantErr {
+				assert.ErrorIs(t, gotErr, models.ErrInvalidFilterMode)
+				return
+			}
+			assert.Nil(t, gotErr)
+			assert.Equal(t, tt.wantMode, f.Mode)
+		})
+	}
+}
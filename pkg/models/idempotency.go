@@ -0,0 +1,56 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// IdempotencyKey is a request sent with an Idempotency-Key header. Keys are
+// unique per tenant and client. A pending key has no status yet, its request
+// is still being handled.
+type IdempotencyKey struct {
+	TenantId string `db:"tenant_id"`
+	Client   string `db:"client"`
+	Key      string `db:"key"`
+	// RequestHash tells apart requests reusing the key.
+	RequestHash string    `db:"request_hash"`
+	Status      int       `db:"status"`
+	Headers     Headers   `db:"headers"`
+	Response    []byte    `db:"response"`
+	CreatedAt   time.Time `db:"created_at"`
+	ExpiresAt   time.Time `db:"expires_at"`
+}
+
+// Headers are the response headers replayed with a key, stored as a JSON
+// object.
+type Headers map[string]string
+
+func (h Headers) Value() (driver.Value, error) {
+	if len(h) == 0 {
+		return nil, nil
+	}
+	b, err := json.Marshal(h)
+	return string(b), err
+}
+
+func (h *Headers) Scan(src any) error {
+	var b []byte
+	switch v := src.(type) {
+	case nil:
+		*h = nil
+		return nil
+	case string:
+		b = []byte(v)
+	case []byte:
+		b = v
+	default:
+		return fmt.Errorf("can't scan %T into Headers", src)
+	}
+	return json.Unmarshal(b, h)
+}
+
+func (k *IdempotencyKey) Pending() bool {
+	return k.Status == 0
+}
@@ -0,0 +1,66 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+const (
+	DefaultPageLimit = 50
+	MaxPageLimit     = 1000
+)
+
+var (
+	ErrInvalidPage = errors.New("invalid limit or offset")
+	ErrInvalidSort = errors.New("invalid sort field")
+)
+
+// SortFields lists subscription fields accepted by Pagination.Sort.
+var SortFields = []string{"id", "price", "start_date", "service_name"}
+
+// Pagination describes a single page of a listing. Sort holds a field from
+// SortFields, prefixed with "-" for descending order.
+type Pagination struct {
+	Limit  int
+	Offset int
+	Sort   string
+}
+
+func (p *Pagination) Parse() error {
+	if p.Limit == 0 {
+		p.Limit = DefaultPageLimit
+	}
+	if p.Limit < 0 || p.Limit > MaxPageLimit {
+		return &FieldError{Field: "limit", Message: fmt.Sprintf("must be between 1 and %d", MaxPageLimit), Err: ErrInvalidPage}
+	}
+	if p.Offset < 0 {
+		return &FieldError{Field: "offset", Message: "must not be negative", Err: ErrInvalidPage}
+	}
+
+	if p.Sort == "" {
+		p.Sort = "id"
+	}
+	if field, _ := p.SortField(); !slices.Contains(SortFields, field) {
+		return &FieldError{Field: "sort", Message: "must be one of " + strings.Join(SortFields, ", "), Err: ErrInvalidSort}
+	}
+
+	return nil
+}
+
+// SortField splits Sort into the field name and the direction.
+func (p *Pagination) SortField() (field string, desc bool) {
+	if field, ok := strings.CutPrefix(p.Sort, "-"); ok {
+		return field, true
+	}
+	return p.Sort, false
+}
+
+type SubscriptionPage struct {
+	Items      []*Subscription `json:"items"`
+	Total      int             `json:"total"`
+	Limit      int             `json:"limit"`
+	Offset     int             `json:"offset"`
+	NextOffset *int            `json:"next_offset"`
+}
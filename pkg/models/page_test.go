@@ -0,0 +1,55 @@
+package models_test
+
+import (
+	"testing"
+
+	"github.com/EternalQ/effective-mobile-test/pkg/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPagination_Parse(t *testing.T) {
+	tests := []struct {
+		name string
+		page models.Pagination
+
+		want    models.Pagination
+		wantErr error
+	}{
+		{
+			name: "defaults",
+			page: models.Pagination{},
+			want: models.Pagination{Limit: models.DefaultPageLimit, Sort: "id"},
+		},
+		{
+			name: "descending",
+			page: models.Pagination{Limit: 10, Offset: 20, Sort: "-price"},
+			want: models.Pagination{Limit: 10, Offset: 20, Sort: "-price"},
+		},
+		{
+			name:    "limit too big",
+			page:    models.Pagination{Limit: models.MaxPageLimit + 1},
+			wantErr: models.ErrInvalidPage,
+		},
+		{
+			name:    "negative offset",
+			page:    models.Pagination{Offset: -1},
+			wantErr: models.ErrInvalidPage,
+		},
+		{
+			name:    "unknown field",
+			page:    models.Pagination{Sort: "user_id"},
+			wantErr: models.ErrInvalidSort,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotErr := tt.page.Parse()
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, gotErr, tt.wantErr)
+				return
+			}
+			assert.Nil(t, gotErr)
+			assert.Equal(t, tt.want, tt.page)
+		})
+	}
+}
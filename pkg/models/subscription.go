@@ -9,10 +9,17 @@ type Subscription struct {
 	ServiceName        string     `json:"service_name" db:"service_name"`
 	Price              int        `json:"price" db:"price"`
 	UserId             string     `json:"user_id" db:"user_id"`
+	TenantId           string     `json:"tenant_id" db:"tenant_id"`
 	StartDate          time.Time  `json:"-" db:"start_date"`
 	EndDate            *time.Time `json:"-" db:"end_date"`
 	StartDateFormatted string     `json:"start_date" db:"-"`
 	EndDateFormatted   string     `json:"end_date" db:"-"` //omitempty?
+	// Version is bumped on every update. A non-zero Version of an update is
+	// the version the caller expects to replace.
+	Version int `json:"version" db:"version"`
+	// CreatedAt and UpdatedAt are maintained by the storage.
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
 }
 
 func (s *Subscription) Format() {
@@ -28,17 +35,36 @@ func (s *Subscription) Parse() error {
 	if s.StartDateFormatted != "" {
 		s.StartDate, err = time.Parse(SubscrTimeLayout, s.StartDateFormatted)
 		if err != nil {
-			return err
+			return &FieldError{Field: "start_date", Message: "must be in MM-YYYY format", Err: err}
 		}
 	}
 
 	if s.EndDateFormatted != "" && s.EndDateFormatted != "0" {
 		end, err := time.Parse(SubscrTimeLayout, s.EndDateFormatted)
 		if err != nil {
-			return err
+			return &FieldError{Field: "end_date", Message: "must be in MM-YYYY format", Err: err}
 		}
 		s.EndDate = &end
 	}
 
 	return nil
 }
+
+// ActiveMonths returns the number of calendar months the subscription is
+// active within the [from, to] window, both bounds inclusive. A zero from
+// means the window starts with the subscription, open-ended subscriptions
+// run up to the end of the window.
+func (s *Subscription) ActiveMonths(from, to time.Time) int {
+	if from.IsZero() || from.Before(s.StartDate) {
+		from = s.StartDate
+	}
+	if s.EndDate != nil && s.EndDate.Before(to) {
+		to = *s.EndDate
+	}
+
+	months := (to.Year()-from.Year())*12 + int(to.Month()) - int(from.Month()) + 1
+	if months < 0 {
+		return 0
+	}
+	return months
+}
@@ -139,6 +139,81 @@ func TestSubscription_Format(t *testing.T) {
 	}
 }
 
+func TestSubscription_ActiveMonths(t *testing.T) {
+	month := func(m time.Month, y int) time.Time {
+		return time.Date(y, m, 1, 0, 0, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name string
+
+		start time.Time
+		end   time.Time
+
+		from time.Time
+		to   time.Time
+
+		want int
+	}{
+		{
+			name:  "inside window",
+			start: month(3, 2026),
+			end:   month(5, 2026),
+			from:  month(1, 2026),
+			to:    month(12, 2026),
+			want:  3,
+		},
+		{
+			name:  "open-ended",
+			start: month(10, 2026),
+			from:  month(1, 2026),
+			to:    month(12, 2026),
+			want:  3,
+		},
+		{
+			name:  "started before window",
+			start: month(6, 2025),
+			end:   month(2, 2026),
+			from:  month(1, 2026),
+			to:    month(12, 2026),
+			want:  2,
+		},
+		{
+			name:  "no window start",
+			start: month(11, 2025),
+			to:    month(2, 2026),
+			want:  4,
+		},
+		{
+			name:  "single month",
+			start: month(3, 2026),
+			end:   month(3, 2026),
+			from:  month(3, 2026),
+			to:    month(3, 2026),
+			want:  1,
+		},
+		{
+			name:  "outside window",
+			start: month(1, 2025),
+			end:   month(6, 2025),
+			from:  month(1, 2026),
+			to:    month(12, 2026),
+			want:  0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &models.Subscription{
+				StartDate: tt.start,
+			}
+			if !tt.end.IsZero() {
+				s.EndDate = &tt.end
+			}
+			assert.Equal(t, tt.want, s.ActiveMonths(tt.from, tt.to))
+		})
+	}
+}
+
 func BenchmarkSubscription_Format(b *testing.B) {
 	start := time.Date(2026, 3, 1, 0, 0, 0, 0, time.FixedZone("GMT", 3))
 	end := time.Date(2026, 6, 1, 0, 0, 0, 0, time.FixedZone("GMT", 3))
@@ -0,0 +1,125 @@
+// Package ratelimit implements per-client token buckets.
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// sweepInterval is how often buckets left full are dropped.
+const sweepInterval = time.Minute
+
+// Config is a bucket refilled with Rate tokens per second up to Burst.
+type Config struct {
+	Rate  float64
+	Burst int
+}
+
+// Window returns the time an empty bucket takes to refill.
+func (c Config) Window() time.Duration {
+	return time.Duration(float64(c.Burst) / c.Rate * float64(time.Second))
+}
+
+// Result describes the bucket of a client after a request.
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Reset is the time until the bucket is full again.
+	Reset time.Duration
+	// RetryAfter is the time until the next request is allowed, zero when
+	// the request was allowed.
+	RetryAfter time.Duration
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// Limiter keeps a token bucket per client key. It is safe for concurrent
+// use.
+type Limiter struct {
+	cfg Config
+	now func() time.Time
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+func New(cfg Config) *Limiter {
+	return &Limiter{
+		cfg:     cfg,
+		now:     time.Now,
+		buckets: map[string]*bucket{},
+	}
+}
+
+// Config returns the limiter settings.
+func (l *Limiter) Config() Config {
+	return l.cfg
+}
+
+// Allow takes a token from the bucket of key if there is one.
+func (l *Limiter) Allow(key string) Result {
+	return l.take(key, true)
+}
+
+// Peek tells whether Allow would allow a request of key without taking a
+// token, for budgets charged only after the request.
+func (l *Limiter) Peek(key string) Result {
+	return l.take(key, false)
+}
+
+func (l *Limiter) take(key string, consume bool) Result {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	burst := float64(l.cfg.Burst)
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(burst, b.tokens+now.Sub(b.last).Seconds()*l.cfg.Rate)
+	b.last = now
+
+	res := Result{Limit: l.cfg.Burst}
+	if b.tokens >= 1 {
+		if consume {
+			b.tokens--
+		}
+		res.Allowed = true
+	} else {
+		res.RetryAfter = l.duration(1 - b.tokens)
+	}
+	res.Remaining = int(b.tokens)
+	res.Reset = l.duration(burst - b.tokens)
+	return res
+}
+
+// duration returns the time it takes to refill tokens.
+func (l *Limiter) duration(tokens float64) time.Duration {
+	return time.Duration(tokens / l.cfg.Rate * float64(time.Second))
+}
+
+// sweep drops buckets that have refilled since their last request, they
+// are recreated full. Called with mu held.
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < sweepInterval {
+		return
+	}
+	l.lastSweep = now
+
+	window := l.cfg.Window()
+	for key, b := range l.buckets {
+		if now.Sub(b.last) >= window {
+			delete(l.buckets, key)
+		}
+	}
+}
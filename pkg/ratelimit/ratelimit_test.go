@@ -0,0 +1,66 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLimiter(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	l := New(Config{Rate: 1, Burst: 3})
+	l.now = func() time.Time { return now }
+
+	for i := 2; i >= 0; i-- {
+		res := l.Allow("a")
+		assert.True(t, res.Allowed)
+		assert.Equal(t, 3, res.Limit)
+		assert.Equal(t, i, res.Remaining)
+	}
+
+	res := l.Allow("a")
+	assert.False(t, res.Allowed)
+	assert.Equal(t, 0, res.Remaining)
+	assert.Equal(t, time.Second, res.RetryAfter)
+	assert.Equal(t, 3*time.Second, res.Reset)
+
+	assert.True(t, l.Allow("b").Allowed, "buckets are per key")
+
+	now = now.Add(1500 * time.Millisecond)
+	res = l.Allow("a")
+	assert.True(t, res.Allowed)
+	assert.Equal(t, 0, res.Remaining)
+	assert.Equal(t, 2500*time.Millisecond, res.Reset)
+
+	now = now.Add(time.Hour)
+	res = l.Allow("a")
+	assert.Equal(t, 2, res.Remaining, "bucket refills up to burst")
+}
+
+func TestLimiter_Peek(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	l := New(Config{Rate: 1, Burst: 1})
+	l.now = func() time.Time { return now }
+
+	assert.True(t, l.Peek("a").Allowed)
+	assert.True(t, l.Peek("a").Allowed, "peeking takes no token")
+	assert.True(t, l.Allow("a").Allowed)
+
+	res := l.Peek("a")
+	assert.False(t, res.Allowed)
+	assert.Equal(t, time.Second, res.RetryAfter)
+}
+
+func TestLimiter_Sweep(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	l := New(Config{Rate: 1, Burst: 3})
+	l.now = func() time.Time { return now }
+
+	l.Allow("a")
+	now = now.Add(2 * sweepInterval)
+	l.Allow("b")
+
+	assert.Len(t, l.buckets, 1)
+	assert.Contains(t, l.buckets, "b")
+}
@@ -0,0 +1,169 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/EternalQ/effective-mobile-test/pkg/auth"
+	"github.com/EternalQ/effective-mobile-test/pkg/logctx"
+	"github.com/EternalQ/effective-mobile-test/pkg/models"
+	"github.com/EternalQ/effective-mobile-test/pkg/tenant"
+)
+
+const (
+	MaxKeyNameLength = 255
+	// MinBootstrapKeyLength keeps configured bootstrap keys from being
+	// guessable.
+	MinBootstrapKeyLength = 32
+)
+
+type KeyRepository interface {
+	CreateKey(context.Context, *models.APIKey) error
+	// ListKeys and RevokeKey only see keys of the tenant in the context.
+	ListKeys(context.Context) ([]*models.APIKey, error)
+	RevokeKey(context.Context, int, time.Time) error
+	// FindKey returns the key with the given hash in any tenant, nil if
+	// there is none.
+	FindKey(context.Context, string) (*models.APIKey, error)
+}
+
+var ErrInvalidKey = errors.New("invalid or revoked API key")
+
+type APIKeyService struct {
+	log  *slog.Logger
+	keys KeyRepository
+}
+
+func NewAPIKeyService(keyRepo KeyRepository, log *slog.Logger) *APIKeyService {
+	return &APIKeyService{
+		log.With(slog.String("where", "service/APIKeyService")),
+		keyRepo,
+	}
+}
+
+func (ks *APIKeyService) logger(ctx context.Context) *slog.Logger {
+	return logctx.From(ctx, ks.log, "service/APIKeyService")
+}
+
+// Create stores a new key in the tenant of ctx and returns it with the plain
+// key, which is not kept anywhere and can't be read again.
+func (ks *APIKeyService) Create(ctx context.Context, req *models.NewAPIKey) (*models.CreatedAPIKey, error) {
+	v := &validator{}
+	name := strings.TrimSpace(req.Name)
+	v.check(name != "", "name", "must not be empty")
+	v.check(utf8.RuneCountInString(name) <= MaxKeyNameLength, "name",
+		fmt.Sprintf("must be at most %d characters long", MaxKeyNameLength))
+	if err := v.err(); err != nil {
+		return nil, err
+	}
+
+	scopes, err := models.ParseScopes(req.Scopes)
+	if err != nil {
+		return nil, err
+	}
+
+	// Non-admin keys are restricted to the subscriptions of their user.
+	if req.UserId != "" || !scopes.Allows(models.ScopeAdmin) {
+		v.userId(req.UserId)
+		if err := v.err(); err != nil {
+			return nil, err
+		}
+	}
+
+	plain, err := auth.GenerateKey()
+	if err != nil {
+		return nil, err
+	}
+
+	key := &models.APIKey{
+		Name:      name,
+		Prefix:    auth.DisplayPrefix(plain),
+		Hash:      auth.HashKey(plain),
+		Scopes:    scopes,
+		UserId:    strings.ToLower(req.UserId),
+		TenantId:  tenant.ID(ctx),
+		CreatedAt: time.Now().UTC(),
+	}
+	if err := ks.keys.CreateKey(ctx, key); err != nil {
+		return nil, err
+	}
+
+	ks.logger(ctx).Info("API key created", slog.Int("id", key.Id), slog.String("name", key.Name))
+	return &models.CreatedAPIKey{APIKey: key, Key: plain}, nil
+}
+
+// List returns the keys of the tenant of ctx.
+func (ks *APIKeyService) List(ctx context.Context) ([]*models.APIKey, error) {
+	return ks.keys.ListKeys(ctx)
+}
+
+// Revoke disables a key of the tenant of ctx. Revoking a revoked key keeps the first revocation
+// time.
+func (ks *APIKeyService) Revoke(ctx context.Context, id int) error {
+	if err := ks.keys.RevokeKey(ctx, id, time.Now().UTC()); err != nil {
+		return err
+	}
+
+	ks.logger(ctx).Info("API key revoked", slog.Int("id", id))
+	return nil
+}
+
+// Authenticate resolves a plain key to the caller it belongs to. The caller
+// acts for the user and the tenant of the key, non-admin keys without a user
+// are rejected.
+func (ks *APIKeyService) Authenticate(ctx context.Context, plain string) (*auth.Principal, error) {
+	if plain == "" {
+		return nil, ErrInvalidKey
+	}
+
+	key, err := ks.keys.FindKey(ctx, auth.HashKey(plain))
+	if err != nil {
+		return nil, err
+	}
+	if key == nil || key.RevokedAt != nil {
+		return nil, ErrInvalidKey
+	}
+	if key.UserId == "" && !key.Scopes.Allows(models.ScopeAdmin) {
+		ks.logger(ctx).Warn("Non-admin API key without a user", slog.Int("id", key.Id))
+		return nil, ErrInvalidKey
+	}
+
+	return &auth.Principal{KeyId: key.Id, Subject: key.UserId, Tenant: key.TenantId, Name: key.Name, Scopes: key.Scopes}, nil
+}
+
+// Bootstrap stores plain as a platform admin key unless it is stored already,
+// so the first keys of every tenant can be created through the API. The key
+// belongs to no tenant, tenants can't list or revoke it.
+func (ks *APIKeyService) Bootstrap(ctx context.Context, plain string) error {
+	if len(plain) < MinBootstrapKeyLength {
+		return fmt.Errorf("bootstrap key must be at least %d characters long", MinBootstrapKeyLength)
+	}
+
+	hash := auth.HashKey(plain)
+	key, err := ks.keys.FindKey(ctx, hash)
+	if err != nil {
+		return err
+	}
+	if key != nil {
+		return nil
+	}
+
+	key = &models.APIKey{
+		Name:      "bootstrap",
+		Prefix:    auth.DisplayPrefix(plain),
+		Hash:      hash,
+		Scopes:    models.Scopes{models.ScopeAdmin},
+		CreatedAt: time.Now().UTC(),
+	}
+	if err := ks.keys.CreateKey(ctx, key); err != nil {
+		return err
+	}
+
+	ks.logger(ctx).Info("Bootstrap API key stored", slog.Int("id", key.Id))
+	return nil
+}
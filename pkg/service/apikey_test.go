@@ -0,0 +1,76 @@
+package service_test
+
+import (
+	"log/slog"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/EternalQ/effective-mobile-test/pkg/db"
+	"github.com/EternalQ/effective-mobile-test/pkg/models"
+	"github.com/EternalQ/effective-mobile-test/pkg/service"
+	"github.com/EternalQ/effective-mobile-test/pkg/tenant"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAPIKeyService(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	repo := db.NewMemoryAPIKeyRepo(logger)
+	ks := service.NewAPIKeyService(repo, logger)
+
+	t.Run("create and authenticate", func(t *testing.T) {
+		created, err := ks.Create(t.Context(), &models.NewAPIKey{Name: " export ", Scopes: []string{"write"}, UserId: "60601fee-2bf1-4721-ae6f-7636e79a0cba"})
+		require.Nil(t, err)
+		assert.Equal(t, "export", created.Name)
+		assert.True(t, strings.HasPrefix(created.Key, created.Prefix))
+		assert.NotContains(t, created.Hash, created.Key)
+
+		p, err := ks.Authenticate(t.Context(), created.Key)
+		require.Nil(t, err)
+		assert.Equal(t, created.Id, p.KeyId)
+		assert.Equal(t, "60601fee-2bf1-4721-ae6f-7636e79a0cba", p.Subject)
+		assert.Equal(t, tenant.DefaultID, p.Tenant)
+		assert.True(t, p.Scopes.Allows(models.ScopeRead))
+
+		require.Nil(t, ks.Revoke(t.Context(), created.Id))
+		_, err = ks.Authenticate(t.Context(), created.Key)
+		assert.ErrorIs(t, err, service.ErrInvalidKey)
+	})
+
+	t.Run("invalid input", func(t *testing.T) {
+		_, err := ks.Create(t.Context(), &models.NewAPIKey{Name: "", Scopes: []string{"read"}, UserId: "60601fee-2bf1-4721-ae6f-7636e79a0cba"})
+		var validErr *service.ValidationError
+		assert.ErrorAs(t, err, &validErr)
+
+		_, err = ks.Create(t.Context(), &models.NewAPIKey{Name: strings.Repeat("x", service.MaxKeyNameLength+1), Scopes: []string{"admin"}})
+		assert.ErrorAs(t, err, &validErr)
+
+		_, err = ks.Create(t.Context(), &models.NewAPIKey{Name: strings.Repeat("ключ", service.MaxKeyNameLength/4), Scopes: []string{"admin"}})
+		assert.Nil(t, err, "names are measured in characters")
+
+		_, err = ks.Create(t.Context(), &models.NewAPIKey{Name: "export"})
+		assert.ErrorIs(t, err, models.ErrInvalidScope)
+
+		_, err = ks.Authenticate(t.Context(), "")
+		assert.ErrorIs(t, err, service.ErrInvalidKey)
+	})
+
+	t.Run("bootstrap", func(t *testing.T) {
+		assert.NotNil(t, ks.Bootstrap(t.Context(), "short"))
+
+		plain := strings.Repeat("k", service.MinBootstrapKeyLength)
+		require.Nil(t, ks.Bootstrap(t.Context(), plain))
+		require.Nil(t, ks.Bootstrap(t.Context(), plain))
+
+		p, err := ks.Authenticate(t.Context(), plain)
+		require.Nil(t, err)
+		assert.True(t, p.Platform(), "the bootstrap key belongs to no tenant")
+
+		keys, err := ks.List(t.Context())
+		require.Nil(t, err)
+		for _, k := range keys {
+			assert.NotEqual(t, "bootstrap", k.Name)
+		}
+	})
+}
@@ -0,0 +1,124 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/EternalQ/effective-mobile-test/pkg/logctx"
+	"github.com/EternalQ/effective-mobile-test/pkg/models"
+	"github.com/EternalQ/effective-mobile-test/pkg/tenant"
+)
+
+// PendingKeyTimeout is how long a pending key blocks retries. Requests that
+// did not finish by then are assumed lost, say with a crashed instance.
+const PendingKeyTimeout = time.Minute
+
+type IdempotencyRepository interface {
+	// ReserveKey stores a pending key unless the client has a live one with
+	// the same value, which is returned instead. Keys expired or pending
+	// since before staleBefore are replaced.
+	ReserveKey(ctx context.Context, key *models.IdempotencyKey, staleBefore time.Time) (*models.IdempotencyKey, error)
+	// CompleteKey stores the response of a pending key.
+	CompleteKey(context.Context, *models.IdempotencyKey) error
+	// ReleaseKey deletes a pending key.
+	ReleaseKey(context.Context, *models.IdempotencyKey) error
+	// PurgeKeys deletes keys expired at the given time and returns their
+	// number.
+	PurgeKeys(context.Context, time.Time) (int, error)
+}
+
+var (
+	ErrKeyReused  = errors.New("idempotency key was used for another request")
+	ErrKeyPending = errors.New("request with the idempotency key is in progress")
+)
+
+type IdempotencyService struct {
+	log  *slog.Logger
+	keys IdempotencyRepository
+	ttl  time.Duration
+}
+
+// NewIdempotencyService creates a service keeping responses for ttl.
+func NewIdempotencyService(keyRepo IdempotencyRepository, ttl time.Duration, log *slog.Logger) *IdempotencyService {
+	return &IdempotencyService{
+		log.With(slog.String("where", "service/IdempotencyService")),
+		keyRepo,
+		ttl,
+	}
+}
+
+func (is *IdempotencyService) logger(ctx context.Context) *slog.Logger {
+	return logctx.From(ctx, is.log, "service/IdempotencyService")
+}
+
+// Begin reserves key of client in the tenant of ctx for a request hashing
+// to hash. It returns a pending key the caller must complete or release, or
+// the completed key of an earlier identical request to replay.
+func (is *IdempotencyService) Begin(ctx context.Context, client, key, hash string) (*models.IdempotencyKey, error) {
+	now := time.Now().UTC()
+	k := &models.IdempotencyKey{
+		TenantId:    tenant.ID(ctx),
+		Client:      client,
+		Key:         key,
+		RequestHash: hash,
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(is.ttl),
+	}
+
+	stored, err := is.keys.ReserveKey(ctx, k, now.Add(-PendingKeyTimeout))
+	if err != nil {
+		return nil, err
+	}
+	if stored == nil {
+		return k, nil
+	}
+
+	switch {
+	case stored.RequestHash != hash:
+		return nil, ErrKeyReused
+	case stored.Pending():
+		return nil, ErrKeyPending
+	default:
+		is.logger(ctx).Debug("Replaying response", slog.String("client", client), slog.Int("status", stored.Status))
+		return stored, nil
+	}
+}
+
+// Complete stores the response of the request of a pending key.
+func (is *IdempotencyService) Complete(ctx context.Context, k *models.IdempotencyKey, status int, headers models.Headers, response []byte) error {
+	k.Status = status
+	k.Headers = headers
+	k.Response = response
+	return is.keys.CompleteKey(ctx, k)
+}
+
+// Release forgets a pending key, so the request can be retried with it.
+func (is *IdempotencyService) Release(ctx context.Context, k *models.IdempotencyKey) error {
+	return is.keys.ReleaseKey(ctx, k)
+}
+
+// RunPurge deletes expired keys every interval until ctx is done.
+func (is *IdempotencyService) RunPurge(ctx context.Context, interval time.Duration) {
+	log := is.logger(ctx)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n, err := is.keys.PurgeKeys(ctx, time.Now().UTC())
+			if err != nil {
+				log.Error("Error while purging idempotency keys",
+					slog.String("err", err.Error()),
+					slog.String("method", "RunPurge"),
+				)
+				continue
+			}
+			log.Debug("Idempotency keys purged", slog.Int("count", n))
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package service_test
+
+import (
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/EternalQ/effective-mobile-test/pkg/db"
+	"github.com/EternalQ/effective-mobile-test/pkg/models"
+	"github.com/EternalQ/effective-mobile-test/pkg/service"
+	"github.com/EternalQ/effective-mobile-test/pkg/tenant"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIdempotencyService(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	is := service.NewIdempotencyService(db.NewMemoryIdempotencyRepo(logger), time.Hour, logger)
+	ctx := t.Context()
+
+	k, err := is.Begin(ctx, "key:1", "abc", "h1")
+	require.Nil(t, err)
+	require.True(t, k.Pending())
+	assert.Equal(t, tenant.DefaultID, k.TenantId)
+
+	_, err = is.Begin(ctx, "key:1", "abc", "h1")
+	assert.ErrorIs(t, err, service.ErrKeyPending)
+
+	require.Nil(t, is.Complete(ctx, k, 201, models.Headers{"Location": "/api/subscriptions/1"}, []byte(`{"id":1}`)))
+
+	replay, err := is.Begin(ctx, "key:1", "abc", "h1")
+	require.Nil(t, err)
+	assert.Equal(t, 201, replay.Status)
+	assert.Equal(t, models.Headers{"Location": "/api/subscriptions/1"}, replay.Headers)
+	assert.Equal(t, []byte(`{"id":1}`), replay.Response)
+
+	_, err = is.Begin(ctx, "key:1", "abc", "h2")
+	assert.ErrorIs(t, err, service.ErrKeyReused)
+
+	other, err := is.Begin(tenant.WithTenant(ctx, &tenant.Tenant{Id: "acme"}), "key:1", "abc", "h2")
+	require.Nil(t, err)
+	assert.True(t, other.Pending(), "keys are per tenant")
+
+	failed, err := is.Begin(ctx, "key:1", "def", "h1")
+	require.Nil(t, err)
+	require.Nil(t, is.Release(ctx, failed))
+	retry, err := is.Begin(ctx, "key:1", "def", "h1")
+	require.Nil(t, err)
+	assert.True(t, retry.Pending(), "released keys can be retried")
+}
@@ -0,0 +1,172 @@
+package service_test
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"testing"
+
+	"github.com/EternalQ/effective-mobile-test/pkg/auth"
+	"github.com/EternalQ/effective-mobile-test/pkg/db"
+	"github.com/EternalQ/effective-mobile-test/pkg/models"
+	"github.com/EternalQ/effective-mobile-test/pkg/service"
+	"github.com/EternalQ/effective-mobile-test/pkg/tenant"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	userA = "60601fee-2bf1-4721-ae6f-7636e79a0cba"
+	userB = "2b8e5a3c-9d4f-4c1e-8a7b-6f5d4e3c2b1a"
+)
+
+func as(subject string, scopes ...models.Scope) context.Context {
+	return auth.WithPrincipal(context.Background(), &auth.Principal{Subject: subject, Scopes: scopes})
+}
+
+func TestSubscriptionService_Isolation(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	ss := service.NewSubscriptionService(db.NewMemoryRepo(logger), logger)
+
+	a, b := as(userA, models.ScopeWrite), as(userB, models.ScopeWrite)
+	admin := as(userA, models.ScopeAdmin)
+
+	subA := &models.Subscription{ServiceName: "Yandex Plus", Price: 400, StartDate: month(1, 2026)}
+	require.Nil(t, ss.Create(a, subA))
+	assert.Equal(t, userA, subA.UserId, "user_id defaults to the caller")
+
+	subB := &models.Subscription{ServiceName: "Kinopoisk", Price: 300, UserId: userB, StartDate: month(1, 2026)}
+	assert.ErrorIs(t, ss.Create(a, subB), service.ErrForbidden)
+	require.Nil(t, ss.Create(b, subB))
+
+	t.Run("read", func(t *testing.T) {
+		_, err := ss.Read(a, subB.Id)
+		assert.ErrorIs(t, err, service.ErrNotOwner)
+
+		got, err := ss.Read(a, subA.Id)
+		require.Nil(t, err)
+		assert.Equal(t, subA.Id, got.Id)
+
+		_, err = ss.Read(admin, subB.Id)
+		assert.Nil(t, err)
+	})
+
+	t.Run("list", func(t *testing.T) {
+		page, err := ss.List(a, nil, &models.Pagination{Limit: 10, Sort: "id"})
+		require.Nil(t, err)
+		require.Len(t, page.Items, 1)
+		assert.Equal(t, subA.Id, page.Items[0].Id)
+
+		_, err = ss.List(a, &models.SubscriptionFilter{Subscription: models.Subscription{UserId: userB}}, &models.Pagination{Limit: 10, Sort: "id"})
+		assert.ErrorIs(t, err, service.ErrForbidden)
+
+		page, err = ss.List(admin, nil, &models.Pagination{Limit: 10, Sort: "id"})
+		require.Nil(t, err)
+		assert.Equal(t, 2, page.Total)
+
+		page, err = ss.List(context.Background(), nil, &models.Pagination{Limit: 10, Sort: "id"})
+		require.Nil(t, err)
+		assert.Equal(t, 2, page.Total, "callers without a subject are not restricted")
+	})
+
+	t.Run("calculations", func(t *testing.T) {
+		filter := &models.SubscriptionFilter{Subscription: models.Subscription{StartDate: month(1, 2026), EndDate: ptr(month(1, 2026))}}
+
+		price, err := ss.CalculatePrice(a, filter)
+		require.Nil(t, err)
+		assert.Equal(t, 400, price)
+		assert.Empty(t, filter.UserId, "caller filter is not modified")
+
+		breakdown, err := ss.Breakdown(b, filter)
+		require.Nil(t, err)
+		require.Len(t, breakdown.ByUser, 1)
+		assert.Equal(t, userB, breakdown.ByUser[0].Key)
+	})
+
+	t.Run("update", func(t *testing.T) {
+		err := ss.Update(a, &models.Subscription{Id: subB.Id, Price: 1})
+		assert.ErrorIs(t, err, db.ErrNotFound)
+		err = ss.Update(a, &models.Subscription{Id: subB.Id, EndDate: ptr(month(6, 2026))})
+		assert.ErrorIs(t, err, service.ErrNotOwner, "reading the current dates hides them too")
+
+		err = ss.Update(a, &models.Subscription{Id: subA.Id, UserId: userB})
+		assert.ErrorIs(t, err, service.ErrForbidden)
+
+		assert.Nil(t, ss.Update(a, &models.Subscription{Id: subA.Id, Price: 500}))
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		assert.ErrorIs(t, ss.Delete(a, subB.Id, 0), db.ErrNotFound)
+		assert.ErrorIs(t, ss.Delete(a, 100, 0), db.ErrNotFound)
+		assert.Nil(t, ss.Delete(b, subB.Id, 0))
+	})
+}
+
+func TestSubscriptionService_IsolationAPIKey(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	keyRepo := db.NewMemoryAPIKeyRepo(logger)
+	ks := service.NewAPIKeyService(keyRepo, logger)
+	ss := service.NewSubscriptionService(db.NewMemoryRepo(logger), logger)
+
+	key, err := ks.Create(t.Context(), &models.NewAPIKey{Name: "export", Scopes: []string{"write"}, UserId: userA})
+	require.Nil(t, err)
+	p, err := ks.Authenticate(t.Context(), key.Key)
+	require.Nil(t, err)
+	assert.Equal(t, userA, p.RestrictedTo(), "non-admin keys act for their user")
+	a := auth.WithPrincipal(context.Background(), p)
+
+	subA := &models.Subscription{ServiceName: "Yandex Plus", Price: 400, StartDate: month(1, 2026)}
+	require.Nil(t, ss.Create(a, subA))
+	assert.Equal(t, userA, subA.UserId)
+	subB := &models.Subscription{ServiceName: "Kinopoisk", Price: 300, UserId: userB, StartDate: month(1, 2026)}
+	assert.ErrorIs(t, ss.Create(a, subB), service.ErrForbidden)
+	require.Nil(t, ss.Create(context.Background(), subB))
+
+	page, err := ss.List(a, nil, nil)
+	require.Nil(t, err)
+	assert.Equal(t, 1, page.Total)
+	_, err = ss.Read(a, subB.Id)
+	assert.ErrorIs(t, err, service.ErrNotOwner)
+	assert.ErrorIs(t, ss.Delete(a, subB.Id, 0), db.ErrNotFound)
+
+	_, err = ks.Create(t.Context(), &models.NewAPIKey{Name: "export", Scopes: []string{"read"}})
+	var validErr *service.ValidationError
+	assert.ErrorAs(t, err, &validErr, "non-admin keys need a user")
+
+	unbound := &models.APIKey{Name: "legacy", Hash: auth.HashKey("emk_legacy"), Scopes: models.Scopes{models.ScopeWrite}}
+	require.Nil(t, keyRepo.CreateKey(t.Context(), unbound))
+	_, err = ks.Authenticate(t.Context(), "emk_legacy")
+	assert.ErrorIs(t, err, service.ErrInvalidKey)
+}
+
+func TestSubscriptionService_Tenants(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	ss := service.NewSubscriptionService(db.NewMemoryRepo(logger), logger)
+
+	acme := tenant.WithTenant(context.Background(), &tenant.Tenant{Id: "acme", Currency: "USD"})
+	retail := tenant.WithTenant(context.Background(), &tenant.Tenant{Id: "retail", Currency: "RUB"})
+
+	sub := &models.Subscription{ServiceName: "Yandex Plus", Price: 400, UserId: userA, StartDate: month(1, 2026)}
+	require.Nil(t, ss.Create(acme, sub))
+	assert.Equal(t, "acme", sub.TenantId)
+
+	other := &models.Subscription{ServiceName: "Kinopoisk", Price: 300, UserId: userA, StartDate: month(1, 2026), TenantId: "acme"}
+	assert.ErrorIs(t, ss.Create(retail, other), service.ErrOtherTenant)
+	assert.ErrorIs(t, ss.Update(retail, &models.Subscription{Id: sub.Id, Price: 100, TenantId: "acme"}), service.ErrOtherTenant)
+
+	_, err := ss.Read(retail, sub.Id)
+	assert.ErrorIs(t, err, db.ErrNotFound)
+
+	filter := &models.SubscriptionFilter{
+		Subscription: models.Subscription{StartDate: month(1, 2026), EndDate: ptr(month(1, 2026))},
+	}
+	breakdown, err := ss.Breakdown(acme, filter)
+	require.Nil(t, err)
+	assert.Equal(t, "USD", breakdown.Currency)
+	assert.Len(t, breakdown.ByService, 1)
+
+	breakdown, err = ss.Breakdown(retail, filter)
+	require.Nil(t, err)
+	assert.Equal(t, "RUB", breakdown.Currency)
+	assert.Empty(t, breakdown.ByService)
+}
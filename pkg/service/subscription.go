@@ -1,19 +1,53 @@
 package service
 
 import (
+	"context"
+	"errors"
 	"log/slog"
+	"strings"
+	"time"
 
+	"github.com/EternalQ/effective-mobile-test/pkg/auth"
+	"github.com/EternalQ/effective-mobile-test/pkg/logctx"
 	"github.com/EternalQ/effective-mobile-test/pkg/models"
+	"github.com/EternalQ/effective-mobile-test/pkg/tenant"
+	"github.com/EternalQ/effective-mobile-test/pkg/tracing"
+	"go.opentelemetry.io/otel"
 )
 
 type Repository interface {
-	Create(*models.Subscription) error
-	Read(int) (*models.Subscription, error)
-	Update(*models.Subscription) error
-	Delete(int) error
-	List(*models.Subscription) ([]*models.Subscription, error)
+	Create(context.Context, *models.Subscription) error
+	Read(context.Context, int) (*models.Subscription, error)
+	// Update and Delete change a subscription, only in the given version
+	// unless it is zero and only of the owner user unless it is empty.
+	// Subscriptions of other users are not found.
+	Update(ctx context.Context, s *models.Subscription, owner string) error
+	Delete(ctx context.Context, id, version int, owner string) error
+	// History returns the events of a subscription oldest first, including
+	// deleted ones. Subscriptions created before events were recorded have
+	// none.
+	History(ctx context.Context, id int) ([]*models.SubscriptionEvent, error)
+	List(context.Context, *models.SubscriptionFilter, *models.Pagination) ([]*models.Subscription, error)
+	Count(context.Context, *models.SubscriptionFilter) (int, error)
+	Breakdown(context.Context, *models.SubscriptionFilter) (*models.CostBreakdown, error)
 }
 
+var tracer = otel.Tracer("github.com/EternalQ/effective-mobile-test/pkg/service")
+
+var (
+	ErrWindowRequired = errors.New("start_date and end_date are required")
+	// ErrForbidden is returned when a caller restricted to a user asks for
+	// subscriptions of another one.
+	ErrForbidden = errors.New("subscriptions of another user are not accessible")
+	// ErrNotOwner hides subscriptions of other users from restricted
+	// callers, they are reported as not found. Repositories return
+	// db.ErrNotFound for changes of them.
+	ErrNotOwner = errors.New("subscription belongs to another user")
+	// ErrOtherTenant is returned when a subscription names a tenant other
+	// than the one of the request.
+	ErrOtherTenant = errors.New("subscriptions of another tenant are not accessible")
+)
+
 type SubscriptionService struct {
 	log           *slog.Logger
 	subscriptions Repository
@@ -26,40 +60,284 @@ func NewSubscriptionService(subRepo Repository, log *slog.Logger) *SubscriptionS
 	}
 }
 
-func (ss *SubscriptionService) Create(s *models.Subscription) error {
-	return ss.subscriptions.Create(s)
+func (ss *SubscriptionService) logger(ctx context.Context) *slog.Logger {
+	return logctx.From(ctx, ss.log, "service/SubscriptionService")
+}
+
+// restrictFilter limits filter to the user the caller is restricted to, see
+// auth.Principal.RestrictedTo. The caller's filter is not modified.
+func restrictFilter(ctx context.Context, filter *models.SubscriptionFilter) (*models.SubscriptionFilter, error) {
+	user := auth.FromContext(ctx).RestrictedTo()
+	if user == "" {
+		return filter, nil
+	}
+
+	restricted := models.SubscriptionFilter{}
+	if filter != nil {
+		restricted = *filter
+	}
+	if restricted.UserId != "" && !strings.EqualFold(restricted.UserId, user) {
+		return nil, ErrForbidden
+	}
+	restricted.UserId = user
+	return &restricted, nil
+}
+
+// readOwned reads a subscription, hiding it from restricted callers it does
+// not belong to.
+func (ss *SubscriptionService) readOwned(ctx context.Context, id int) (*models.Subscription, error) {
+	sub, err := ss.subscriptions.Read(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if user := auth.FromContext(ctx).RestrictedTo(); user != "" && !strings.EqualFold(sub.UserId, user) {
+		return nil, ErrNotOwner
+	}
+	return sub, nil
 }
 
-func (ss *SubscriptionService) Read(id int) (*models.Subscription, error) {
-	return ss.subscriptions.Read(id)
+// checkTenant rejects subscriptions naming a tenant other than the one of
+// ctx. Repositories store subscriptions in the tenant of ctx regardless.
+func checkTenant(ctx context.Context, s *models.Subscription) error {
+	if s.TenantId != "" && s.TenantId != tenant.ID(ctx) {
+		return ErrOtherTenant
+	}
+	return nil
 }
 
-func (ss *SubscriptionService) Update(s *models.Subscription) error {
-	return ss.subscriptions.Update(s)
+// Create stores a subscription in the tenant of ctx. Restricted callers may
+// only create subscriptions for themselves, user_id defaults to their own.
+func (ss *SubscriptionService) Create(ctx context.Context, s *models.Subscription) (err error) {
+	ctx, span := tracer.Start(ctx, "SubscriptionService.Create")
+	defer func() { tracing.End(span, err) }()
+
+	if err := checkTenant(ctx, s); err != nil {
+		return err
+	}
+
+	if user := auth.FromContext(ctx).RestrictedTo(); user != "" {
+		if s.UserId == "" {
+			s.UserId = user
+		} else if !strings.EqualFold(s.UserId, user) {
+			return ErrForbidden
+		}
+	}
+
+	if err := validateCreate(s); err != nil {
+		return err
+	}
+	return ss.subscriptions.Create(ctx, s)
 }
 
-func (ss *SubscriptionService) Delete(id int) error {
-	return ss.subscriptions.Delete(id)
+func (ss *SubscriptionService) Read(ctx context.Context, id int) (_ *models.Subscription, err error) {
+	ctx, span := tracer.Start(ctx, "SubscriptionService.Read")
+	defer func() { tracing.End(span, err) }()
+
+	return ss.readOwned(ctx, id)
 }
 
-func (ss *SubscriptionService) ListAll() ([]*models.Subscription, error) {
-	return ss.subscriptions.List(nil)
+// Update applies a partial update. When only one of the dates changes, the
+// current subscription is read to check the resulting date range. Restricted
+// callers only update their own subscriptions and can't move them to another
+// user. A non-zero s.Version must be the current one, s.Version is set to the
+// new one.
+func (ss *SubscriptionService) Update(ctx context.Context, s *models.Subscription) (err error) {
+	ctx, span := tracer.Start(ctx, "SubscriptionService.Update")
+	defer func() { tracing.End(span, err) }()
+
+	if err := checkTenant(ctx, s); err != nil {
+		return err
+	}
+	user := auth.FromContext(ctx).RestrictedTo()
+	if user != "" && s.UserId != "" && !strings.EqualFold(s.UserId, user) {
+		return ErrForbidden
+	}
+
+	var current *models.Subscription
+	if needsCurrentDates(s) {
+		current, err = ss.readOwned(ctx, s.Id)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := validateUpdate(s, current); err != nil {
+		return err
+	}
+	return ss.subscriptions.Update(ctx, s, user)
+}
+
+// Delete deletes a subscription. A non-zero version must be the current one.
+// Restricted callers only delete their own subscriptions.
+func (ss *SubscriptionService) Delete(ctx context.Context, id, version int) (err error) {
+	ctx, span := tracer.Start(ctx, "SubscriptionService.Delete")
+	defer func() { tracing.End(span, err) }()
+
+	return ss.subscriptions.Delete(ctx, id, version, auth.FromContext(ctx).RestrictedTo())
+}
+
+// History returns the changes of a subscription. Restricted callers only
+// see histories of their current subscriptions.
+func (ss *SubscriptionService) History(ctx context.Context, id int) (_ []*models.SubscriptionEvent, err error) {
+	ctx, span := tracer.Start(ctx, "SubscriptionService.History")
+	defer func() { tracing.End(span, err) }()
+
+	if auth.FromContext(ctx).RestrictedTo() != "" {
+		if _, err := ss.readOwned(ctx, id); err != nil {
+			return nil, err
+		}
+	}
+	return ss.subscriptions.History(ctx, id)
+}
+
+// List returns a single page of subscriptions matching the filter along
+// with the total number of matches, the first default page when page is nil.
+// Restricted callers only see their own subscriptions, which holds for every
+// calculation too.
+func (ss *SubscriptionService) List(ctx context.Context, filter *models.SubscriptionFilter, page *models.Pagination) (_ *models.SubscriptionPage, err error) {
+	ctx, span := tracer.Start(ctx, "SubscriptionService.List")
+	defer func() { tracing.End(span, err) }()
+
+	log := ss.logger(ctx)
+	filter, err = restrictFilter(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	if page == nil {
+		page = &models.Pagination{}
+		if err := page.Parse(); err != nil {
+			return nil, err
+		}
+	}
+
+	total, err := ss.subscriptions.Count(ctx, filter)
+	if err != nil {
+		log.Error("Error while counting subscriptions",
+			slog.String("source", "db/SubcriptionRepo.Count"),
+			slog.String("method", "List"),
+		)
+		return nil, err
+	}
+
+	subs, err := ss.subscriptions.List(ctx, filter, page)
+	if err != nil {
+		log.Error("Error while listing subscriptions",
+			slog.String("source", "db/SubcriptionRepo.List"),
+			slog.String("method", "List"),
+		)
+		return nil, err
+	}
+
+	res := &models.SubscriptionPage{
+		Items:  subs,
+		Total:  total,
+		Limit:  page.Limit,
+		Offset: page.Offset,
+	}
+	if next := page.Offset + len(subs); len(subs) > 0 && next < total {
+		res.NextOffset = &next
+	}
+
+	return res, nil
 }
 
-func (ss *SubscriptionService) CalculatePrice(filter *models.Subscription) (int, error) {
-	subs, err := ss.subscriptions.List(filter)
+// CalculatePrice sums the cost of every subscription matching the filter,
+// charging the monthly price for each month the subscription overlaps the
+// filter window. Without a window end the current month in the tenant time
+// zone is used.
+func (ss *SubscriptionService) CalculatePrice(ctx context.Context, filter *models.SubscriptionFilter) (_ int, err error) {
+	ctx, span := tracer.Start(ctx, "SubscriptionService.CalculatePrice")
+	defer func() { tracing.End(span, err) }()
+
+	log := ss.logger(ctx)
+	filter, err = restrictFilter(ctx, filter)
 	if err != nil {
-		ss.log.Error("Error while calculating price",
+		return -1, err
+	}
+
+	subs, err := ss.subscriptions.List(ctx, filter, nil)
+	if err != nil {
+		log.Error("Error while calculating price",
 			slog.String("source", "db/SubcriptionRepo.List"),
 			slog.String("method", "CalculatePrice"),
 		)
 		return -1, err
 	}
 
+	var from, to time.Time
+	if filter != nil {
+		from = filter.StartDate
+		if filter.EndDate != nil {
+			to = *filter.EndDate
+		}
+	}
+	if to.IsZero() {
+		to = tenant.FromContext(ctx).CurrentMonth()
+	}
+
 	total := 0
 	for _, s := range subs {
-		total += s.Price
+		total += s.Price * s.ActiveMonths(from, to)
 	}
 
 	return total, nil
 }
+
+// Breakdown splits the cost of subscriptions matching the filter by service,
+// by user and by month, charging prices the same way CalculatePrice does.
+// Totals are in the tenant currency.
+func (ss *SubscriptionService) Breakdown(ctx context.Context, filter *models.SubscriptionFilter) (_ *models.CostBreakdown, err error) {
+	ctx, span := tracer.Start(ctx, "SubscriptionService.Breakdown")
+	defer func() { tracing.End(span, err) }()
+
+	log := ss.logger(ctx)
+	if filter == nil || filter.StartDate.IsZero() || filter.EndDate == nil || filter.EndDate.IsZero() {
+		return nil, ErrWindowRequired
+	}
+	filter, err = restrictFilter(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	breakdown, err := ss.subscriptions.Breakdown(ctx, filter)
+	if err != nil {
+		log.Error("Error while calculating breakdown",
+			slog.String("source", "db/SubcriptionRepo.Breakdown"),
+			slog.String("method", "Breakdown"),
+		)
+		return nil, err
+	}
+
+	if t := tenant.FromContext(ctx); t != nil {
+		breakdown.Currency = t.Currency
+	}
+	return breakdown, nil
+}
+
+// Recurring returns the number of subscriptions active in the month of at
+// and the sum of their monthly prices.
+func (ss *SubscriptionService) Recurring(ctx context.Context, at time.Time) (_ *models.CostGroup, err error) {
+	ctx, span := tracer.Start(ctx, "SubscriptionService.Recurring")
+	defer func() { tracing.End(span, err) }()
+
+	log := ss.logger(ctx)
+	month := time.Date(at.Year(), at.Month(), 1, 0, 0, 0, 0, time.UTC)
+	filter := &models.SubscriptionFilter{
+		Subscription: models.Subscription{StartDate: month, EndDate: &month},
+	}
+
+	breakdown, err := ss.subscriptions.Breakdown(ctx, filter)
+	if err != nil {
+		log.Error("Error while calculating recurring spend",
+			slog.String("source", "db/SubcriptionRepo.Breakdown"),
+			slog.String("method", "Recurring"),
+		)
+		return nil, err
+	}
+
+	if len(breakdown.ByMonth) == 0 {
+		return &models.CostGroup{Key: month.Format(models.SubscrTimeLayout)}, nil
+	}
+	return breakdown.ByMonth[0], nil
+}
@@ -1,10 +1,12 @@
 package service_test
 
 import (
+	"context"
 	"errors"
 	"log/slog"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/EternalQ/effective-mobile-test/pkg/models"
 	"github.com/EternalQ/effective-mobile-test/pkg/service"
@@ -14,49 +16,198 @@ import (
 var ErrNotImplemented = errors.New("not implemented")
 
 type MockRepo struct {
-	listFn func(*models.Subscription) ([]*models.Subscription, error)
+	listFn  func(*models.SubscriptionFilter) ([]*models.Subscription, error)
+	countFn func(*models.SubscriptionFilter) (int, error)
+	readFn  func(int) (*models.Subscription, error)
 }
 
-func (m *MockRepo) Create(*models.Subscription) error      { return ErrNotImplemented }
-func (m *MockRepo) Read(int) (*models.Subscription, error) { return nil, ErrNotImplemented }
-func (m *MockRepo) Update(*models.Subscription) error      { return ErrNotImplemented }
-func (m *MockRepo) Delete(int) error                       { return ErrNotImplemented }
+func (m *MockRepo) Create(context.Context, *models.Subscription) error         { return nil }
+func (m *MockRepo) Update(context.Context, *models.Subscription, string) error { return nil }
+func (m *MockRepo) Delete(context.Context, int, int, string) error             { return ErrNotImplemented }
 
-func (m *MockRepo) List(f *models.Subscription) ([]*models.Subscription, error) {
+func (m *MockRepo) History(context.Context, int) ([]*models.SubscriptionEvent, error) {
+	return nil, ErrNotImplemented
+}
+
+func (m *MockRepo) Read(_ context.Context, id int) (*models.Subscription, error) {
+	if m.readFn == nil {
+		return nil, ErrNotImplemented
+	}
+	return m.readFn(id)
+}
+
+func (m *MockRepo) Breakdown(context.Context, *models.SubscriptionFilter) (*models.CostBreakdown, error) {
+	return &models.CostBreakdown{}, nil
+}
+
+func (m *MockRepo) List(_ context.Context, f *models.SubscriptionFilter, _ *models.Pagination) ([]*models.Subscription, error) {
 	return m.listFn(f)
 }
 
+func (m *MockRepo) Count(_ context.Context, f *models.SubscriptionFilter) (int, error) {
+	if m.countFn == nil {
+		return 0, ErrNotImplemented
+	}
+	return m.countFn(f)
+}
+
+func month(m time.Month, y int) time.Time {
+	return time.Date(y, m, 1, 0, 0, 0, 0, time.UTC)
+}
+
+func ptr[T any](v T) *T { return &v }
+
 func TestSubscriptionService_CalculatePrice(t *testing.T) {
 	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
 	t.Run("Price calculation", func(t *testing.T) {
 		m := &MockRepo{
-			func(s *models.Subscription) ([]*models.Subscription, error) {
+			listFn: func(s *models.SubscriptionFilter) ([]*models.Subscription, error) {
 				return []*models.Subscription{
-					{Price: 100},
-					{Price: 200},
-					{Price: 300},
+					{Price: 100, StartDate: month(1, 2026), EndDate: ptr(month(1, 2026))},
+					{Price: 200, StartDate: month(1, 2026), EndDate: ptr(month(1, 2026))},
+					{Price: 300, StartDate: month(1, 2026), EndDate: ptr(month(1, 2026))},
 				}, nil
 			},
 		}
 
 		ss := service.NewSubscriptionService(m, logger)
-		price, err := ss.CalculatePrice(nil)
+		price, err := ss.CalculatePrice(t.Context(), nil)
 
 		assert.Nil(t, err)
 		assert.Equal(t, 600, price)
 	})
 
+	t.Run("Prorated by months", func(t *testing.T) {
+		m := &MockRepo{
+			listFn: func(s *models.SubscriptionFilter) ([]*models.Subscription, error) {
+				return []*models.Subscription{
+					// 12 months, fully inside the window
+					{Price: 100, StartDate: month(1, 2026), EndDate: ptr(month(12, 2026))},
+					// open-ended, counted up to the end of the window
+					{Price: 200, StartDate: month(10, 2026)},
+					// started before the window, 2 months inside
+					{Price: 300, StartDate: month(6, 2025), EndDate: ptr(month(2, 2026))},
+				}, nil
+			},
+		}
+
+		filter := &models.SubscriptionFilter{
+			Subscription: models.Subscription{StartDate: month(1, 2026), EndDate: ptr(month(12, 2026))},
+		}
+		ss := service.NewSubscriptionService(m, logger)
+		price, err := ss.CalculatePrice(t.Context(), filter)
+
+		assert.Nil(t, err)
+		assert.Equal(t, 100*12+200*3+300*2, price)
+	})
+
 	t.Run("db error", func(t *testing.T) {
 		m := &MockRepo{
-			func(s *models.Subscription) ([]*models.Subscription, error) {
+			listFn: func(s *models.SubscriptionFilter) ([]*models.Subscription, error) {
 				return nil, errors.New("db error")
 			},
 		}
 
 		ss := service.NewSubscriptionService(m, logger)
-		price, err := ss.CalculatePrice(nil)
+		price, err := ss.CalculatePrice(t.Context(), nil)
 
 		assert.Error(t, err)
 		assert.Equal(t, -1, price)
 	})
 }
+
+func TestSubscriptionService_List(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	m := &MockRepo{
+		listFn: func(f *models.SubscriptionFilter) ([]*models.Subscription, error) {
+			return []*models.Subscription{{Id: 1}, {Id: 2}}, nil
+		},
+		countFn: func(f *models.SubscriptionFilter) (int, error) {
+			return 5, nil
+		},
+	}
+	ss := service.NewSubscriptionService(m, logger)
+
+	t.Run("has next page", func(t *testing.T) {
+		page, err := ss.List(t.Context(), nil, &models.Pagination{Limit: 2, Offset: 0})
+
+		assert.Nil(t, err)
+		assert.Equal(t, 5, page.Total)
+		assert.Len(t, page.Items, 2)
+		if assert.NotNil(t, page.NextOffset) {
+			assert.Equal(t, 2, *page.NextOffset)
+		}
+	})
+
+	t.Run("last page", func(t *testing.T) {
+		page, err := ss.List(t.Context(), nil, &models.Pagination{Limit: 2, Offset: 3})
+
+		assert.Nil(t, err)
+		assert.Nil(t, page.NextOffset)
+	})
+
+	t.Run("nil page", func(t *testing.T) {
+		page, err := ss.List(t.Context(), nil, nil)
+
+		assert.Nil(t, err)
+		assert.Equal(t, models.DefaultPageLimit, page.Limit)
+		assert.Equal(t, 0, page.Offset)
+	})
+
+	t.Run("db error", func(t *testing.T) {
+		m := &MockRepo{}
+		ss := service.NewSubscriptionService(m, logger)
+		page, err := ss.List(t.Context(), nil, &models.Pagination{Limit: 2})
+
+		assert.Error(t, err)
+		assert.Nil(t, page)
+	})
+}
+
+func TestSubscriptionService_Breakdown(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	ss := service.NewSubscriptionService(&MockRepo{}, logger)
+
+	tests := []struct {
+		name    string
+		filter  *models.SubscriptionFilter
+		wantErr bool
+	}{
+		{
+			name: "full window",
+			filter: &models.SubscriptionFilter{
+				Subscription: models.Subscription{StartDate: month(1, 2026), EndDate: ptr(month(12, 2026))},
+			},
+		},
+		{
+			name:    "no filter",
+			wantErr: true,
+		},
+		{
+			name: "no end",
+			filter: &models.SubscriptionFilter{
+				Subscription: models.Subscription{StartDate: month(1, 2026)},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ss.Breakdown(t.Context(), tt.filter)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, service.ErrWindowRequired)
+			} else {
+				assert.Nil(t, err)
+			}
+		})
+	}
+}
+
+func TestSubscriptionService_Recurring(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	ss := service.NewSubscriptionService(&MockRepo{}, logger)
+
+	group, err := ss.Recurring(t.Context(), time.Date(2026, 3, 17, 12, 0, 0, 0, time.UTC))
+	assert.Nil(t, err)
+	assert.Equal(t, &models.CostGroup{Key: "03-2026"}, group)
+}
@@ -0,0 +1,118 @@
+package service
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/EternalQ/effective-mobile-test/pkg/models"
+)
+
+const MaxServiceNameLength = 255
+
+var uuidRe = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// ValidationError lists every rule a subscription violates.
+type ValidationError struct {
+	Fields []*models.FieldError
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, 0, len(e.Fields))
+	for _, f := range e.Fields {
+		msgs = append(msgs, f.Error())
+	}
+	return "validation failed: " + strings.Join(msgs, "; ")
+}
+
+type validator struct {
+	fields []*models.FieldError
+}
+
+func (v *validator) check(ok bool, field, msg string) {
+	if !ok {
+		v.fields = append(v.fields, &models.FieldError{Field: field, Message: msg})
+	}
+}
+
+func (v *validator) err() error {
+	if len(v.fields) == 0 {
+		return nil
+	}
+	return &ValidationError{Fields: v.fields}
+}
+
+func (v *validator) userId(id string) {
+	v.check(uuidRe.MatchString(id), "user_id", "must be a valid UUID")
+}
+
+func (v *validator) serviceName(name string) {
+	name = strings.TrimSpace(name)
+	v.check(name != "", "service_name", "must not be empty")
+	v.check(utf8.RuneCountInString(name) <= MaxServiceNameLength, "service_name",
+		fmt.Sprintf("must be at most %d characters long", MaxServiceNameLength))
+}
+
+func (v *validator) price(price int) {
+	v.check(price > 0, "price", "must be positive")
+}
+
+func (v *validator) dates(start time.Time, end *time.Time) {
+	v.check(end == nil || !end.Before(start), "end_date", "must not be before start_date")
+}
+
+// validateCreate checks a complete subscription.
+func validateCreate(s *models.Subscription) error {
+	v := &validator{}
+	v.userId(s.UserId)
+	v.serviceName(s.ServiceName)
+	v.price(s.Price)
+	v.check(!s.StartDate.IsZero(), "start_date", "is required")
+	if !s.StartDate.IsZero() {
+		v.dates(s.StartDate, s.EndDate)
+	}
+	return v.err()
+}
+
+// validateUpdate checks fields set in a partial update. The date range is
+// checked against the merged dates of the update and the current state.
+func validateUpdate(s *models.Subscription, current *models.Subscription) error {
+	v := &validator{}
+	if s.UserId != "" {
+		v.userId(s.UserId)
+	}
+	if s.ServiceName != "" {
+		v.serviceName(s.ServiceName)
+	}
+	if s.Price != 0 {
+		v.price(s.Price)
+	}
+
+	if current != nil {
+		start, end := current.StartDate, current.EndDate
+		if !s.StartDate.IsZero() {
+			start = s.StartDate
+		}
+		if s.EndDateFormatted == "0" {
+			end = nil
+		} else if s.EndDate != nil {
+			end = s.EndDate
+		}
+		v.dates(start, end)
+	} else if !s.StartDate.IsZero() {
+		v.dates(s.StartDate, s.EndDate)
+	}
+
+	return v.err()
+}
+
+// needsCurrentDates reports whether an update changes only one side of the
+// date range, so the other one has to be read to validate it.
+func needsCurrentDates(s *models.Subscription) bool {
+	hasStart := !s.StartDate.IsZero()
+	hasEnd := s.EndDate != nil
+	clearsEnd := s.EndDateFormatted == "0"
+	return (hasStart && !hasEnd && !clearsEnd) || (hasEnd && !hasStart)
+}
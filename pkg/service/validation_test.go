@@ -0,0 +1,161 @@
+package service_test
+
+import (
+	"log/slog"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/EternalQ/effective-mobile-test/pkg/models"
+	"github.com/EternalQ/effective-mobile-test/pkg/service"
+	"github.com/stretchr/testify/assert"
+)
+
+const testUserId = "60601fee-2bf1-4721-ae6f-7636e79a0cba"
+
+func invalidFields(t *testing.T, err error) []string {
+	t.Helper()
+
+	var validErr *service.ValidationError
+	if !assert.ErrorAs(t, err, &validErr) {
+		return nil
+	}
+	fields := []string{}
+	for _, f := range validErr.Fields {
+		fields = append(fields, f.Field)
+	}
+	return fields
+}
+
+func TestSubscriptionService_Create_Validation(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	ss := service.NewSubscriptionService(&MockRepo{}, logger)
+
+	tests := []struct {
+		name string
+		sub  *models.Subscription
+
+		wantFields []string
+	}{
+		{
+			name: "valid",
+			sub: &models.Subscription{
+				UserId: testUserId, ServiceName: "Yandex Plus", Price: 400,
+				StartDate: month(1, 2026), EndDate: ptr(month(12, 2026)),
+			},
+		},
+		{
+			name: "open-ended",
+			sub: &models.Subscription{
+				UserId: testUserId, ServiceName: "Yandex Plus", Price: 400,
+				StartDate: month(1, 2026),
+			},
+		},
+		{
+			name:       "empty",
+			sub:        &models.Subscription{},
+			wantFields: []string{"user_id", "service_name", "price", "start_date"},
+		},
+		{
+			name: "every rule at once",
+			sub: &models.Subscription{
+				UserId: "not-a-uuid", ServiceName: strings.Repeat("a", service.MaxServiceNameLength+1), Price: -1,
+				StartDate: month(6, 2026), EndDate: ptr(month(1, 2026)),
+			},
+			wantFields: []string{"user_id", "service_name", "price", "end_date"},
+		},
+		{
+			name: "cyrillic service name at the limit",
+			sub: &models.Subscription{
+				UserId: testUserId, ServiceName: strings.Repeat("я", service.MaxServiceNameLength), Price: 400,
+				StartDate: month(1, 2026),
+			},
+		},
+		{
+			name: "blank service name",
+			sub: &models.Subscription{
+				UserId: testUserId, ServiceName: "   ", Price: 400,
+				StartDate: month(1, 2026),
+			},
+			wantFields: []string{"service_name"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ss.Create(t.Context(), tt.sub)
+			if tt.wantFields == nil {
+				assert.Nil(t, err)
+				return
+			}
+			assert.ElementsMatch(t, tt.wantFields, invalidFields(t, err))
+		})
+	}
+}
+
+func TestSubscriptionService_Update_Validation(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	m := &MockRepo{
+		readFn: func(id int) (*models.Subscription, error) {
+			return &models.Subscription{
+				Id: id, StartDate: month(3, 2026), EndDate: ptr(month(6, 2026)),
+			}, nil
+		},
+	}
+	ss := service.NewSubscriptionService(m, logger)
+
+	tests := []struct {
+		name string
+		sub  *models.Subscription
+
+		wantFields []string
+	}{
+		{
+			name: "price only",
+			sub:  &models.Subscription{Price: 100},
+		},
+		{
+			name:       "negative price",
+			sub:        &models.Subscription{Price: -100},
+			wantFields: []string{"price"},
+		},
+		{
+			name:       "invalid user",
+			sub:        &models.Subscription{UserId: "42"},
+			wantFields: []string{"user_id"},
+		},
+		{
+			name: "start before current end",
+			sub:  &models.Subscription{StartDate: month(5, 2026)},
+		},
+		{
+			name:       "start after current end",
+			sub:        &models.Subscription{StartDate: month(8, 2026)},
+			wantFields: []string{"end_date"},
+		},
+		{
+			name:       "end before current start",
+			sub:        &models.Subscription{EndDate: ptr(month(1, 2026))},
+			wantFields: []string{"end_date"},
+		},
+		{
+			name: "start after current end with cleared end",
+			sub:  &models.Subscription{StartDate: month(8, 2026), EndDateFormatted: "0"},
+		},
+		{
+			name:       "both dates reversed",
+			sub:        &models.Subscription{StartDate: month(8, 2026), EndDate: ptr(month(7, 2026))},
+			wantFields: []string{"end_date"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.sub.Id = 1
+			err := ss.Update(t.Context(), tt.sub)
+			if tt.wantFields == nil {
+				assert.Nil(t, err)
+				return
+			}
+			assert.ElementsMatch(t, tt.wantFields, invalidFields(t, err))
+		})
+	}
+}
@@ -0,0 +1,188 @@
+// Package tenant resolves the business unit a request works for and its
+// defaults. Subscriptions of a tenant are never visible to other tenants.
+package tenant
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// DefaultID is the tenant of requests that don't name one and of
+// subscriptions created before tenants were introduced.
+const DefaultID = "default"
+
+var (
+	ErrInvalidID = errors.New("invalid tenant ID")
+	ErrUnknown   = errors.New("unknown tenant")
+)
+
+var (
+	idRe       = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,62}$`)
+	currencyRe = regexp.MustCompile(`^[A-Z]{3}$`)
+)
+
+// ValidID reports whether id is a lowercase slug of up to 63 characters.
+func ValidID(id string) bool {
+	return idRe.MatchString(id)
+}
+
+// Tenant is a business unit with its defaults.
+type Tenant struct {
+	Id string `json:"id"`
+	// Currency is the ISO 4217 code prices of the tenant are in.
+	Currency string `json:"currency"`
+	// TimeZone is the IANA zone the current month is taken in.
+	TimeZone string `json:"time_zone"`
+
+	location *time.Location
+}
+
+// Location returns the tenant time zone, UTC for a nil tenant.
+func (t *Tenant) Location() *time.Location {
+	if t == nil || t.location == nil {
+		return time.UTC
+	}
+	return t.location
+}
+
+// CurrentMonth returns the first day of the month it is now in the tenant
+// time zone. It is in UTC, like subscription dates.
+func (t *Tenant) CurrentMonth() time.Time {
+	now := time.Now().In(t.Location())
+	return time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// withDefaults fills settings t leaves empty from defaults and loads the
+// time zone.
+func (t *Tenant) withDefaults(defaults *Tenant) (*Tenant, error) {
+	c := *t
+	if !ValidID(c.Id) {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidID, c.Id)
+	}
+	if c.Currency == "" {
+		c.Currency = defaults.Currency
+	}
+	if !currencyRe.MatchString(c.Currency) {
+		return nil, fmt.Errorf("tenant %s: currency %q is not an ISO 4217 code", c.Id, c.Currency)
+	}
+	if c.TimeZone == "" {
+		c.TimeZone = defaults.TimeZone
+	}
+
+	var err error
+	if c.location, err = time.LoadLocation(c.TimeZone); err != nil {
+		return nil, fmt.Errorf("tenant %s: %w", c.Id, err)
+	}
+	return &c, nil
+}
+
+// Registry knows the defaults of every tenant.
+type Registry struct {
+	defaults *Tenant
+	tenants  map[string]*Tenant
+	// strict rejects tenants not listed.
+	strict bool
+}
+
+// NewRegistry creates a registry of the listed tenants, settings they leave
+// empty are taken from defaults. Without listed tenants any valid tenant ID
+// is accepted with the defaults, otherwise only the listed ones and
+// DefaultID are.
+func NewRegistry(defaults Tenant, listed []*Tenant) (*Registry, error) {
+	defaults.Id = DefaultID
+	d, err := defaults.withDefaults(&defaults)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Registry{
+		defaults: d,
+		tenants:  map[string]*Tenant{DefaultID: d},
+		strict:   len(listed) > 0,
+	}
+	for _, t := range listed {
+		c, err := t.withDefaults(d)
+		if err != nil {
+			return nil, err
+		}
+		r.tenants[c.Id] = c
+	}
+	return r, nil
+}
+
+// LoadFile reads a JSON array of tenants.
+func LoadFile(path string) ([]*Tenant, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read tenants: %w", err)
+	}
+
+	var tenants []*Tenant
+	if err := json.Unmarshal(raw, &tenants); err != nil {
+		return nil, fmt.Errorf("parse tenants: %w", err)
+	}
+	return tenants, nil
+}
+
+// Lookup returns the tenant with the given ID, the default one for an empty
+// ID.
+func (r *Registry) Lookup(id string) (*Tenant, error) {
+	if id == "" {
+		id = DefaultID
+	}
+	if !ValidID(id) {
+		return nil, ErrInvalidID
+	}
+	if t, ok := r.tenants[id]; ok {
+		return t, nil
+	}
+	if r.strict {
+		return nil, ErrUnknown
+	}
+
+	t := *r.defaults
+	t.Id = id
+	return &t, nil
+}
+
+// All returns the known tenants ordered by ID. Tenants accepted without
+// being listed are not included.
+func (r *Registry) All() []*Tenant {
+	res := make([]*Tenant, 0, len(r.tenants))
+	for _, t := range r.tenants {
+		res = append(res, t)
+	}
+	slices.SortFunc(res, func(a, b *Tenant) int {
+		return strings.Compare(a.Id, b.Id)
+	})
+	return res
+}
+
+type ctxKey struct{}
+
+// WithTenant returns a copy of ctx carrying t.
+func WithTenant(ctx context.Context, t *Tenant) context.Context {
+	return context.WithValue(ctx, ctxKey{}, t)
+}
+
+// FromContext returns the tenant stored in ctx, nil when there is none.
+func FromContext(ctx context.Context) *Tenant {
+	t, _ := ctx.Value(ctxKey{}).(*Tenant)
+	return t
+}
+
+// ID returns the ID of the tenant stored in ctx, DefaultID when there is
+// none. Repositories scope every query by it.
+func ID(ctx context.Context) string {
+	if t := FromContext(ctx); t != nil {
+		return t.Id
+	}
+	return DefaultID
+}
@@ -0,0 +1,70 @@
+package tenant
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistry(t *testing.T) {
+	defaults := Tenant{Currency: "RUB", TimeZone: "Europe/Moscow"}
+
+	t.Run("open", func(t *testing.T) {
+		r, err := NewRegistry(defaults, nil)
+		require.NoError(t, err)
+
+		def, err := r.Lookup("")
+		require.NoError(t, err)
+		assert.Equal(t, DefaultID, def.Id)
+		assert.Equal(t, "Europe/Moscow", def.Location().String())
+
+		acme, err := r.Lookup("acme")
+		require.NoError(t, err)
+		assert.Equal(t, "acme", acme.Id)
+		assert.Equal(t, "RUB", acme.Currency)
+
+		_, err = r.Lookup("Not A Slug")
+		assert.ErrorIs(t, err, ErrInvalidID)
+	})
+
+	t.Run("listed", func(t *testing.T) {
+		r, err := NewRegistry(defaults, []*Tenant{{Id: "acme", Currency: "USD", TimeZone: "America/New_York"}, {Id: "retail"}})
+		require.NoError(t, err)
+
+		acme, err := r.Lookup("acme")
+		require.NoError(t, err)
+		assert.Equal(t, "USD", acme.Currency)
+		assert.Equal(t, "America/New_York", acme.Location().String())
+
+		retail, err := r.Lookup("retail")
+		require.NoError(t, err)
+		assert.Equal(t, "RUB", retail.Currency)
+
+		_, err = r.Lookup("other")
+		assert.ErrorIs(t, err, ErrUnknown)
+
+		ids := []string{}
+		for _, t := range r.All() {
+			ids = append(ids, t.Id)
+		}
+		assert.Equal(t, []string{"acme", DefaultID, "retail"}, ids)
+	})
+
+	t.Run("invalid settings", func(t *testing.T) {
+		_, err := NewRegistry(defaults, []*Tenant{{Id: "acme", Currency: "dollars"}})
+		assert.Error(t, err)
+
+		_, err = NewRegistry(defaults, []*Tenant{{Id: "acme", TimeZone: "Mars/Olympus"}})
+		assert.Error(t, err)
+	})
+}
+
+func TestID(t *testing.T) {
+	assert.Equal(t, DefaultID, ID(context.Background()))
+	assert.Nil(t, FromContext(context.Background()))
+
+	ctx := WithTenant(context.Background(), &Tenant{Id: "acme"})
+	assert.Equal(t, "acme", ID(ctx))
+}
@@ -0,0 +1,44 @@
+package tracing
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+)
+
+func TestSetup(t *testing.T) {
+	t.Run("stdout to file", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "traces.json")
+		shutdown, err := Setup(context.Background(), Config{
+			ServiceName: "test",
+			Exporter:    ExporterStdout,
+			File:        file,
+			SampleRatio: 1,
+		})
+		require.NoError(t, err)
+
+		_, span := otel.Tracer("test").Start(context.Background(), "operation")
+		span.End()
+		require.NoError(t, shutdown(context.Background()))
+
+		out, err := os.ReadFile(file)
+		require.NoError(t, err)
+		assert.Contains(t, string(out), `"Name":"operation"`)
+	})
+
+	t.Run("none", func(t *testing.T) {
+		shutdown, err := Setup(context.Background(), Config{Exporter: ExporterNone})
+		require.NoError(t, err)
+		assert.NoError(t, shutdown(context.Background()))
+	})
+
+	t.Run("unknown exporter", func(t *testing.T) {
+		_, err := Setup(context.Background(), Config{Exporter: "zipkin"})
+		assert.ErrorIs(t, err, ErrUnknownExporter)
+	})
+}